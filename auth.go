@@ -0,0 +1,147 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+)
+
+// Auth Types supported by GoContainer.OpenSSH
+const (
+	AuthPassword = "password" // Credential is the user's password
+	AuthKey      = "key"      // Credential is a PEM private key, or a path to one, SecurityString its passphrase
+	AuthAgent    = "agent"    // keys come from the ssh-agent at SSH_AUTH_SOCK, Credential optionally picks one public key
+)
+
+// validate checks that an Auth has everything SSH needs
+func (a *Auth) validate() error {
+	if a.Type == "" {
+		return errors.New("no GoContainer Auth Profile has been set for SSH")
+	} else if a.Type != AuthPassword && a.Type != AuthKey && a.Type != AuthAgent {
+		return fmt.Errorf("unsupported GoContainer Auth Type %q", a.Type)
+	} else if a.Credential == "" && a.Type != AuthAgent {
+		return errors.New("no GoContainer Auth Credential has been set for SSH")
+	} else if a.User == "" {
+		return errors.New("no GoContainer Auth User has been set for SSH")
+	} else if a.Port == "" {
+		return errors.New("no GoContainer Auth Port has been set for SSH")
+	}
+	return nil
+}
+
+// signer loads the private key of a key Auth, decrypting it with SecurityString when set
+func (a *Auth) signer() (ssh.Signer, error) {
+	pemBytes := []byte(a.Credential)
+	if !strings.Contains(a.Credential, "PRIVATE KEY") {
+		var err error
+		if pemBytes, err = ioutil.ReadFile(a.Credential); err != nil {
+			return nil, err
+		}
+	}
+	if a.SecurityString != "" {
+		return ssh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(a.SecurityString))
+	}
+	signer, err := ssh.ParsePrivateKey(pemBytes)
+	var missingErr *ssh.PassphraseMissingError
+	if errors.As(err, &missingErr) {
+		return nil, errors.New("the GoContainer Auth key is encrypted but no SecurityString passphrase has been set")
+	}
+	return signer, err
+}
+
+// agentSigners returns the ssh-agent's keys, only the one matching Credential when it is set, and the agent connection to close
+func (a *Auth) agentSigners() ([]ssh.Signer, io.Closer, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, nil, errors.New("SSH_AUTH_SOCK is not set, no ssh-agent is running")
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, nil, err
+	}
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	if a.Credential == "" {
+		return signers, conn, nil
+	}
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(a.Credential))
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	for _, signer := range signers {
+		if bytes.Equal(signer.PublicKey().Marshal(), pubKey.Marshal()) {
+			return []ssh.Signer{signer}, conn, nil
+		}
+	}
+	_ = conn.Close()
+	return nil, nil, errors.New("the ssh-agent does not hold the GoContainer Auth Credential key")
+}
+
+// authMethods returns the ssh.AuthMethods of an Auth, along with anything to close once the handshake is done
+func (a *Auth) authMethods() ([]ssh.AuthMethod, io.Closer, error) {
+	switch a.Type {
+	case AuthKey:
+		signer, err := a.signer()
+		if err != nil {
+			return nil, nil, err
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil, nil
+	case AuthAgent:
+		signers, conn, err := a.agentSigners()
+		if err != nil {
+			return nil, nil, err
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signers...)}, conn, nil
+	}
+	return []ssh.AuthMethod{ssh.Password(a.Credential)}, nil, nil
+}
+
+// AuthorizedKeys returns the authorized_keys lines that let a key or agent Auth log in
+func (a *Auth) AuthorizedKeys() ([]string, error) {
+	var keys []string
+	var signers []ssh.Signer
+	switch a.Type {
+	case AuthKey:
+		signer, err := a.signer()
+		if err != nil {
+			return keys, err
+		}
+		signers = []ssh.Signer{signer}
+	case AuthAgent:
+		agentSigners, conn, err := a.agentSigners()
+		if err != nil {
+			return keys, err
+		}
+		_ = conn.Close()
+		signers = agentSigners
+	default:
+		return keys, fmt.Errorf("a GoContainer Auth of Type %q has no authorized keys", a.Type)
+	}
+	for _, signer := range signers {
+		keys = append(keys, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))))
+	}
+	return keys, nil
+}
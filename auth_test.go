@@ -0,0 +1,187 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// TestAuth
+func TestAuth(t *testing.T) {
+	t.Run("KeyAuth", testKeyAuth)
+	t.Run("AgentAuth", testAgentAuth)
+	t.Run("NilAuth", testNilAuth)
+}
+
+// newTestEncryptedKey generates an RSA private key PEM encrypted with passphrase
+func newTestEncryptedKey(t *testing.T, passphrase string) (string, ssh.PublicKey) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error Generating Test RSA Key: %v", err)
+	}
+	block, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(priv), []byte(passphrase), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatalf("Error Encrypting Test RSA Key: %v", err)
+	}
+	pubKey, err := ssh.NewPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatalf("Error Loading Test RSA Public Key: %v", err)
+	}
+	return string(pem.EncodeToMemory(block)), pubKey
+}
+
+// testKeyAuth
+func testKeyAuth(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testKeyAuth...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("the test SSH server needs the FakeBackend")
+	}
+	keyPEM, pubKey := newTestEncryptedKey(t, "s3cretPhrase")
+	cAuth := NewAuth("tester", AuthKey, keyPEM, "s3cretPhrase", "22")
+	fmt.Println("----------->BEGINNING A: Create a Key Auth Container...")
+	if err := goCluster.CreateContainer(cAuth, true, "KeyAuthTest", "ubuntu", "focal", []byte{}); err != nil {
+		t.Fatalf("Error Creating Key Auth Container: %v", err)
+	}
+	userData := fake.Containers["KeyAuthTest"].Config["user.user-data"]
+	cc, err := LoadCloudConfig([]byte(userData))
+	if err != nil || len(cc.Users) != 1 {
+		t.Fatalf("Error Loading the Key Auth Cloud Config: %v\n%s", err, userData)
+	}
+	authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pubKey)))
+	if len(cc.Users[0].SSHAuthorizedKeys) != 1 || cc.Users[0].SSHAuthorizedKeys[0] != authorizedKey {
+		t.Errorf("Expected the cloud init to authorize the key, got:\n%s", userData)
+	}
+	if !strings.Contains(userData, "PasswordAuthentication no") || cc.Users[0].LockPassword == nil || !*cc.Users[0].LockPassword {
+		t.Errorf("Expected the cloud init to disable password login, got:\n%s", userData)
+	}
+	if strings.Contains(userData, "s3cretPhrase") || strings.Contains(userData, "PRIVATE KEY") {
+		t.Errorf("Expected the cloud init to leave out the private key and its passphrase")
+	}
+	fmt.Println("----------->PASSED A: Create a Key Auth Container...")
+	fmt.Println("----------->BEGINNING B: Open a Key Auth SSH Client...")
+	fakeCon := fake.Containers["KeyAuthTest"]
+	fakeCon.Address = "127.0.0.1"
+	port := startTestSSHServer(t, fakeCon.HostKey, "tester", "", pubKey)
+	cAuth.Port = port
+	goCon, err := goCluster.GetContainer("KeyAuthTest")
+	if err != nil {
+		t.Fatalf("Error Getting Key Auth Container: %v", err)
+	}
+	goCon.Auth = cAuth
+	if err = goCon.OpenSSH(); err != nil {
+		t.Fatalf("Error Opening Key Auth SSHClient: %v", err)
+	}
+	_ = goCon.SSHClient.Close()
+	fmt.Println("----------->PASSED B: Open a Key Auth SSH Client...")
+	fmt.Println("----------->BEGINNING C: Reject a Key Auth without its passphrase...")
+	goCon.Auth = NewAuth("tester", AuthKey, keyPEM, "", port)
+	if err = goCon.OpenSSH(); !errors.Is(err, ErrAuthIncomplete) {
+		t.Errorf("Expected ErrAuthIncomplete without a passphrase, got %v", err)
+	}
+	fmt.Println("----------->PASSED C: Reject a Key Auth without its passphrase...")
+	fmt.Println("<-----------testKeyAuth COMPLETE")
+}
+
+// testAgentAuth
+func testAgentAuth(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testAgentAuth...")
+	_, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("the test SSH server needs the FakeBackend")
+	}
+	priv, signer := newTestKey(t)
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: priv}); err != nil {
+		t.Fatalf("Error Adding Test Agent Key: %v", err)
+	}
+	agentDir, err := ioutil.TempDir("", "go-containers-agent")
+	if err != nil {
+		t.Fatalf("Error Creating Test Agent Directory: %v", err)
+	}
+	defer os.RemoveAll(agentDir)
+	sock := filepath.Join(agentDir, "agent.sock")
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("Error Starting Test Agent: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	defaultSock := os.Getenv("SSH_AUTH_SOCK")
+	_ = os.Setenv("SSH_AUTH_SOCK", sock)
+	defer os.Setenv("SSH_AUTH_SOCK", defaultSock)
+	fakeCon := fake.AddContainer("AgentAuthTest", "ubuntu", "focal")
+	_ = setHostKeys("AgentAuthTest", nil)
+	fakeCon.Address = "127.0.0.1"
+	port := startTestSSHServer(t, fakeCon.HostKey, "tester", "", signer.PublicKey())
+	cAuth := NewAuth("tester", AuthAgent, "", "", port)
+	initFile, err := generateCloudInit(cAuth)
+	if err != nil {
+		t.Fatalf("Error Generating Agent Auth Cloud Init: %v", err)
+	}
+	if !strings.Contains(string(initFile), strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))) {
+		t.Errorf("Expected the cloud init to authorize the agent's key")
+	}
+	goCon := &GoContainer{Name: "AgentAuthTest", Network: &Network{PrivateIP: "127.0.0.1"}, Auth: cAuth}
+	goCon.SetBackend(fake)
+	if err = goCon.OpenSSH(); err != nil {
+		t.Fatalf("Error Opening Agent Auth SSHClient: %v", err)
+	}
+	_ = goCon.SSHClient.Close()
+	_, otherSigner := newTestKey(t)
+	goCon.Auth = NewAuth("tester", AuthAgent, string(ssh.MarshalAuthorizedKey(otherSigner.PublicKey())), "", port)
+	if err = goCon.OpenSSH(); !errors.Is(err, ErrAuthIncomplete) {
+		t.Errorf("Expected ErrAuthIncomplete for a key the agent does not hold, got %v", err)
+	}
+	fmt.Println("<-----------testAgentAuth COMPLETE")
+}
+
+// testNilAuth
+func testNilAuth(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testNilAuth...")
+	goCluster, _ := newTestCluster("")
+	if err := goCluster.CreateContainer(nil, false, "NilAuthTest", "ubuntu", "focal", []byte{}); err != nil {
+		t.Fatalf("Error Creating Container Without Auth: %v", err)
+	}
+	defer goCluster.DeleteContainer("NilAuthTest")
+	goCon, err := goCluster.GetContainer("NilAuthTest")
+	if err != nil {
+		t.Fatalf("Error Getting Container Without Auth: %v", err)
+	}
+	if len(goCon.Network.Connections) != 0 {
+		t.Errorf("Expected No SSH Connection Without Auth, Got %d", len(goCon.Network.Connections))
+	}
+	fmt.Println("<-----------testNilAuth COMPLETE")
+}
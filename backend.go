@@ -0,0 +1,487 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Driver selects how go-containers talks to LXD
+type Driver string
+
+const (
+	DriverREST Driver = "rest" // the LXD REST API over its unix socket
+	DriverCLI  Driver = "cli"  // the lxc command line client
+)
+
+// DefaultDriver is used by any GoCluster, GoContainer or GoImage without a driver of its own
+var DefaultDriver = DriverREST
+
+// Backend performs the LXD operations behind GoCluster, GoContainer and GoImage
+type Backend interface {
+	// Launch creates and starts the container name from alias on remote, an empty remote is a local image
+	Launch(ctx context.Context, name string, remote string, alias string, config map[string]string) error
+	// Start boots a stopped container
+	Start(ctx context.Context, name string) error
+	// Stop shuts down a running container
+	Stop(ctx context.Context, name string) error
+	// Restart stops then boots a running container
+	Restart(ctx context.Context, name string) error
+	// Delete removes a stopped container
+	Delete(ctx context.Context, name string) error
+	// Exec runs argv inside a container and returns its stdout and stderr
+	Exec(ctx context.Context, name string, argv []string) ([]byte, []byte, error)
+	// PushFile writes the file fPath inside a running container from r with mode, creating its parent directories
+	PushFile(ctx context.Context, name string, fPath string, r io.Reader, mode os.FileMode) error
+	// List returns every container on the host
+	List(ctx context.Context) ([]ContainerOutput, error)
+	// Leases returns the DHCP leases of a network
+	Leases(ctx context.Context, network string) ([]NetworkEntry, error)
+	// Snapshot creates the snapshot snapName of a container
+	Snapshot(ctx context.Context, name string, snapName string) error
+	// Snapshots returns the snapshot names of a container
+	Snapshots(ctx context.Context, name string) ([]string, error)
+	// DeleteSnapshot removes the snapshot snapName of a container
+	DeleteSnapshot(ctx context.Context, name string, snapName string) error
+	// Restore rolls a container back to the snapshot snapName
+	Restore(ctx context.Context, name string, snapName string) error
+	// Publish creates an image aliased alias from a container, or its snapshot snapName, and returns its fingerprint
+	Publish(ctx context.Context, name string, snapName string, alias string) (string, error)
+	// Images returns every image on the host
+	Images(ctx context.Context) ([]ImageOutput, error)
+	// DeleteImage removes an image by its fingerprint
+	DeleteImage(ctx context.Context, fingerprint string) error
+	// UpdateImage replaces the properties and the public and auto update flags of an image
+	UpdateImage(ctx context.Context, fingerprint string, update ImageUpdate) error
+	// AddImageAlias points alias at an image
+	AddImageAlias(ctx context.Context, alias string, fingerprint string, description string) error
+	// DeleteImageAlias removes alias
+	DeleteImageAlias(ctx context.Context, alias string) error
+	// RefreshImage updates an image cached from a remote and reports whether a newer image was found
+	RefreshImage(ctx context.Context, fingerprint string) (bool, error)
+	// AddRemote registers a simplestreams image server as the image remote name, trusting certificate, in PEM,
+	// when it is not empty
+	AddRemote(ctx context.Context, name string, server string, certificate string) error
+	// ImportImage imports a unified image tarball, or a split image's metadata and rootfs, as alias and returns its fingerprint
+	ImportImage(ctx context.Context, metadata io.Reader, rootfs io.Reader, alias string) (string, error)
+	// ExportImage streams the files of the image name to part, the metadata of a split image first
+	ExportImage(ctx context.Context, name string, part ImagePartFunc) error
+}
+
+// ImagePartFunc receives each file of an exported image in turn, r is only valid until it returns
+type ImagePartFunc func(fileName string, r io.Reader) error
+
+// sortImageParts puts the metadata file of a split image ahead of its rootfs
+func sortImageParts(names []string) {
+	sort.Slice(names, func(i, j int) bool {
+		iMeta, jMeta := strings.HasPrefix(names[i], "meta-"), strings.HasPrefix(names[j], "meta-")
+		if iMeta != jMeta {
+			return iMeta
+		}
+		return names[i] < names[j]
+	})
+}
+
+// NewBackend returns the Backend for a Driver
+func NewBackend(driver Driver) Backend {
+	if driver == DriverCLI {
+		return NewCLIBackend()
+	}
+	return NewRESTBackend(NewLXDClient(""))
+}
+
+// CLIBackend implements Backend with the lxc command line client
+type CLIBackend struct{}
+
+// NewCLIBackend creates a pointer to a new CLIBackend
+func NewCLIBackend() *CLIBackend {
+	return &CLIBackend{}
+}
+
+// lxc runs an lxc command, returning a CommandError with its stderr on failure, or ctx.Err() once ctx is done
+func (cb *CLIBackend) lxc(ctx context.Context, args ...string) ([]byte, error) {
+	out, errOut, err := LXCContext(ctx, args...)
+	if err == ctx.Err() {
+		return out, err
+	} else if err != nil {
+		return out, newCommandError(append([]string{"lxc"}, args...), errOut, err)
+	}
+	return out, nil
+}
+
+// Launch creates and starts a new container
+func (cb *CLIBackend) Launch(ctx context.Context, name string, remote string, alias string, config map[string]string) error {
+	image := alias
+	if remote != "" {
+		image = remote + ":" + alias
+	}
+	args := []string{"launch", image, name}
+	for key, val := range config {
+		args = append(args, "--config="+key+"="+val)
+	}
+	_, err := cb.lxc(ctx, args...)
+	return err
+}
+
+// Start a container
+func (cb *CLIBackend) Start(ctx context.Context, name string) error {
+	_, err := cb.lxc(ctx, "start", name)
+	return err
+}
+
+// Stop a container
+func (cb *CLIBackend) Stop(ctx context.Context, name string) error {
+	_, err := cb.lxc(ctx, "stop", name)
+	return err
+}
+
+// Restart a container
+func (cb *CLIBackend) Restart(ctx context.Context, name string) error {
+	_, err := cb.lxc(ctx, "restart", name)
+	return err
+}
+
+// Delete a container
+func (cb *CLIBackend) Delete(ctx context.Context, name string) error {
+	_, err := cb.lxc(ctx, "delete", name)
+	return err
+}
+
+// Exec runs a command inside a container and returns its stdout and stderr
+func (cb *CLIBackend) Exec(ctx context.Context, name string, argv []string) ([]byte, []byte, error) {
+	out, errOut, err := LXCContext(ctx, append([]string{"exec", name, "--"}, argv...)...)
+	if err == ctx.Err() {
+		return out, errOut, err
+	} else if err != nil {
+		return out, errOut, newCommandError(argv, errOut, err)
+	}
+	return out, errOut, nil
+}
+
+// PushFile stages a file in a temporary directory for lxc file push
+func (cb *CLIBackend) PushFile(ctx context.Context, name string, fPath string, r io.Reader, mode os.FileMode) error {
+	jobId, err := createJobDirectory("pushes")
+	if err != nil {
+		return err
+	}
+	defer deleteJobDirectory("pushes", jobId)
+	staged, err := filepath.Abs(filepath.Join("pushes", jobId, "file"))
+	if err != nil {
+		return err
+	}
+	if err = stageImagePart(staged, r); err != nil {
+		return err
+	}
+	_, err = cb.lxc(ctx, "file", "push", staged, name+fPath, "--create-dirs", fmt.Sprintf("--mode=%04o", mode.Perm()))
+	return err
+}
+
+// List all containers
+func (cb *CLIBackend) List(ctx context.Context) ([]ContainerOutput, error) {
+	out, err := cb.lxc(ctx, "ls", "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+	lOutput, err := LoadListOut(string(out))
+	if err != nil {
+		return nil, err
+	}
+	return lOutput.Outputs, nil
+}
+
+// Leases lists the DHCP leases of a network
+func (cb *CLIBackend) Leases(ctx context.Context, network string) ([]NetworkEntry, error) {
+	out, err := cb.lxc(ctx, "network", "list-leases", network, "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+	nwOut, err := LoadNetworkOutput(string(out))
+	if err != nil {
+		return nil, err
+	}
+	return nwOut.NetworkEntries, nil
+}
+
+// Snapshot creates a snapshot of a container
+func (cb *CLIBackend) Snapshot(ctx context.Context, name string, snapName string) error {
+	_, err := cb.lxc(ctx, "snapshot", name, snapName)
+	return err
+}
+
+// Snapshots lists the snapshot names of a container from lxc info
+func (cb *CLIBackend) Snapshots(ctx context.Context, name string) ([]string, error) {
+	var snapNames []string
+	out, err := cb.lxc(ctx, "info", name)
+	if err != nil {
+		return snapNames, err
+	}
+	if !bytes.Contains(out, []byte("Snapshots:\n")) {
+		return snapNames, nil
+	}
+	outSnaps := bytes.Split(bytes.Split(out, []byte("Snapshots:\n"))[1], []byte("\n"))
+	for _, outSnap := range outSnaps {
+		outSnap = bytes.Split(outSnap, []byte(" ("))[0]
+		outSnap = bytes.Replace(outSnap, []byte(" "), []byte(""), -1)
+		outSnap = bytes.Replace(outSnap, []byte("\t"), []byte(""), -1)
+		if len(outSnap) != 0 {
+			snapNames = append(snapNames, string(outSnap))
+		}
+	}
+	return snapNames, nil
+}
+
+// DeleteSnapshot deletes a snapshot of a container
+func (cb *CLIBackend) DeleteSnapshot(ctx context.Context, name string, snapName string) error {
+	_, err := cb.lxc(ctx, "delete", name+"/"+snapName)
+	return err
+}
+
+// Restore a container from one of its snapshots
+func (cb *CLIBackend) Restore(ctx context.Context, name string, snapName string) error {
+	_, err := cb.lxc(ctx, "restore", name, snapName)
+	return err
+}
+
+// Publish a container or snapshot as an image and return its fingerprint
+func (cb *CLIBackend) Publish(ctx context.Context, name string, snapName string, alias string) (string, error) {
+	source := name
+	if snapName != "" {
+		source = source + "/" + snapName
+	}
+	out, err := cb.lxc(ctx, "publish", source, "--alias", alias)
+	if err != nil {
+		return "", err
+	}
+	return parseFingerprint(out)
+}
+
+// Images lists all images
+func (cb *CLIBackend) Images(ctx context.Context) ([]ImageOutput, error) {
+	out, err := cb.lxc(ctx, "image", "list", "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+	var images []ImageOutput
+	err = json.Unmarshal(out, &images)
+	return images, err
+}
+
+// DeleteImage deletes an image by its fingerprint
+func (cb *CLIBackend) DeleteImage(ctx context.Context, fingerprint string) error {
+	_, err := cb.lxc(ctx, "image", "delete", fingerprint)
+	return err
+}
+
+// query sends a JSON request to the LXD API through lxc query
+func (cb *CLIBackend) query(ctx context.Context, method string, apiPath string, req interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	_, err = cb.lxc(ctx, "query", "--wait", "-X", method, "-d", string(body), apiPath)
+	return err
+}
+
+// UpdateImage replaces the editable fields of an image
+func (cb *CLIBackend) UpdateImage(ctx context.Context, fingerprint string, update ImageUpdate) error {
+	return cb.query(ctx, "PUT", "/1.0/images/"+url.PathEscape(fingerprint), update)
+}
+
+// AddImageAlias points alias at an image
+func (cb *CLIBackend) AddImageAlias(ctx context.Context, alias string, fingerprint string, description string) error {
+	return cb.query(ctx, "POST", "/1.0/images/aliases", ImageAliasesEntry{ImageAlias{alias, description}, fingerprint})
+}
+
+// DeleteImageAlias removes alias
+func (cb *CLIBackend) DeleteImageAlias(ctx context.Context, alias string) error {
+	_, err := cb.lxc(ctx, "image", "alias", "delete", alias)
+	return err
+}
+
+// RefreshImage updates an image cached from a remote
+func (cb *CLIBackend) RefreshImage(ctx context.Context, fingerprint string) (bool, error) {
+	out, err := cb.lxc(ctx, "image", "refresh", fingerprint)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Contains(out, []byte("refreshed successfully")), nil
+}
+
+// AddRemote adds a public simplestreams image remote. lxc checks the server against the system's CAs, or against
+// certificate when it is not empty, which is written to the remote's file in lxc's servercerts directory
+func (cb *CLIBackend) AddRemote(ctx context.Context, name string, server string, certificate string) error {
+	var certPath string
+	var pinned []byte
+	if certificate != "" {
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			return fmt.Errorf("invalid remote name: %q", name)
+		}
+		if block, _ := pem.Decode([]byte(certificate)); block == nil || block.Type != "CERTIFICATE" {
+			return errors.New("the remote's certificate is not a PEM encoded certificate")
+		} else if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return fmt.Errorf("parsing the remote's certificate: %v", err)
+		}
+		confDir, err := lxcConfigDir()
+		if err != nil {
+			return err
+		}
+		certPath = filepath.Join(confDir, "servercerts", name+".crt")
+		pinned, _ = ioutil.ReadFile(certPath)
+		if err = os.MkdirAll(filepath.Dir(certPath), 0750); err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(certPath, []byte(certificate), 0644); err != nil {
+			return err
+		}
+	}
+	_, err := cb.lxc(ctx, "remote", "add", name, server, "--protocol=simplestreams", "--public")
+	if err != nil && certPath != "" && pinned != nil {
+		ioutil.WriteFile(certPath, pinned, 0644)
+	} else if err != nil && certPath != "" {
+		os.Remove(certPath)
+	}
+	return err
+}
+
+// lxcConfigDir returns the configuration directory of the lxc client
+func lxcConfigDir() (string, error) {
+	if confDir := os.Getenv("LXD_CONF"); confDir != "" {
+		return confDir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	if snapDir := filepath.Join(home, "snap", "lxd", "common", "config"); dirExists(snapDir) {
+		return snapDir, nil
+	}
+	return filepath.Join(home, ".config", "lxc"), nil
+}
+
+// dirExists reports whether dir is an existing directory
+func dirExists(dir string) bool {
+	info, err := os.Stat(dir)
+	return err == nil && info.IsDir()
+}
+
+// ImportImage stages a unified image tarball, or a split image's metadata and rootfs, in a temporary directory
+// for lxc image import, a nil rootfs is a unified image
+func (cb *CLIBackend) ImportImage(ctx context.Context, metadata io.Reader, rootfs io.Reader, alias string) (string, error) {
+	jobId, err := createJobDirectory("imports")
+	if err != nil {
+		return "", err
+	}
+	defer deleteJobDirectory("imports", jobId)
+	importDir, err := filepath.Abs(filepath.Join("imports", jobId))
+	if err != nil {
+		return "", err
+	}
+	args := []string{"image", "import"}
+	for _, part := range []struct {
+		name string
+		r    io.Reader
+	}{{"metadata", metadata}, {"rootfs", rootfs}} {
+		if part.r == nil {
+			continue
+		}
+		fName := filepath.Join(importDir, part.name)
+		if err = stageImagePart(fName, part.r); err != nil {
+			return "", err
+		}
+		args = append(args, fName)
+	}
+	out, err := cb.lxc(ctx, append(args, "--alias", alias)...)
+	if err != nil {
+		return "", err
+	}
+	return parseFingerprint(out)
+}
+
+// stageImagePart copies an image file being imported from r to fName
+func stageImagePart(fName string, r io.Reader) error {
+	f, err := os.Create(fName)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// ExportImage exports the files of an image to a temporary directory and streams them to part
+func (cb *CLIBackend) ExportImage(ctx context.Context, name string, part ImagePartFunc) error {
+	jobId, err := createJobDirectory("exports")
+	if err != nil {
+		return err
+	}
+	defer deleteJobDirectory("exports", jobId)
+	exportDir, err := filepath.Abs(filepath.Join("exports", jobId))
+	if err != nil {
+		return err
+	}
+	if _, err = cb.lxc(ctx, "image", "export", name, exportDir); err != nil {
+		return err
+	}
+	files, err := ioutil.ReadDir(exportDir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	sortImageParts(names)
+	for _, fName := range names {
+		if err = streamImagePart(filepath.Join(exportDir, fName), part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamImagePart passes an exported image file to part
+func streamImagePart(fName string, part ImagePartFunc) error {
+	f, err := os.Open(fName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return part(filepath.Base(fName), f)
+}
+
+// parseFingerprint reads the image fingerprint from lxc publish or import output
+func parseFingerprint(out []byte) (string, error) {
+	if bytes.Contains(out, []byte("fingerprint: ")) {
+		sOut := bytes.Split(out, []byte("fingerprint: "))[1]
+		sOut = bytes.Split(sOut, []byte("\n"))[0]
+		if fingerprint := string(bytes.TrimSpace(sOut)); isFingerprint(fingerprint) {
+			return fingerprint, nil
+		}
+	}
+	return "", fmt.Errorf("lxc did not report an image fingerprint: %q", bytes.TrimSpace(out))
+}
@@ -0,0 +1,403 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// BuildStepKind is what a BuildStep does
+type BuildStepKind string
+
+const (
+	StepRun     BuildStepKind = "run"     // runs Command with sh
+	StepPush    BuildStepKind = "push"    // writes Contents to Path
+	StepInstall BuildStepKind = "install" // installs Packages with the package manager of the image's OS
+	StepEnv     BuildStepKind = "env"     // sets Key to Value for the steps after it and in /etc/environment
+	StepCleanup BuildStepKind = "cleanup" // empties the package caches and temporary directories
+)
+
+// BuildStep is one provisioning step of an ImageSpec
+type BuildStep struct {
+	Kind     BuildStepKind `json:"kind"`
+	Command  string        `json:"command,omitempty"`
+	Path     string        `json:"path,omitempty"`
+	Contents []byte        `json:"contents,omitempty"`
+	Mode     os.FileMode   `json:"mode,omitempty"`
+	Packages []string      `json:"packages,omitempty"`
+	Key      string        `json:"key,omitempty"`
+	Value    string        `json:"value,omitempty"`
+}
+
+// RunStep runs command with sh as root
+func RunStep(command string) BuildStep {
+	return BuildStep{Kind: StepRun, Command: command}
+}
+
+// PushStep writes contents to the file fPath with mode, 0644 when zero
+func PushStep(fPath string, contents []byte, mode os.FileMode) BuildStep {
+	return BuildStep{Kind: StepPush, Path: fPath, Contents: contents, Mode: mode}
+}
+
+// InstallStep installs packages with the package manager of the image's OS
+func InstallStep(packages ...string) BuildStep {
+	return BuildStep{Kind: StepInstall, Packages: packages}
+}
+
+// EnvStep sets the environment variable key to value for the steps after it and in the image's /etc/environment
+func EnvStep(key string, value string) BuildStep {
+	return BuildStep{Kind: StepEnv, Key: key, Value: value}
+}
+
+// CleanupStep empties the package caches and temporary directories of the image
+func CleanupStep() BuildStep {
+	return BuildStep{Kind: StepCleanup}
+}
+
+// ImageSpec describes an image an ImageBuilder builds, a base image and the steps that provision it
+type ImageSpec struct {
+	Name       string            // the alias the built image is published as
+	Type       string            // the OS of the base image, such as ubuntu
+	Release    string            // the release of the base image, such as focal
+	Remote     string            // the remote of the base image, empty uses DefaultImageRemote and then images
+	Steps      []BuildStep       // run in order
+	Properties map[string]string // set on the built image next to os, release, description and build.key
+}
+
+// packageManager is how a BuildStep installs packages and cleans up after them on an OS
+type packageManager struct {
+	install string
+	cleanup string
+}
+
+// packageManagers maps the OS of an image to its packageManager
+var packageManagers = map[string]packageManager{
+	"ubuntu":     {"apt-get update && apt-get install -y --no-install-recommends", "apt-get clean && rm -rf /var/lib/apt/lists/*"},
+	"debian":     {"apt-get update && apt-get install -y --no-install-recommends", "apt-get clean && rm -rf /var/lib/apt/lists/*"},
+	"centos":     {"yum install -y", "yum clean all"},
+	"fedora":     {"dnf install -y", "dnf clean all"},
+	"rockylinux": {"dnf install -y", "dnf clean all"},
+	"almalinux":  {"dnf install -y", "dnf clean all"},
+	"archlinux":  {"pacman -Sy --noconfirm", "pacman -Scc --noconfirm"},
+	"opensuse":   {"zypper --non-interactive install", "zypper clean --all"},
+}
+
+// packageName matches the package names, with an optional version or release, an InstallStep passes to the
+// package manager's shell command
+var packageName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+:=~@/-]*$`)
+
+// nonSystemdOS lists the OSes of images without systemd, whose builders would never report booting
+var nonSystemdOS = map[string]bool{"alpine": true, "devuan": true, "voidlinux": true}
+
+// ImageBuilder builds ImageSpecs into published GoImages on the LXD host of a GoCluster, like a Dockerfile for
+// system containers. Every base image gets a builder container that is kept, stopped, between builds with a
+// snapshot of each step it ran, keyed by the base and every step up to it, so a build only runs the steps after
+// the longest prefix it already built. Builds on the same base must not run at the same time
+type ImageBuilder struct {
+	Cluster *GoCluster
+}
+
+// NewImageBuilder creates a pointer to a new ImageBuilder building on the host of cluster
+func NewImageBuilder(cluster *GoCluster) *ImageBuilder {
+	return &ImageBuilder{cluster}
+}
+
+// buildKeys returns the cache key of an ImageSpec's base and of each of its steps in turn
+func (spec *ImageSpec) buildKeys() ([]string, error) {
+	hash := sha256.Sum256([]byte("go-containers image build\x00" + spec.remote() + "\x00" + spec.Type + "\x00" + spec.Release))
+	keys := []string{hex.EncodeToString(hash[:])}
+	for _, step := range spec.Steps {
+		encoded, err := json.Marshal(step)
+		if err != nil {
+			return nil, err
+		}
+		hash = sha256.Sum256(append([]byte(keys[len(keys)-1]), encoded...))
+		keys = append(keys, hex.EncodeToString(hash[:]))
+	}
+	return keys, nil
+}
+
+// remote returns the remote an ImageSpec's base image is launched from
+func (spec *ImageSpec) remote() string {
+	if spec.Remote != "" {
+		return spec.Remote
+	}
+	if DefaultImageRemote != "" {
+		return DefaultImageRemote
+	}
+	return "images"
+}
+
+// check returns an error for an ImageSpec that cannot be built
+func (spec *ImageSpec) check() error {
+	if spec.Name == "" || spec.Type == "" || spec.Release == "" {
+		return errors.New("an ImageSpec needs a name, a type and a release")
+	} else if nonSystemdOS[spec.Type] {
+		return fmt.Errorf("%s images cannot be built, builders wait for systemd to boot", spec.Type)
+	}
+	for ind, step := range spec.Steps {
+		var err error
+		switch step.Kind {
+		case StepRun:
+			if step.Command == "" {
+				err = errors.New("no command")
+			}
+		case StepPush:
+			if !strings.HasPrefix(step.Path, "/") {
+				err = errors.New("the path must be absolute")
+			}
+		case StepInstall, StepCleanup:
+			if _, ok := packageManagers[spec.Type]; !ok {
+				err = fmt.Errorf("no package manager known for %s", spec.Type)
+			} else if step.Kind == StepInstall && len(step.Packages) == 0 {
+				err = errors.New("no packages")
+			}
+			for _, pkg := range step.Packages {
+				if !packageName.MatchString(pkg) {
+					err = fmt.Errorf("invalid package name: %q", pkg)
+				}
+			}
+		case StepEnv:
+			if step.Key == "" || strings.ContainsAny(step.Key, "= \n") || strings.Contains(step.Value, "\n") {
+				err = errors.New("invalid environment variable")
+			}
+		default:
+			err = errors.New("unknown step kind")
+		}
+		if err != nil {
+			return fmt.Errorf("step %d (%s): %v", ind+1, step.Kind, err)
+		}
+	}
+	return nil
+}
+
+// builderName returns the name of the builder container of a base image key
+func builderName(baseKey string) string {
+	return "build-" + baseKey[:12]
+}
+
+// stepSnapshot returns the name of the snapshot cached after the step with key
+func stepSnapshot(key string) string {
+	return "step-" + key[:16]
+}
+
+// Build builds an ImageSpec and returns the published GoImage, aliased as its Name
+func (ib *ImageBuilder) Build(spec *ImageSpec) (*GoImage, error) {
+	return ib.BuildContext(context.Background(), spec)
+}
+
+// BuildContext is like Build but returns ctx.Err() once ctx is done
+func (ib *ImageBuilder) BuildContext(ctx context.Context, spec *ImageSpec) (*GoImage, error) {
+	if err := spec.check(); err != nil {
+		return nil, &OpError{"build image", spec.Name, nil, err}
+	}
+	keys, err := spec.buildKeys()
+	if err != nil {
+		return nil, &OpError{"build image", spec.Name, nil, err}
+	}
+	builder, cached, fresh, err := ib.builder(ctx, spec, keys[0])
+	if err != nil {
+		return nil, err
+	}
+	defer builder.getBackend().Stop(context.Background(), builder.Name)
+	start := 0
+	for ind := len(keys) - 1; ind > 0; ind-- {
+		if cached[stepSnapshot(keys[ind])] {
+			start = ind
+			break
+		}
+	}
+	if !fresh || start > 0 {
+		if err = ib.resume(ctx, builder, keys[start]); err != nil {
+			return nil, err
+		}
+	}
+	for ind := start; ind < len(spec.Steps); ind++ {
+		if err = ib.runStep(ctx, builder, spec, ind); err != nil {
+			return nil, &OpError{"build image", spec.Name, nil, fmt.Errorf("step %d (%s): %w", ind+1, spec.Steps[ind].Kind, err)}
+		}
+		snapName := stepSnapshot(keys[ind+1])
+		if err = builder.getBackend().Snapshot(ctx, builder.Name, snapName); err != nil {
+			return nil, newOpError("snapshot", builder.Name+"/"+snapName, err, ErrContainerNotFound)
+		}
+	}
+	return ib.publish(ctx, builder, spec, keys[len(keys)-1])
+}
+
+// builder returns the builder container of an ImageSpec's base and the snapshots it has cached, creating it
+// from the base image, and caching the base, when there is none and then reporting it is fresh
+func (ib *ImageBuilder) builder(ctx context.Context, spec *ImageSpec, baseKey string) (*GoContainer, map[string]bool, bool, error) {
+	builder := NewGoContainer(builderName(baseKey), false, spec.Type, spec.Release, []string{}, nil, "default", &Network{}, nil)
+	builder.Remote = spec.remote()
+	builder.SetBackend(ib.Cluster.getBackend())
+	snapNames, err := builder.getBackend().Snapshots(ctx, builder.Name)
+	if err != nil && !isNotFound(err) {
+		return nil, nil, false, newOpError("list snapshots", builder.Name, err, nil)
+	} else if err != nil {
+		if err = builder.CreateContext(ctx); err != nil {
+			return nil, nil, false, err
+		}
+		snapName := stepSnapshot(baseKey)
+		if err = builder.getBackend().Snapshot(ctx, builder.Name, snapName); err != nil {
+			return nil, nil, false, newOpError("snapshot", builder.Name+"/"+snapName, err, ErrContainerNotFound)
+		}
+		return builder, map[string]bool{snapName: true}, true, nil
+	}
+	cached := map[string]bool{}
+	for _, snapName := range snapNames {
+		cached[snapName] = true
+	}
+	return builder, cached, false, nil
+}
+
+// resume rolls the builder container back to the snapshot cached after the step with key and boots it
+func (ib *ImageBuilder) resume(ctx context.Context, builder *GoContainer, key string) error {
+	// a builder left running by an interrupted build is stopped first, a stopped one fails to stop
+	_ = builder.getBackend().Stop(ctx, builder.Name)
+	if err := builder.RestoreContext(ctx, stepSnapshot(key)); err != nil {
+		return err
+	}
+	if err := builder.BootContext(ctx); err != nil {
+		return err
+	}
+	return builder.ensure(ctx)
+}
+
+// runStep runs the step ind of an ImageSpec in the builder container, with the environment set by the steps
+// before it
+func (ib *ImageBuilder) runStep(ctx context.Context, builder *GoContainer, spec *ImageSpec, ind int) error {
+	step := spec.Steps[ind]
+	env := map[string]string{}
+	for _, prev := range spec.Steps[:ind] {
+		if prev.Kind == StepEnv {
+			env[prev.Key] = prev.Value
+		}
+	}
+	switch step.Kind {
+	case StepPush:
+		mode := step.Mode
+		if mode == 0 {
+			mode = 0644
+		}
+		return builder.PushFileContext(ctx, step.Path, bytes.NewReader(step.Contents), mode)
+	case StepEnv:
+		return ib.setEnvironment(ctx, builder, step.Key, step.Value)
+	case StepInstall:
+		env["DEBIAN_FRONTEND"] = "noninteractive"
+		return ib.run(ctx, builder, env, packageManagers[spec.Type].install+" "+strings.Join(step.Packages, " "))
+	case StepCleanup:
+		return ib.run(ctx, builder, env, packageManagers[spec.Type].cleanup+" && rm -rf /tmp/* /var/tmp/*")
+	}
+	return ib.run(ctx, builder, env, step.Command)
+}
+
+// run runs command with sh in the builder container with env
+func (ib *ImageBuilder) run(ctx context.Context, builder *GoContainer, env map[string]string, command string) error {
+	argv := []string{"sh", "-c", command}
+	if len(env) > 0 {
+		var vars []string
+		for key, val := range env {
+			vars = append(vars, key+"="+val)
+		}
+		sort.Strings(vars)
+		argv = append(append([]string{"env"}, vars...), argv...)
+	}
+	_, _, err := builder.getBackend().Exec(ctx, builder.Name, argv)
+	return newOpError("exec", builder.Name, err, ErrContainerNotFound)
+}
+
+// setEnvironment sets key to value in the builder container's /etc/environment
+func (ib *ImageBuilder) setEnvironment(ctx context.Context, builder *GoContainer, key string, value string) error {
+	current, _, err := builder.getBackend().Exec(ctx, builder.Name, []string{"cat", "/etc/environment"})
+	var cmdErr *CommandError
+	if err != nil && !errors.As(err, &cmdErr) {
+		return newOpError("exec", builder.Name, err, ErrContainerNotFound)
+	} else if err != nil {
+		current = nil
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(string(current)), "\n") {
+		if line != "" && !strings.HasPrefix(line, key+"=") {
+			lines = append(lines, line)
+		}
+	}
+	lines = append(lines, key+"="+value)
+	environment := strings.Join(lines, "\n") + "\n"
+	return builder.PushFileContext(ctx, "/etc/environment", strings.NewReader(environment), 0644)
+}
+
+// publish publishes the snapshot cached after the last step as the ImageSpec's image, moves its Name alias to
+// it and sets its properties, an image the alias pointed at before is left for PruneImages
+func (ib *ImageBuilder) publish(ctx context.Context, builder *GoContainer, spec *ImageSpec, key string) (*GoImage, error) {
+	cu := ib.Cluster
+	staging := spec.Name + "-build-" + key[:12]
+	fingerprint, err := cu.getBackend().Publish(ctx, builder.Name, stepSnapshot(key), staging)
+	if err != nil {
+		return nil, newOpError("publish", builder.Name, err, ErrSnapshotNotFound)
+	}
+	if err = cu.DeleteImageAliasContext(ctx, spec.Name); err == nil || errors.Is(err, ErrImageNotFound) {
+		err = cu.AddImageAliasContext(ctx, fingerprint, spec.Name, "built from "+spec.Type+"/"+spec.Release)
+	}
+	// the staging alias goes even when the Name alias failed to move, a stale one fails the next publish of this build
+	if stagingErr := cu.DeleteImageAliasContext(context.Background(), staging); err == nil {
+		err = stagingErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	properties := map[string]string{
+		"os":          spec.Type,
+		"release":     spec.Release,
+		"description": spec.Name + " built from " + spec.Type + "/" + spec.Release,
+		"build.key":   key,
+	}
+	for prop, val := range spec.Properties {
+		properties[prop] = val
+	}
+	if err = cu.SetImagePropertiesContext(ctx, fingerprint, properties); err != nil {
+		return nil, err
+	}
+	return cu.GetImageContext(ctx, fingerprint)
+}
+
+// ClearCache deletes the builder container, and every step it cached, of an ImageSpec's base image, the next
+// build starts over from a fresh copy of the base image
+func (ib *ImageBuilder) ClearCache(spec *ImageSpec) error {
+	return ib.ClearCacheContext(context.Background(), spec)
+}
+
+// ClearCacheContext is like ClearCache but returns ctx.Err() once ctx is done
+func (ib *ImageBuilder) ClearCacheContext(ctx context.Context, spec *ImageSpec) error {
+	keys, err := spec.buildKeys()
+	if err != nil {
+		return &OpError{"clear build cache", spec.Name, nil, err}
+	}
+	backend := ib.Cluster.getBackend()
+	name := builderName(keys[0])
+	_ = backend.Stop(ctx, name)
+	err = backend.Delete(ctx, name)
+	if isNotFound(err) {
+		return nil
+	}
+	return newOpError("clear build cache", name, err, nil)
+}
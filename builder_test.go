@@ -0,0 +1,187 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestImageBuilder
+func TestImageBuilder(t *testing.T) {
+	t.Run("Build", testImageBuilderBuild)
+	t.Run("Invalid", testImageBuilderInvalid)
+}
+
+// fakeBuildCommands adds the FakeCommands the image build test steps run
+func fakeBuildCommands(fake *FakeBackend) {
+	fake.Commands["apt-get"] = func(con *FakeContainer, user string, args []string) ([]byte, []byte, int) {
+		for _, arg := range args {
+			if !strings.HasPrefix(arg, "-") && arg != "install" && arg != "update" && arg != "clean" {
+				con.Files["/usr/sbin/"+arg] = []byte("#!/bin/sh\n")
+			}
+		}
+		return []byte{}, []byte{}, 0
+	}
+	fake.Commands["touch"] = func(con *FakeContainer, user string, args []string) ([]byte, []byte, int) {
+		for _, arg := range args {
+			con.Files[arg] = []byte{}
+		}
+		return []byte{}, []byte{}, 0
+	}
+	fake.Commands["rm"] = func(con *FakeContainer, user string, args []string) ([]byte, []byte, int) {
+		return []byte{}, []byte{}, 0
+	}
+}
+
+// builderSteps counts the step commands a FakeContainer ran, leaving out its boot checks
+func builderSteps(con *FakeContainer) int {
+	steps := 0
+	for _, argv := range con.Execs {
+		if strings.HasPrefix(argv[len(argv)-1], "systemctl ") {
+			continue
+		}
+		if argv[0] == "sh" || argv[0] == "env" || argv[0] == "cat" {
+			steps++
+		}
+	}
+	return steps
+}
+
+// testImageBuilderBuild
+func testImageBuilderBuild(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testImageBuilderBuild...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("the build test steps need the FakeBackend's commands")
+	}
+	fakeBuildCommands(fake)
+	builder := NewImageBuilder(goCluster)
+	spec := &ImageSpec{
+		Name:    "web",
+		Type:    "ubuntu",
+		Release: "focal",
+		Steps: []BuildStep{
+			EnvStep("APP_ENV", "production"),
+			InstallStep("nginx"),
+			PushStep("/etc/app/app.conf", []byte("listen 80\n"), 0600),
+			RunStep("touch /srv/ready"),
+			CleanupStep(),
+		},
+		Properties: map[string]string{"team": "web"},
+	}
+	fmt.Println("----------->BEGINNING A: Building An Image...")
+	img, err := builder.Build(spec)
+	if err != nil {
+		t.Fatalf("Error Building Image: %v", err)
+	}
+	if img.Name != "web" || img.Properties["os"] != "ubuntu" || img.Properties["release"] != "focal" || img.Properties["team"] != "web" || img.Properties["build.key"] == "" {
+		t.Errorf("Expected The Built Image With Its Properties, Got %+v", img)
+	}
+	if err = fake.Launch(context.Background(), "BuiltWeb", "", "web", map[string]string{}); err != nil {
+		t.Fatalf("Error Launching The Built Image: %v", err)
+	}
+	files := fake.Containers["BuiltWeb"].Files
+	if string(files["/etc/app/app.conf"]) != "listen 80\n" || files["/usr/sbin/nginx"] == nil || files["/srv/ready"] == nil {
+		t.Errorf("Expected The Built Image To Hold The Provisioned Files")
+	}
+	if !strings.Contains(string(files["/etc/environment"]), "APP_ENV=production\n") {
+		t.Errorf("Expected APP_ENV In /etc/environment, Got %q", files["/etc/environment"])
+	}
+	keys, _ := spec.buildKeys()
+	buildCon := fake.Containers[builderName(keys[0])]
+	if buildCon == nil || buildCon.Status != "Stopped" || len(buildCon.Snapshots) != len(spec.Steps)+1 {
+		t.Fatalf("Expected A Stopped Builder Container With A Snapshot Per Step")
+	}
+	fmt.Println("----------->PASSED A: Building An Image...")
+	fmt.Println("----------->BEGINNING B: Rebuilding From The Cache...")
+	ran := builderSteps(buildCon)
+	rebuilt, err := builder.Build(spec)
+	if err != nil {
+		t.Fatalf("Error Rebuilding Image: %v", err)
+	}
+	if builderSteps(buildCon) != ran || rebuilt.Properties["build.key"] != img.Properties["build.key"] {
+		t.Errorf("Expected An Unchanged Spec To Be Rebuilt From The Cache")
+	}
+	spec.Steps[len(spec.Steps)-1] = RunStep("touch /srv/changed")
+	changed, err := builder.Build(spec)
+	if err != nil {
+		t.Fatalf("Error Rebuilding Changed Image: %v", err)
+	}
+	if builderSteps(buildCon) != ran+1 || changed.Properties["build.key"] == img.Properties["build.key"] {
+		t.Errorf("Expected Only The Changed Step To Run, Ran %d", builderSteps(buildCon)-ran)
+	}
+	web, err := goCluster.GetImage("web")
+	if err != nil || web.Fingerprint != changed.Fingerprint {
+		t.Errorf("Expected The web Alias To Move To The Rebuilt Image, Got %v", err)
+	}
+	fmt.Println("----------->PASSED B: Rebuilding From The Cache...")
+	fmt.Println("----------->BEGINNING C: Clearing The Cache...")
+	if err = builder.ClearCache(spec); err != nil {
+		t.Fatalf("Error Clearing Build Cache: %v", err)
+	}
+	if _, ok := fake.Containers[builderName(keys[0])]; ok {
+		t.Errorf("Expected The Builder Container To Be Deleted")
+	}
+	if err = builder.ClearCache(spec); err != nil {
+		t.Errorf("Expected Clearing An Empty Cache To Succeed, Got %v", err)
+	}
+	fmt.Println("----------->PASSED C: Clearing The Cache...")
+	fmt.Println("----------->BEGINNING D: Failing After Publishing...")
+	fake.Fail("AddImageAlias", errors.New("alias refused"))
+	if _, err = builder.Build(spec); err == nil {
+		t.Fatalf("Expected The Build To Fail When Its Alias Is Refused")
+	}
+	fake.Fail("AddImageAlias", nil)
+	for _, stored := range fake.StoredImages {
+		for _, alias := range stored.Aliases {
+			if strings.Contains(alias, "-build-") {
+				t.Errorf("Expected The Staging Alias To Be Removed, Got %s", alias)
+			}
+		}
+	}
+	if _, err = builder.Build(spec); err != nil {
+		t.Errorf("Error Rebuilding After A Failed Build: %v", err)
+	}
+	fmt.Println("----------->PASSED D: Failing After Publishing...")
+	fmt.Println("<-----------testImageBuilderBuild COMPLETE")
+}
+
+// testImageBuilderInvalid
+func testImageBuilderInvalid(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testImageBuilderInvalid...")
+	goCluster, fake := newTestCluster("")
+	builder := NewImageBuilder(goCluster)
+	for _, spec := range []*ImageSpec{
+		{Name: "", Type: "ubuntu", Release: "focal"},
+		{Name: "bad", Type: "plan9", Release: "4", Steps: []BuildStep{InstallStep("rc")}},
+		{Name: "bad", Type: "alpine", Release: "3.13", Steps: []BuildStep{RunStep("true")}},
+		{Name: "bad", Type: "ubuntu", Release: "focal", Steps: []BuildStep{InstallStep("nginx; rm -rf /")}},
+		{Name: "bad", Type: "ubuntu", Release: "focal", Steps: []BuildStep{InstallStep("$(id)")}},
+		{Name: "bad", Type: "ubuntu", Release: "focal", Steps: []BuildStep{InstallStep("--allow-unauthenticated")}},
+		{Name: "bad", Type: "ubuntu", Release: "focal", Steps: []BuildStep{PushStep("relative/path", nil, 0)}},
+		{Name: "bad", Type: "ubuntu", Release: "focal", Steps: []BuildStep{EnvStep("A=B", "c")}},
+		{Name: "bad", Type: "ubuntu", Release: "focal", Steps: []BuildStep{{Kind: "copy"}}},
+	} {
+		if _, err := builder.Build(spec); err == nil {
+			t.Errorf("Expected %+v To Be Refused", spec)
+		}
+	}
+	if fake != nil && len(fake.Containers) != 0 {
+		t.Errorf("Expected Refused Specs Not To Create A Builder")
+	}
+	fmt.Println("<-----------testImageBuilderInvalid COMPLETE")
+}
@@ -0,0 +1,388 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"regexp"
+	"strings"
+)
+
+// WaitForCloudInit makes Create and CreateContainer wait for cloud-init to finish with a GoContainer's InitFile,
+// and fail with ErrCloudInitFailed when it reports errors
+var WaitForCloudInit = false
+
+// cloud-init's result and output files
+const (
+	cloudInitResultFile = "/run/cloud-init/result.json"
+	cloudInitOutputFile = "/var/log/cloud-init-output.log"
+)
+
+// CloudConfig is a cloud-init #cloud-config document
+type CloudConfig struct {
+	Hostname          string       `yaml:"hostname,omitempty"`
+	Timezone          string       `yaml:"timezone,omitempty"`
+	SSHPasswordAuth   *bool        `yaml:"ssh_pwauth,omitempty"`
+	Groups            []CloudGroup `yaml:"groups,omitempty"`
+	Users             []CloudUser  `yaml:"users,omitempty"`
+	SSHAuthorizedKeys []string     `yaml:"ssh_authorized_keys,omitempty"`
+	Apt               *CloudApt    `yaml:"apt,omitempty"`
+	PackageUpdate     bool         `yaml:"package_update,omitempty"`
+	PackageUpgrade    bool         `yaml:"package_upgrade,omitempty"`
+	Packages          []string     `yaml:"packages,omitempty"`
+	WriteFiles        []CloudFile  `yaml:"write_files,omitempty"`
+	BootCMD           []string     `yaml:"bootcmd,omitempty"`
+	RunCMD            []string     `yaml:"runcmd,omitempty"`
+}
+
+// NewCloudConfig creates a pointer to a new, empty CloudConfig
+func NewCloudConfig() *CloudConfig {
+	return &CloudConfig{}
+}
+
+// CloudGroup is a group cloud-init creates, with any Members added to it
+type CloudGroup struct {
+	Name    string
+	Members []string
+}
+
+// MarshalYAML writes a CloudGroup as its name, or as a map of its name to its members
+func (cg CloudGroup) MarshalYAML() (interface{}, error) {
+	if len(cg.Members) == 0 {
+		return cg.Name, nil
+	}
+	return map[string][]string{cg.Name: cg.Members}, nil
+}
+
+// UnmarshalYAML reads a CloudGroup written as a name, or as a map of its name to its members
+func (cg *CloudGroup) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		cg.Name, cg.Members = name, nil
+		return nil
+	}
+	var group map[string][]string
+	if err := unmarshal(&group); err != nil {
+		return err
+	}
+	if len(group) != 1 {
+		return fmt.Errorf("a cloud-init group must map one name to its members, got %d", len(group))
+	}
+	for name, members := range group {
+		cg.Name, cg.Members = name, members
+	}
+	return nil
+}
+
+// CloudUser is a user cloud-init creates
+type CloudUser struct {
+	Name              string   `yaml:"name"`
+	Gecos             string   `yaml:"gecos,omitempty"`
+	PlainTextPassword string   `yaml:"plain_text_passwd,omitempty"`
+	HashedPassword    string   `yaml:"passwd,omitempty"`
+	LockPassword      *bool    `yaml:"lock_passwd,omitempty"`
+	SSHAuthorizedKeys []string `yaml:"ssh_authorized_keys,omitempty"`
+	Sudo              []string `yaml:"sudo,omitempty"`
+	Groups            string   `yaml:"groups,omitempty"`
+	Shell             string   `yaml:"shell,omitempty"`
+	HomeDir           string   `yaml:"homedir,omitempty"`
+	System            bool     `yaml:"system,omitempty"`
+}
+
+// NewCloudUser creates a pointer to a new CloudUser with passwordless sudo and a bash shell
+func NewCloudUser(name string) *CloudUser {
+	return &CloudUser{Name: name, Sudo: []string{"ALL=(ALL) NOPASSWD:ALL"}, Groups: "sudo", Shell: "/bin/bash"}
+}
+
+// CloudFile is a file cloud-init writes, Permissions is an octal string such as "0644"
+type CloudFile struct {
+	Path        string `yaml:"path"`
+	Content     string `yaml:"content"`
+	Owner       string `yaml:"owner,omitempty"`
+	Permissions string `yaml:"permissions,omitempty"`
+	Encoding    string `yaml:"encoding,omitempty"`
+	Append      bool   `yaml:"append,omitempty"`
+}
+
+// CloudApt configures apt, Sources is keyed by the sources.list.d file name of each source
+type CloudApt struct {
+	Sources map[string]CloudAptSource `yaml:"sources,omitempty"`
+}
+
+// CloudAptSource is an apt source and the key it is signed with
+type CloudAptSource struct {
+	Source    string `yaml:"source,omitempty"`
+	KeyID     string `yaml:"keyid,omitempty"`
+	Key       string `yaml:"key,omitempty"`
+	KeyServer string `yaml:"keyserver,omitempty"`
+}
+
+// AddUser appends a user to the CloudConfig
+func (cc *CloudConfig) AddUser(user *CloudUser) {
+	cc.Users = append(cc.Users, *user)
+}
+
+// AddGroup appends a group, with any members added to it, to the CloudConfig
+func (cc *CloudConfig) AddGroup(name string, members ...string) {
+	cc.Groups = append(cc.Groups, CloudGroup{name, members})
+}
+
+// AddFile appends a file to be written to the CloudConfig
+func (cc *CloudConfig) AddFile(path string, content string, permissions string) {
+	cc.WriteFiles = append(cc.WriteFiles, CloudFile{Path: path, Content: content, Permissions: permissions})
+}
+
+// AddAptSource adds an apt source, signed by the key with keyID on the default keyserver, to the CloudConfig
+func (cc *CloudConfig) AddAptSource(name string, source string, keyID string) {
+	if cc.Apt == nil {
+		cc.Apt = &CloudApt{}
+	}
+	if cc.Apt.Sources == nil {
+		cc.Apt.Sources = map[string]CloudAptSource{}
+	}
+	cc.Apt.Sources[name] = CloudAptSource{Source: source, KeyID: keyID}
+}
+
+// Marshal writes the CloudConfig as #cloud-config YAML, the form NewGoContainer and CreateContainer take as an init file
+func (cc *CloudConfig) Marshal() ([]byte, error) {
+	out, err := yaml.Marshal(cc)
+	if err != nil {
+		return []byte{}, err
+	}
+	return append([]byte("#cloud-config\n"), out...), nil
+}
+
+// LoadCloudConfig reads #cloud-config YAML into a CloudConfig
+func LoadCloudConfig(initFile []byte) (*CloudConfig, error) {
+	cc := NewCloudConfig()
+	err := yaml.Unmarshal([]byte(cloudInitUserData(initFile)), cc)
+	return cc, err
+}
+
+// ApplyAuth adds auth's user, and an sshd_config on auth's port that only allows that user, to the CloudConfig
+func (cc *CloudConfig) ApplyAuth(auth *Auth) error {
+	user := NewCloudUser(auth.User)
+	passwordLogin := false
+	switch auth.Type {
+	case AuthPassword:
+		passwordLogin = true
+		hash, err := HashPassword(auth.Credential)
+		if err != nil {
+			return err
+		}
+		user.HashedPassword = hash
+	case AuthKey, AuthAgent:
+		keys, err := auth.AuthorizedKeys()
+		if err != nil {
+			return err
+		}
+		user.SSHAuthorizedKeys = keys
+	default:
+		return fmt.Errorf("unsupported GoContainer Auth Type %q", auth.Type)
+	}
+	user.LockPassword = cloudBool(!passwordLogin)
+	cc.SSHPasswordAuth = cloudBool(passwordLogin)
+	cc.AddUser(user)
+	cc.AddFile("/etc/ssh/sshd_config", sshdConfig(auth.User, auth.Port, passwordLogin), "")
+	cc.RunCMD = append(cc.RunCMD, "systemctl restart sshd")
+	return nil
+}
+
+// NewAuthCloudConfig creates a pointer to a new CloudConfig that sets up auth's user for SSH
+func NewAuthCloudConfig(auth *Auth) (*CloudConfig, error) {
+	cc := NewCloudConfig()
+	err := cc.ApplyAuth(auth)
+	return cc, err
+}
+
+// NewPasswordCloudConfig creates a pointer to a new CloudConfig for a user that logs in over SSH on port with password,
+// which is only written as a SHA-512 crypt hash
+func NewPasswordCloudConfig(user string, password string, port string) *CloudConfig {
+	cc, _ := NewAuthCloudConfig(NewAuth(user, AuthPassword, password, "", port))
+	return cc
+}
+
+// cloudBool returns a pointer to b, for the CloudConfig options that are only written when set
+func cloudBool(b bool) *bool {
+	return &b
+}
+
+// generateCloudInit builds the init file that sets up auth's user for SSH, or nothing for an Auth without a Type
+func generateCloudInit(auth *Auth) ([]byte, error) {
+	if auth.Type == "" {
+		return []byte{}, nil
+	}
+	cc, err := NewAuthCloudConfig(auth)
+	if err != nil {
+		return []byte{}, err
+	}
+	return cc.Marshal()
+}
+
+// cloudInitUserData strips the "cat <<EOF" heredoc wrapper older init files were written with
+func cloudInitUserData(initFile []byte) string {
+	userData := strings.TrimSpace(string(initFile))
+	if strings.HasPrefix(userData, "cat <<EOF") {
+		userData = strings.TrimPrefix(userData, "cat <<EOF")
+		userData = strings.TrimSuffix(userData, "EOF")
+		userData = strings.TrimSpace(userData) + "\n"
+	}
+	return userData
+}
+
+// sshdConfig builds an sshd_config listening on port that only allows user to login, with or without a password
+func sshdConfig(user string, port string, passwordLogin bool) string {
+	passwordAuth := "no"
+	if passwordLogin {
+		passwordAuth = "yes"
+	}
+	return strings.Join([]string{
+		"Port " + port,
+		"Protocol 2",
+		"SyslogFacility AUTH",
+		"LogLevel INFO",
+		"LoginGraceTime 120",
+		"PermitRootLogin no",
+		"StrictModes yes",
+		"PubkeyAuthentication yes",
+		"PasswordAuthentication " + passwordAuth,
+		"KbdInteractiveAuthentication no",
+		"IgnoreRhosts yes",
+		"HostbasedAuthentication no",
+		"PermitEmptyPasswords no",
+		"ChallengeResponseAuthentication no",
+		"X11Forwarding yes",
+		"X11DisplayOffset 10",
+		"PrintMotd no",
+		"PrintLastLog yes",
+		"TCPKeepAlive yes",
+		"AcceptEnv LANG LC_*",
+		"Subsystem sftp /usr/lib/openssh/sftp-server",
+		"UsePAM yes",
+		"AllowUsers " + user,
+	}, "\n") + "\n"
+}
+
+// CloudInitModuleError is an error cloud-init reported, Module is empty when it did not name one
+type CloudInitModuleError struct {
+	Module  string
+	Message string
+}
+
+// CloudInitResult is how cloud-init finished setting up a GoContainer
+type CloudInitResult struct {
+	Status     string
+	Datasource string
+	Errors     []CloudInitModuleError
+	Output     string
+}
+
+// Failed returns whether cloud-init reported an error
+func (cr *CloudInitResult) Failed() bool {
+	return cr.Status == "error" || len(cr.Errors) != 0
+}
+
+// Err returns an error listing the CloudInitResult's errors, or nil if cloud-init did not fail
+func (cr *CloudInitResult) Err() error {
+	if !cr.Failed() {
+		return nil
+	}
+	msgs := []string{"cloud-init status " + cr.Status}
+	for _, modErr := range cr.Errors {
+		if modErr.Module == "" {
+			msgs = append(msgs, modErr.Message)
+		} else {
+			msgs = append(msgs, modErr.Module+": "+modErr.Message)
+		}
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+// cloudInitModuleErr matches the (module, exception) errors of result.json
+var cloudInitModuleErr = regexp.MustCompile(`^\('([^']+)', (.*)\)$`)
+
+// cloudInitOutputErr matches the failed modules of cloud-init-output.log
+var cloudInitOutputErr = regexp.MustCompile(`Failed to run module (\S+)`)
+
+// loadCloudInitResult builds a CloudInitResult from the output of cloud-init status and its result and output files
+func loadCloudInitResult(statusOut []byte, resultJSON []byte, output []byte) (*CloudInitResult, error) {
+	result := &CloudInitResult{Status: "unknown", Output: string(output)}
+	for _, line := range strings.Split(string(statusOut), "\n") {
+		if strings.HasPrefix(line, "status:") {
+			result.Status = strings.TrimSpace(strings.TrimPrefix(line, "status:"))
+		}
+	}
+	modules := map[string]bool{}
+	if len(resultJSON) != 0 {
+		var resultFile struct {
+			V1 struct {
+				Datasource string   `json:"datasource"`
+				Errors     []string `json:"errors"`
+			} `json:"v1"`
+		}
+		if err := json.Unmarshal(resultJSON, &resultFile); err != nil {
+			return result, err
+		}
+		result.Datasource = resultFile.V1.Datasource
+		for _, msg := range resultFile.V1.Errors {
+			modErr := CloudInitModuleError{Message: msg}
+			if match := cloudInitModuleErr.FindStringSubmatch(msg); match != nil {
+				modErr = CloudInitModuleError{match[1], match[2]}
+				modules[modErr.Module] = true
+			}
+			result.Errors = append(result.Errors, modErr)
+		}
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		match := cloudInitOutputErr.FindStringSubmatch(line)
+		if match != nil && !modules[match[1]] {
+			modules[match[1]] = true
+			result.Errors = append(result.Errors, CloudInitModuleError{match[1], strings.TrimSpace(line)})
+		}
+	}
+	return result, nil
+}
+
+// WaitCloudInit waits for cloud-init to finish on a GoContainer and returns how it went
+func (co *GoContainer) WaitCloudInit() (*CloudInitResult, error) {
+	return co.WaitCloudInitContext(context.Background())
+}
+
+// WaitCloudInitContext is like WaitCloudInit but returns ctx.Err() once ctx is done
+func (co *GoContainer) WaitCloudInitContext(ctx context.Context) (*CloudInitResult, error) {
+	var cmdErr *CommandError
+	statusOut, _, err := co.getBackend().Exec(ctx, co.Name, []string{"cloud-init", "status", "--wait"})
+	if err != nil && !(errors.As(err, &cmdErr) && (cmdErr.ExitCode == 1 || cmdErr.ExitCode == 2)) {
+		return nil, newOpError("cloud-init", co.Name, err, ErrContainerNotFound)
+	}
+	files := [][]byte{}
+	for _, fPath := range []string{cloudInitResultFile, cloudInitOutputFile} {
+		out, _, err := co.getBackend().Exec(ctx, co.Name, []string{"cat", fPath})
+		if err != nil && !errors.As(err, &cmdErr) {
+			return nil, newOpError("cloud-init", co.Name, err, ErrContainerNotFound)
+		} else if err != nil {
+			out = []byte{}
+		}
+		files = append(files, out)
+	}
+	result, err := loadCloudInitResult(statusOut, files[0], files[1])
+	if err != nil {
+		return result, newOpError("cloud-init", co.Name, err, nil)
+	}
+	co.CloudInit = result
+	return result, nil
+}
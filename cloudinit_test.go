@@ -0,0 +1,212 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestCloudConfig
+func TestCloudConfig(t *testing.T) {
+	t.Run("RoundTrip", testCloudConfigRoundTrip)
+	t.Run("PasswordPreset", testCloudConfigPasswordPreset)
+	t.Run("CreateContainer", testCloudConfigCreateContainer)
+}
+
+// testCloudConfigRoundTrip
+func testCloudConfigRoundTrip(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testCloudConfigRoundTrip...")
+	cc := NewCloudConfig()
+	cc.Hostname = "web-1"
+	cc.Timezone = "America/New_York"
+	cc.AddGroup("docker", "deploy")
+	cc.AddGroup("audit")
+	user := NewCloudUser("deploy")
+	user.SSHAuthorizedKeys = []string{"ssh-ed25519 AAAA deploy@host"}
+	cc.AddUser(user)
+	cc.AddAptSource("docker.list", "deb [arch=amd64] https://download.docker.com/linux/ubuntu focal stable", "9DC858229FC7DD38854AE2D88D81803C0EBFCD88")
+	cc.PackageUpdate = true
+	cc.Packages = []string{"docker-ce", "jq"}
+	cc.AddFile("/etc/motd", "key: value # not a comment\n'quoted' \"both\"\n", "0644")
+	cc.BootCMD = []string{"echo booting > /dev/console"}
+	cc.RunCMD = []string{"systemctl enable --now docker", "echo 'done: yes'"}
+	initFile, err := cc.Marshal()
+	if err != nil {
+		t.Fatalf("Error Marshalling Cloud Config: %v", err)
+	}
+	if !strings.HasPrefix(string(initFile), "#cloud-config\n") {
+		t.Errorf("Expected A #cloud-config Header, Got:\n%s", initFile)
+	}
+	loaded, err := LoadCloudConfig(initFile)
+	if err != nil {
+		t.Fatalf("Error Loading Cloud Config: %v", err)
+	}
+	if !reflect.DeepEqual(cc, loaded) {
+		t.Errorf("Cloud Config Changed In Round Trip:\n%+v\n%+v", cc, loaded)
+	}
+	if !strings.Contains(string(initFile), "- docker:\n  - deploy\n- audit\n") {
+		t.Errorf("Expected Groups In cloud-init Form, Got:\n%s", initFile)
+	}
+	fmt.Println("<-----------testCloudConfigRoundTrip COMPLETE")
+}
+
+// testCloudConfigPasswordPreset
+func testCloudConfigPasswordPreset(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testCloudConfigPasswordPreset...")
+	password := `p@ss: "w'rd" # {{Username}}`
+	initFile, err := generateCloudInit(NewAuth("tester", AuthPassword, password, "", "2222"))
+	if err != nil {
+		t.Fatalf("Error Generating Password Cloud Init: %v", err)
+	}
+	cc, err := LoadCloudConfig(initFile)
+	if err != nil || len(cc.Users) != 1 {
+		t.Fatalf("Error Loading Password Cloud Init: %v\n%s", err, initFile)
+	}
+	hash := cc.Users[0].HashedPassword
+	if cc.Users[0].Name != "tester" || cc.Users[0].PlainTextPassword != "" || !strings.HasPrefix(hash, "$6$") ||
+		sha512Crypt(password, strings.Split(hash, "$")[2], sha512CryptRounds) != hash {
+		t.Errorf("Expected A SHA-512 Hash Of The Password, Got %q %q", cc.Users[0].PlainTextPassword, hash)
+	}
+	if strings.Contains(string(initFile), "w'rd") || !strings.Contains(string(initFile), "passwd: $6$") {
+		t.Errorf("Expected Only The Password's Hash In The Init File, Got:\n%s", initFile)
+	}
+	if cc.SSHPasswordAuth == nil || !*cc.SSHPasswordAuth || cc.Users[0].LockPassword == nil || *cc.Users[0].LockPassword {
+		t.Errorf("Expected Password Login To Be Enabled, Got:\n%s", initFile)
+	}
+	if len(cc.WriteFiles) != 1 || !strings.Contains(cc.WriteFiles[0].Content, "Port 2222\n") ||
+		!strings.Contains(cc.WriteFiles[0].Content, "AllowUsers tester\n") {
+		t.Errorf("Expected An sshd_config For The User's Port, Got:\n%s", initFile)
+	}
+	preset := NewPasswordCloudConfig("tester", password, "2222")
+	preset.Users[0].HashedPassword = hash
+	if !reflect.DeepEqual(cc, preset) {
+		t.Errorf("Expected generateCloudInit To Use The Password Preset")
+	}
+	if _, err = generateCloudInit(NewAuth("tester", "token", "", "", "22")); err == nil {
+		t.Errorf("Expected An Unsupported Auth Type To Fail")
+	}
+	fmt.Println("<-----------testCloudConfigPasswordPreset COMPLETE")
+}
+
+// testCloudConfigCreateContainer
+func testCloudConfigCreateContainer(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testCloudConfigCreateContainer...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("reading the launch config needs the FakeBackend")
+	}
+	cAuth := NewAuth("tester", AuthPassword, "l0lThis1sAWeak1", "", "22")
+	cc := NewPasswordCloudConfig(cAuth.User, cAuth.Credential, cAuth.Port)
+	cc.Packages = []string{"nginx"}
+	initFile, err := cc.Marshal()
+	if err != nil {
+		t.Fatalf("Error Marshalling Cloud Config: %v", err)
+	}
+	if err = goCluster.CreateContainer(cAuth, false, "CloudConfigTest", "ubuntu", "focal", initFile); err != nil {
+		t.Fatalf("Error Creating Cloud Config Container: %v", err)
+	}
+	defer goCluster.DeleteContainer("CloudConfigTest")
+	loaded, err := LoadCloudConfig([]byte(fake.Containers["CloudConfigTest"].Config["user.user-data"]))
+	if err != nil || !reflect.DeepEqual(cc, loaded) {
+		t.Errorf("Expected The Container's User Data To Be The Cloud Config: %v", err)
+	}
+	fmt.Println("<-----------testCloudConfigCreateContainer COMPLETE")
+}
+
+// testCloudInitResultJSON is a result.json of a cloud-init run where two modules failed
+const testCloudInitResultJSON = `{
+ "v1": {
+  "datasource": "DataSourceNoCloud [seed=/var/lib/cloud/seed/nocloud-net][dsmode=net]",
+  "errors": [
+   "('users-groups', KeyError('tester'))",
+   "('scripts-user', RuntimeError('Runparts: 1 failures in 1 attempted commands'))"
+  ]
+ }
+}`
+
+// testCloudInitOutput is a cloud-init-output.log of a cloud-init run where two modules failed
+const testCloudInitOutput = `Cloud-init v. 21.1 running 'modules:config' at Sun, 18 Apr 2021 12:00:00 +0000.
+2021-04-18 12:00:01,000 - util.py[WARNING]: Failed to run module users-groups (users-groups in config)
+2021-04-18 12:00:05,000 - cc_scripts_user.py[WARNING]: Failed to run module scripts-user (scripts in /var/lib/cloud/instance/scripts)
+2021-04-18 12:00:06,000 - util.py[WARNING]: Failed to run module apt-configure (apt-configure in config)
+`
+
+// TestCloudInitResult
+func TestCloudInitResult(t *testing.T) {
+	t.Run("Parse", testCloudInitResultParse)
+	t.Run("CreateWaits", testCloudInitResultCreateWaits)
+}
+
+// testCloudInitResultParse
+func testCloudInitResultParse(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testCloudInitResultParse...")
+	result, err := loadCloudInitResult([]byte("...\nstatus: error\n"), []byte(testCloudInitResultJSON), []byte(testCloudInitOutput))
+	if err != nil {
+		t.Fatalf("Error Loading Cloud Init Result: %v", err)
+	}
+	expected := []CloudInitModuleError{
+		{"users-groups", "KeyError('tester')"},
+		{"scripts-user", "RuntimeError('Runparts: 1 failures in 1 attempted commands')"},
+		{"apt-configure", "2021-04-18 12:00:06,000 - util.py[WARNING]: Failed to run module apt-configure (apt-configure in config)"},
+	}
+	if result.Status != "error" || !strings.HasPrefix(result.Datasource, "DataSourceNoCloud") || !reflect.DeepEqual(result.Errors, expected) {
+		t.Errorf("Unexpected Cloud Init Result: %+v", result)
+	}
+	if !result.Failed() || !strings.Contains(result.Err().Error(), "users-groups: KeyError('tester')") {
+		t.Errorf("Expected The Result To Fail With Its Module Errors, Got %v", result.Err())
+	}
+	result, err = loadCloudInitResult([]byte("status: done\n"), []byte(`{"v1": {"datasource": "DataSourceNoCloud", "errors": []}}`), []byte{})
+	if err != nil || result.Failed() || result.Err() != nil {
+		t.Errorf("Expected A Successful Result, Got %+v %v", result, err)
+	}
+	if _, err = loadCloudInitResult([]byte("status: done\n"), []byte("{"), []byte{}); err == nil {
+		t.Errorf("Expected A Malformed result.json To Fail")
+	}
+	fmt.Println("<-----------testCloudInitResultParse COMPLETE")
+}
+
+// testCloudInitResultCreateWaits
+func testCloudInitResultCreateWaits(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testCloudInitResultCreateWaits...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("failing cloud-init needs the FakeBackend")
+	}
+	WaitForCloudInit = true
+	defer func() { WaitForCloudInit = false }()
+	cAuth := NewAuth("tester", AuthPassword, "l0lThis1sAWeak1", "", "22")
+	if err := goCluster.CreateContainer(cAuth, false, "CloudInitDone", "ubuntu", "focal", []byte{}); err != nil {
+		t.Fatalf("Error Creating Cloud Init Container: %v", err)
+	}
+	defer goCluster.DeleteContainer("CloudInitDone")
+	goCon := goCluster.Containers[len(goCluster.Containers)-1]
+	if goCon.CloudInit == nil || goCon.CloudInit.Status != "done" || goCon.CloudInit.Failed() {
+		t.Errorf("Expected cloud-init To Be Done, Got %+v", goCon.CloudInit)
+	}
+	fake.Commands["cloud-init"] = func(con *FakeContainer, user string, args []string) ([]byte, []byte, int) {
+		con.Files[cloudInitResultFile] = []byte(testCloudInitResultJSON)
+		con.Files[cloudInitOutputFile] = []byte(testCloudInitOutput)
+		return fakeCloudInit(con, user, args)
+	}
+	err := goCluster.CreateContainer(cAuth, false, "CloudInitFailed", "ubuntu", "focal", []byte{})
+	defer fake.Delete(context.Background(), "CloudInitFailed")
+	if !errors.Is(err, ErrCloudInitFailed) || !strings.Contains(err.Error(), "users-groups") {
+		t.Errorf("Expected ErrCloudInitFailed Naming The Failed Module, Got %v", err)
+	}
+	fmt.Println("<-----------testCloudInitResultCreateWaits COMPLETE")
+}
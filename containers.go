@@ -13,13 +13,17 @@ Copyright 2021 John Connor Sanders
 package containers
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
-	"log"
+	"io"
+	"io/ioutil"
+	"net"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -79,23 +83,55 @@ func (n *Network) LoadEntry(nw *NetworkEntry) error {
 
 // SSHClient stores a pointer to a GoContainer ssh.Client
 type SSHClient struct {
-	SSHConn *ssh.Client
+	SSHConn    *ssh.Client
+	sftpMu     sync.Mutex
+	sftpClient *sftp.Client
+	forwardMu  sync.Mutex
+	forwards   []*Forward
 }
 
 // newSSHClient
 func newSSHClient(c *ssh.Client) *SSHClient {
-	return &SSHClient{c}
+	return &SSHClient{SSHConn: c}
 }
 
-// Close wil close an open Container SSHClient
-func (ssh *SSHClient) Close() error {
-	err := ssh.SSHConn.Close()
+// dialSSH connects to an ssh server at addr, abandoning the dial and handshake once ctx is done
+func dialSSH(ctx context.Context, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	var dialer net.Dialer
+	nConn, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 92: ", err.Error())
-		log.Fatal(err.Error())
-		return err
+		return nil, err
+	}
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = nConn.Close()
+		case <-stop:
+		}
+	}()
+	c, chans, reqs, err := ssh.NewClientConn(nConn, addr, config)
+	close(stop)
+	if err != nil {
+		_ = nConn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
 	}
-	return nil
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// Close wil close an open Container SSHClient
+func (ssh *SSHClient) Close() error {
+	ssh.closeForwards()
+	ssh.sftpMu.Lock()
+	if ssh.sftpClient != nil {
+		_ = ssh.sftpClient.Close()
+		ssh.sftpClient = nil
+	}
+	ssh.sftpMu.Unlock()
+	return ssh.SSHConn.Close()
 }
 
 // GoSnapshot represents a GoContainer's snapshot
@@ -120,6 +156,21 @@ type GoImage struct {
 	TarMeta     []string
 	Contents    [][]byte
 	DateTime    string
+	Size        int64
+	Verified    string
+	Format      ImageFormat
+	Compression ImageCompression
+	Rootfs      ImageCompression
+	Signature   *ImageSignature
+	Policy      *SignaturePolicy
+	Keys        KeyProvider
+	Aliases     []string
+	Properties  map[string]string
+	Public      bool
+	AutoUpdate  bool
+	Cached      bool
+	LastUsed    string
+	backend     Backend
 }
 
 // NewGoImage loads a new GoImage
@@ -134,102 +185,189 @@ func NewGoImage(name string, iType string, fingerprint string, dt string) *GoIma
 	}
 }
 
-// shellCMD executes a unix shell GoImage Cmd
-func (im *GoImage) shellCMD(cmdStr string) ([][]byte, error) {
-	return SHELL(im.Name, im.Type, cmdStr)
+// getBackend returns the GoImage's backend, defaulting to the DefaultDriver
+func (im *GoImage) getBackend() Backend {
+	if im.backend == nil {
+		im.backend = NewBackend(DefaultDriver)
+	}
+	return im.backend
 }
 
-// loadNewOutput
-func (im *GoImage) loadNewOutput(out []byte) {
-	im.Fingerprint = "unknown"
-	if bytes.Contains(out, []byte(" fingerprint: ")) {
-		sOut := bytes.Split(out, []byte(" fingerprint: "))[1]
-		sOut = bytes.Trim(sOut, "\n")
-		im.Fingerprint = string(sOut)
-	}
+// SetBackend sets the Backend a GoImage uses to talk to LXD
+func (im *GoImage) SetBackend(b Backend) {
+	im.backend = b
 }
 
 // Import a GoImage
 func (im *GoImage) Import() error {
-	cmdStr := `lxc image import `
-	var importFiles []string
-	jobId, err := createJobDirectory("imports")
+	return im.ImportContext(context.Background())
+}
+
+// ImportContext is like Import but returns ctx.Err() once ctx is done
+func (im *GoImage) ImportContext(ctx context.Context) error {
+	metadata, rootfs, err := im.importParts()
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 156: ", err.Error())
-		log.Fatal(err.Error())
-		return err
+		return &OpError{"import image", im.Name, nil, err}
+	}
+	_, err = im.ImportFromContext(ctx, metadata, rootfs)
+	return err
+}
+
+// ImportFrom streams a unified image tarball, or a split image's metadata and rootfs, into LXD as the GoImage
+// and returns its fingerprint, a nil rootfs is a unified image. When the GoImage has a Size or Fingerprint the
+// content must match them, or the import is aborted with ErrImageMismatch. A GoImage its SignaturePolicy refuses
+// fails with ErrImageSignature before anything is sent. The Format, Compression, Rootfs and a virtual machine Type
+// are detected from the content
+func (im *GoImage) ImportFrom(metadata io.Reader, rootfs io.Reader) (string, error) {
+	return im.ImportFromContext(context.Background(), metadata, rootfs)
+}
+
+// ImportFromContext is like ImportFrom but returns ctx.Err() once ctx is done
+func (im *GoImage) ImportFromContext(ctx context.Context, metadata io.Reader, rootfs io.Reader) (string, error) {
+	if err := im.policy().Verify(im); err != nil {
+		return "", &OpError{"import image", im.Name, ErrImageSignature, err}
+	}
+	format := ImageUnified
+	if rootfs != nil {
+		format = ImageSplit
 	}
-	pwd, err := os.Getwd()
+	if im.Format != "" && im.Format != format {
+		return "", &OpError{"import image", im.Name, nil, fmt.Errorf("cannot import a %s image as a %s image", im.Format, format)}
+	}
+	var archives []*archiveReader
+	metadata, archives, err := im.decryptPart(metadata, archives)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 162: ", err.Error())
-		log.Fatal(err.Error())
-		return err
+		return "", &OpError{"import image", im.Name, ErrImageEncryption, err}
 	}
-	importDir := pwd + `/imports/` + jobId
-	for ind, fName := range im.TarMeta {
-		iName := importDir + "/" + fName
-		fContents := im.Contents[ind]
-		err = createFile(iName, fContents)
-		if err != nil {
-			fmt.Println("ERROR: containers.go, line 172: ", err.Error())
-			log.Fatal(err.Error())
-			return err
+	if rootfs != nil {
+		if rootfs, archives, err = im.decryptPart(rootfs, archives); err != nil {
+			return "", &OpError{"import image", im.Name, ErrImageEncryption, err}
 		}
-		importFiles = append(importFiles, iName)
 	}
-	cmdStr = cmdStr + importFiles[0] + ` --alias ` + im.Name
-	_, err = im.shellCMD(cmdStr)
-	if err != nil {
-		fmt.Println("ERROR: containers.go, line 281: ", err.Error())
-		log.Fatal(err.Error())
-		return err
+	check := newImageCheck(im.Size, im.Fingerprint)
+	metaCompression, metadata := sniffImageCompression(metadata)
+	metadata = check.reader(metadata, rootfs == nil)
+	var rootfsCompression ImageCompression
+	if rootfs != nil {
+		rootfsCompression, rootfs = sniffImageCompression(rootfs)
+		rootfs = check.reader(rootfs, true)
+	}
+	im.Verified = ""
+	fingerprint, err := im.getBackend().ImportImage(ctx, metadata, rootfs, im.Name)
+	for _, archive := range archives {
+		if archiveErr := archive.failed(); archiveErr != nil {
+			return "", &OpError{"import image", im.Name, ErrImageEncryption, archiveErr}
+		}
 	}
-	err = deleteJobDirectory("imports", jobId)
-	if err != nil {
-		fmt.Println("ERROR: containers.go, line 187: ", err.Error())
-		log.Fatal(err.Error())
-		return err
+	if checkErr := check.failed(); checkErr != nil {
+		return "", &OpError{"import image", im.Name, ErrImageMismatch, checkErr}
+	} else if err != nil {
+		return "", newOpError("import image", im.Name, err, nil)
 	}
-	return nil
+	if fingerprint != check.fingerprint() {
+		if isFingerprint(fingerprint) {
+			_ = im.getBackend().DeleteImage(ctx, fingerprint)
+		}
+		return "", &OpError{"import image", im.Name, ErrImageMismatch, fmt.Errorf("lxd imported %q, but %s was sent", fingerprint, check.fingerprint())}
+	}
+	im.Fingerprint = fingerprint
+	im.Verified = fingerprint
+	im.Size = check.size
+	im.setFormat(format, metaCompression, rootfsCompression)
+	return fingerprint, nil
 }
 
-// Export a GoImage
+// Export a GoImage into its TarMeta and Contents, use ExportTo or ExportParts to stream large images instead
 func (im *GoImage) Export() error {
-	cmdStr := `lxc image export ` + im.Name
-	jobId, err := createJobDirectory("exports")
-	if err != nil {
-		fmt.Println("ERROR: containers.go, line 193: ", err.Error())
-		log.Fatal(err.Error())
-		return err
-	}
-	pwd, err := os.Getwd()
-	if err != nil {
-		fmt.Println("ERROR: containers.go, line 199: ", err.Error())
-		log.Fatal(err.Error())
+	return im.ExportContext(context.Background())
+}
+
+// ExportContext is like Export but returns ctx.Err() once ctx is done
+func (im *GoImage) ExportContext(ctx context.Context) error {
+	var tarMeta []string
+	var contents [][]byte
+	err := im.ExportPartsContext(ctx, func(fileName string, r io.Reader) error {
+		fContents, err := ioutil.ReadAll(r)
+		tarMeta = append(tarMeta, fileName)
+		contents = append(contents, fContents)
 		return err
-	}
-	exportDir := pwd + `/exports/` + jobId
-	cmdStr = cmdStr + ` ` + exportDir
-	_, err = im.shellCMD(cmdStr)
+	})
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 207: ", err.Error())
-		log.Fatal(err.Error())
 		return err
 	}
-	jobContents, jobMeta, err := scanJobDirectory("exports", jobId)
-	if err != nil {
-		fmt.Println("ERROR: containers.go, line 213: ", err.Error())
-		log.Fatal(err.Error())
+	im.TarMeta = tarMeta
+	im.Contents = contents
+	return nil
+}
+
+// ExportParts streams each file of a GoImage to part in turn, the metadata of a split image ahead of its rootfs
+func (im *GoImage) ExportParts(part ImagePartFunc) error {
+	return im.ExportPartsContext(context.Background(), part)
+}
+
+// ExportPartsContext is like ExportParts but returns ctx.Err() once ctx is done
+func (im *GoImage) ExportPartsContext(ctx context.Context, part ImagePartFunc) error {
+	return im.exportParts(ctx, part)
+}
+
+// ExportTo streams a unified GoImage's tarball to w, a split GoImage fails with ErrSplitImage
+func (im *GoImage) ExportTo(w io.Writer) error {
+	return im.ExportToContext(context.Background(), w)
+}
+
+// ExportToContext is like ExportTo but returns ctx.Err() once ctx is done
+func (im *GoImage) ExportToContext(ctx context.Context, w io.Writer) error {
+	return im.exportParts(ctx, func(fileName string, r io.Reader) error {
+		if strings.HasPrefix(fileName, "meta-") {
+			return ErrSplitImage
+		}
+		_, err := io.Copy(w, r)
 		return err
+	})
+}
+
+// exportParts streams each file of a GoImage to part while hashing them, and fails with ErrImageMismatch once
+// the whole image is read when its SHA-256 fingerprint does not match the GoImage's Fingerprint
+func (im *GoImage) exportParts(ctx context.Context, part ImagePartFunc) error {
+	var fileNames []string
+	check := newImageCheck(0, "")
+	keys := im.keys()
+	if keys != nil {
+		if err := im.checkStaging(); err != nil {
+			return &OpError{"export image", im.Name, ErrImageEncryption, err}
+		}
 	}
-	im.TarMeta = jobMeta
-	im.Contents = jobContents
-	err = deleteJobDirectory("exports", jobId)
-	if err != nil {
-		fmt.Println("ERROR: containers.go, line 221: ", err.Error())
-		log.Fatal(err.Error())
+	im.Verified = ""
+	err := im.getBackend().ExportImage(ctx, im.Name, func(fileName string, r io.Reader) error {
+		fileNames = append(fileNames, fileName)
+		r = check.reader(r, false)
+		archive, archiveName := r, fileName
+		if keys != nil {
+			encrypted, err := encryptArchive(r, keys)
+			if err != nil {
+				return &OpError{"export image", im.Name, ErrImageEncryption, err}
+			}
+			archive, archiveName = encrypted, fileName+encryptedExt
+		}
+		if err := part(archiveName, archive); err != nil {
+			return err
+		}
+		_, err := io.Copy(ioutil.Discard, r)
 		return err
-	}
+	})
+	if err == ErrSplitImage {
+		return &OpError{"export image", im.Name, ErrSplitImage, ErrSplitImage}
+	} else if err != nil {
+		return newOpError("export image", im.Name, err, ErrImageNotFound)
+	}
+	fingerprint := check.fingerprint()
+	if im.Fingerprint != "" && !strings.HasPrefix(fingerprint, strings.ToLower(im.Fingerprint)) {
+		return &OpError{"export image", im.Name, ErrImageMismatch, fmt.Errorf("image fingerprint is %s, expected %s", fingerprint, im.Fingerprint)}
+	}
+	im.Fingerprint = fingerprint
+	im.Verified = fingerprint
+	im.Size = check.size
+	im.setFormatOf(fileNames)
 	return nil
 }
 
@@ -247,13 +385,17 @@ type GoContainer struct {
 	Auth        *Auth
 	GoSnapshots []*GoSnapshot
 	Status      string
+	CloudInit   *CloudInitResult
+	Keys        KeyProvider
+	Remote      string
+	backend     Backend
 }
 
 // NewGoContainer creates a pointer to a new GoContainer
 func NewGoContainer(name string, controller bool, cType string, release string, services []string, initFile []byte, storage string, network *Network, auth *Auth) *GoContainer {
 	var goSnaps []*GoSnapshot
-	if len(initFile) == 0 && auth.Type == "password" {
-		initFile = generateCloudInit(auth)
+	if len(initFile) == 0 && auth != nil {
+		initFile, _ = generateCloudInit(auth)
 	}
 	return &GoContainer{
 		name,
@@ -268,194 +410,241 @@ func NewGoContainer(name string, controller bool, cType string, release string,
 		auth,
 		goSnaps,
 		"Initializing",
+		nil,
+		nil,
+		"",
+		nil,
 	}
 }
 
 // OpenSSH begins an SSHClient session
 func (co *GoContainer) OpenSSH() error {
+	return co.OpenSSHContext(context.Background())
+}
+
+// OpenSSHContext is like OpenSSH but returns ctx.Err() once ctx is done
+func (co *GoContainer) OpenSSHContext(ctx context.Context) error {
 	var conn *ssh.Client
 	var err error
-	if co.Auth.Type == "" {
-		err = errors.New("error containers.go: No GoContainer Auth Profile has been set for SSH")
-		fmt.Println("ERROR: containers.go, line 272: ", err.Error())
-		log.Fatal(err.Error())
-		return err
-	} else if co.Auth.Credential == "" {
-		err = errors.New("error containers.go: No GoContainer Auth Credential has been set for SSH")
-		fmt.Println("ERROR: containers.go, line 277: ", err.Error())
-		log.Fatal(err.Error())
-		return err
-	} else if co.Auth.User == "" {
-		err = errors.New("error containers.go: No GoContainer Auth User has been set for SSH")
-		fmt.Println("ERROR: containers.go, line 282: ", err.Error())
-		log.Fatal(err.Error())
-		return err
-	} else if co.Auth.Port == "" {
-		err = errors.New("error containers.go: No GoContainer Auth Port has been set for SSH")
-		fmt.Println("ERROR: containers.go, line 287: ", err.Error())
-		log.Fatal(err.Error())
-		return err
+	if co.Auth == nil {
+		return &OpError{"ssh", co.Name, ErrAuthIncomplete, errors.New("no GoContainer Auth Profile has been set for SSH")}
+	} else if err = co.Auth.validate(); err != nil {
+		return &OpError{"ssh", co.Name, ErrAuthIncomplete, err}
+	}
+	authMethods, authCloser, err := co.Auth.authMethods()
+	if err != nil {
+		return &OpError{"ssh", co.Name, ErrAuthIncomplete, err}
 	}
-	sshKeygenCMD := `ssh-keygen -R `
-	if co.Auth.Port != "22" {
-		sshKeygenCMD = sshKeygenCMD + `[` + co.Network.PrivateIP + `]:` + co.Auth.Port
-	} else {
-		sshKeygenCMD = sshKeygenCMD + co.Network.PrivateIP
+	if authCloser != nil {
+		defer authCloser.Close()
 	}
-	_, _, _ = BASH(sshKeygenCMD)
+	hostKeys, err := getHostKeys(co.Name)
+	if err != nil {
+		return newOpError("ssh", co.Name, err, nil)
+	} else if len(hostKeys) == 0 {
+		if hostKeys, err = co.captureHostKeys(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return &OpError{"ssh", co.Name, ErrHostKeyUnknown, err}
+		}
+	}
+	checker := &hostKeyChecker{co.Name, hostKeys, nil}
 	//TODO - Add Functionality to do Private or Public based on IP Type
 	addr := co.Network.PrivateIP + ":" + co.Auth.Port
 	config := &ssh.ClientConfig{
-		User: co.Auth.User,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(co.Auth.Credential),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		User:            co.Auth.User,
+		Auth:            authMethods,
+		HostKeyCallback: checker.check,
 	}
-	conn, err = ssh.Dial("tcp", addr, config)
-	if err != nil {
-		nErr := errors.New("failed to ssh into container: " + err.Error())
-		fmt.Println("ERROR: containers.go, line 302: ", nErr.Error())
-		log.Fatal(nErr.Error())
-		return nErr
+	conn, err = dialSSH(ctx, addr, config)
+	if err != nil && checker.err != nil {
+		return &OpError{"ssh", co.Name, ErrHostKeyMismatch, checker.err}
+	} else if err != nil {
+		return newOpError("ssh", co.Name, err, nil)
 	}
 	co.SSHClient = newSSHClient(conn)
 	return nil
 }
 
-// shellCMD executes a unix shell Cmd
-func (co *GoContainer) shellCMD(cmdStr string) ([][]byte, error) {
-	return SHELL(co.Name, co.Type, cmdStr)
+// getBackend returns the GoContainer's backend, defaulting to the DefaultDriver
+func (co *GoContainer) getBackend() Backend {
+	if co.backend == nil {
+		co.backend = NewBackend(DefaultDriver)
+	}
+	return co.backend
 }
 
+// SetBackend sets the Backend a GoContainer uses to talk to LXD
+func (co *GoContainer) SetBackend(b Backend) {
+	co.backend = b
+}
+
+// pollInterval is how long a GoContainer waits between boot and network lease checks
+var pollInterval = 5 * time.Second
+
 // ensure that a container is done booting before continuing
-func (co *GoContainer) ensure() error {
+func (co *GoContainer) ensure(ctx context.Context) error {
 	chkCmd := `systemctl is-system-running`
 	for i := 0; i < 36; i++ {
-		out, err := co.CMD(chkCmd, "", false)
+		out, err := co.CMDContext(ctx, chkCmd, "", false)
 		if err != nil {
-			fmt.Println("ERROR: containers.go, line 322: ", err.Error())
-			log.Fatal(err.Error())
-			return err
+			return newOpError("boot", co.Name, err, ErrContainerNotFound)
 		}
 		if strings.Contains(string(out), "running") {
 			return nil
 		} else if strings.Contains(string(out), "degraded") {
 			resetCmd := `systemctl reset-failed`
-			_, _ = co.CMD(resetCmd, "", false)
+			_, _ = co.CMDContext(ctx, resetCmd, "", false)
+		}
+		if err := sleepContext(ctx, pollInterval); err != nil {
+			return err
 		}
-		time.Sleep(5 * time.Second)
 	}
-	errStr := "Error: in containers.go, line 321: " + co.Name + " is not starting in a timely manner!"
-	fmt.Println(errStr)
-	return errors.New(errStr)
+	return &OpError{"boot", co.Name, ErrBootTimeout, ErrBootTimeout}
 }
 
 // CMD executes a command on a GoContainer
 func (co *GoContainer) CMD(cmd string, userName string, reErr bool) ([]byte, error) {
-	cmdStr := `lxc exec ` + co.Name + ` `
-	xFlag := 0
+	return co.CMDContext(context.Background(), cmd, userName, reErr)
+}
+
+// CMDContext is like CMD but returns ctx.Err() once ctx is done
+func (co *GoContainer) CMDContext(ctx context.Context, cmd string, userName string, reErr bool) ([]byte, error) {
+	argv := []string{"sh", "-c", cmd}
 	if userName != "" {
-		cmdStr = cmdStr + ` -- sudo --login --user ` + userName + ` bash -ilc "`
-		xFlag = 1
+		argv = []string{"sudo", "--login", "--user", userName, "bash", "-ilc", cmd}
 	} else if strings.Contains(cmd, " && ") || strings.Contains(cmd, " ; ") {
-		cmdStr = cmdStr + ` -- sudo bash -ilc "`
-		xFlag = 1
+		argv = []string{"sudo", "bash", "-ilc", cmd}
 	}
-	cmdStr = cmdStr + cmd
-	if xFlag == 1 {
-		cmdStr = cmdStr + `"`
+	out, errOut, err := co.getBackend().Exec(ctx, co.Name, argv)
+	var cmdErr *CommandError
+	if err != nil && (reErr || !errors.As(err, &cmdErr)) {
+		return out, newOpError("exec", co.Name, err, ErrContainerNotFound)
 	}
-	out, errOut, err := BASH(cmdStr)
-	if err != nil {
-		if reErr {
-			fmt.Println("ERROR: containers.go, line 356: ", err.Error())
-			log.Fatal(err.Error())
-			return []byte{}, err
-		}
-	}
-	if string(errOut) != "" {
-		if reErr {
-			return out, errors.New(string(errOut))
-		}
+	if string(errOut) != "" && reErr {
+		cmdErr = &CommandError{argv, 0, strings.TrimSpace(string(errOut)), errors.New("wrote to stderr")}
+		return out, newOpError("exec", co.Name, cmdErr, nil)
 	}
 	return out, nil
 }
 
+// PushFile writes the file fPath inside a running GoContainer from r with mode, creating its parent directories
+func (co *GoContainer) PushFile(fPath string, r io.Reader, mode os.FileMode) error {
+	return co.PushFileContext(context.Background(), fPath, r, mode)
+}
+
+// PushFileContext is like PushFile but returns ctx.Err() once ctx is done
+func (co *GoContainer) PushFileContext(ctx context.Context, fPath string, r io.Reader, mode os.FileMode) error {
+	err := co.getBackend().PushFile(ctx, co.Name, fPath, r, mode)
+	return newOpError("push file", co.Name+fPath, err, ErrContainerNotFound)
+}
+
 // Create a new GoContainer
 func (co *GoContainer) Create() error {
-	cmdStr := `lxc launch images:` + co.Type + `/` + co.Release + `/amd64 ` + co.Name
+	return co.CreateContext(context.Background())
+}
+
+// CreateContext is like Create but returns ctx.Err() once ctx is done
+func (co *GoContainer) CreateContext(ctx context.Context) error {
+	remote := co.Remote
+	if remote == "" {
+		remote = DefaultImageRemote
+	}
+	alias := co.Type + `/` + co.Release + `/amd64`
+	config := map[string]string{}
+	if len(co.InitFile) == 0 && co.Auth != nil {
+		initFile, err := generateCloudInit(co.Auth)
+		if err != nil {
+			return &OpError{"create", co.Name, ErrAuthIncomplete, err}
+		}
+		co.InitFile = initFile
+	}
 	if len(co.InitFile) != 0 {
-		cmdStr = `lxc launch ` + co.Type + `: ` + co.Name + ` --config=user.user-data=$("` + string(co.InitFile) + `")$`
+		if remote == "" {
+			remote, alias = co.Type, ""
+		}
+		config["user.user-data"] = cloudInitUserData(co.InitFile)
 	}
-	_, err := co.shellCMD(cmdStr)
-	if err != nil {
-		fmt.Println("ERROR: containers.go, line 378: ", err.Error())
-		log.Fatal(err.Error())
-		return err
+	if remote == "" {
+		remote = "images"
 	}
-	err = co.ensure()
+	err := co.getBackend().Launch(ctx, co.Name, remote, alias, config)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 384: ", err.Error())
-		log.Fatal(err.Error())
+		return newOpError("create", co.Name, err, ErrImageNotFound)
+	}
+	if err = co.ensure(ctx); err != nil {
 		return err
 	}
+	if WaitForCloudInit && len(co.InitFile) != 0 {
+		result, err := co.WaitCloudInitContext(ctx)
+		if err != nil {
+			return err
+		} else if result.Failed() {
+			return &OpError{"create", co.Name, ErrCloudInitFailed, result.Err()}
+		}
+	}
+	co.trustHostKeys(ctx)
 	return nil
 }
 
+// trustHostKeys replaces any host keys known for a new GoContainer's name with its own, if it has any yet,
+// those left unknown are read on its first OpenSSH instead
+func (co *GoContainer) trustHostKeys(ctx context.Context) {
+	if _, err := co.captureHostKeys(ctx); err != nil {
+		_ = setHostKeys(co.Name, nil)
+	}
+}
+
 // Stop shutdowns a GoContainer
 func (co *GoContainer) Stop() error {
-	stopCmdStr := `lxc stop ` + co.Name
-	_, err := co.shellCMD(stopCmdStr)
-	if err != nil {
-		fmt.Println("ERROR: containers.go, line 397: ", err.Error())
-		log.Fatal(err.Error())
-		return err
-	}
-	return nil
+	return co.StopContext(context.Background())
+}
+
+// StopContext is like Stop but returns ctx.Err() once ctx is done
+func (co *GoContainer) StopContext(ctx context.Context) error {
+	err := co.getBackend().Stop(ctx, co.Name)
+	return newOpError("stop", co.Name, err, ErrContainerNotFound)
 }
 
 // Boot boots an offline GoContainer
 func (co *GoContainer) Boot() error {
-	stopCmdStr := `lxc start ` + co.Name
-	_, err := co.shellCMD(stopCmdStr)
-	if err != nil {
-		fmt.Println("ERROR: containers.go, line 397: ", err.Error())
-		log.Fatal(err.Error())
-		return err
-	}
-	return nil
+	return co.BootContext(context.Background())
+}
+
+// BootContext is like Boot but returns ctx.Err() once ctx is done
+func (co *GoContainer) BootContext(ctx context.Context) error {
+	err := co.getBackend().Start(ctx, co.Name)
+	return newOpError("start", co.Name, err, ErrContainerNotFound)
 }
 
 // Reboot Stops then Boots an online GoContainer
 func (co *GoContainer) Reboot() error {
-	stopCmdStr := `lxc restart ` + co.Name
-	_, err := co.shellCMD(stopCmdStr)
-	if err != nil {
-		fmt.Println("ERROR: containers.go, line 397: ", err.Error())
-		log.Fatal(err.Error())
-		return err
-	}
-	return nil
+	return co.RebootContext(context.Background())
+}
+
+// RebootContext is like Reboot but returns ctx.Err() once ctx is done
+func (co *GoContainer) RebootContext(ctx context.Context) error {
+	err := co.getBackend().Restart(ctx, co.Name)
+	return newOpError("restart", co.Name, err, ErrContainerNotFound)
 }
 
 // Delete an existing GoContainer from the GoCluster
 func (co *GoContainer) Delete() error {
-	stopCmdStr := `lxc stop ` + co.Name
-	delCmdStr := `lxc delete ` + co.Name
-	_, err := co.shellCMD(stopCmdStr)
+	return co.DeleteContext(context.Background())
+}
+
+// DeleteContext is like Delete but returns ctx.Err() once ctx is done
+func (co *GoContainer) DeleteContext(ctx context.Context) error {
+	err := co.getBackend().Stop(ctx, co.Name)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 397: ", err.Error())
-		log.Fatal(err.Error())
-		return err
+		return newOpError("delete", co.Name, err, ErrContainerNotFound)
 	}
-	_, err = co.shellCMD(delCmdStr)
+	err = co.getBackend().Delete(ctx, co.Name)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 403: ", err.Error())
-		log.Fatal(err.Error())
-		return err
+		return newOpError("delete", co.Name, err, ErrContainerNotFound)
 	}
-	return nil
+	return newOpError("delete", co.Name, setHostKeys(co.Name, nil), nil)
 }
 
 // checkSnapshots
@@ -469,26 +658,17 @@ func (co *GoContainer) checkSnapshots(newSnap *GoSnapshot) bool {
 }
 
 // loadSnapshots
-func (co *GoContainer) loadSnapshots() error {
-	cmdStr := `lxc info ` + co.Name
-	oBytes, err := co.shellCMD(cmdStr)
+func (co *GoContainer) loadSnapshots(ctx context.Context) error {
+	snapNames, err := co.getBackend().Snapshots(ctx, co.Name)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 425: ", err.Error())
-		log.Fatal(err.Error())
-		return err
-	}
-	if bytes.Contains(oBytes[0], []byte("Snapshots:\n")) {
-		outSnaps := bytes.Split(bytes.Split(oBytes[0], []byte("Snapshots:\n"))[1], []byte("\n"))
-		for _, outSnap := range outSnaps {
-			if bytes.Contains(outSnap, []byte("-snap-")) {
-				outSnap = bytes.Split(outSnap, []byte(" ("))[0]
-				outSnap = bytes.Replace(outSnap, []byte(" "), []byte(""), -1)
-				outSnap = bytes.Replace(outSnap, []byte("\t"), []byte(""), -1)
-				sSnap := bytes.Split(outSnap, []byte("-snap-"))
-				ss := NewGoSnapshot(string(outSnap), string(sSnap[1]))
-				if co.checkSnapshots(ss) {
-					co.GoSnapshots = append(co.GoSnapshots, ss)
-				}
+		return newOpError("list snapshots", co.Name, err, ErrContainerNotFound)
+	}
+	for _, snapName := range snapNames {
+		if strings.Contains(snapName, "-snap-") {
+			sSnap := strings.Split(snapName, "-snap-")
+			ss := NewGoSnapshot(snapName, sSnap[1])
+			if co.checkSnapshots(ss) {
+				co.GoSnapshots = append(co.GoSnapshots, ss)
 			}
 		}
 	}
@@ -497,15 +677,17 @@ func (co *GoContainer) loadSnapshots() error {
 
 // CreateSnapshot creates a new GoSnapshot off an existing GoContainer
 func (co *GoContainer) CreateSnapshot() (string, error) {
+	return co.CreateSnapshotContext(context.Background())
+}
+
+// CreateSnapshotContext is like CreateSnapshot but returns ctx.Err() once ctx is done
+func (co *GoContainer) CreateSnapshotContext(ctx context.Context) (string, error) {
 	ts := getTimeStamp()
 	snapName := co.Name + "-snap-" + ts
 	newSnap := NewGoSnapshot(snapName, ts)
-	cmdStr := `lxc snapshot ` + co.Name + ` ` + snapName
-	_, err := co.shellCMD(cmdStr)
+	err := co.getBackend().Snapshot(ctx, co.Name, snapName)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 455: ", err.Error())
-		log.Fatal(err.Error())
-		return snapName, err
+		return snapName, newOpError("snapshot", co.Name, err, ErrContainerNotFound)
 	}
 	co.GoSnapshots = append(co.GoSnapshots, newSnap)
 	return snapName, nil
@@ -513,22 +695,24 @@ func (co *GoContainer) CreateSnapshot() (string, error) {
 
 // DeleteSnapshot deletes a GoSnapshot
 func (co *GoContainer) DeleteSnapshot(snapName string) error {
-	cmdStr := `lxc delete ` + co.Name + `/` + snapName
-	_, err := co.shellCMD(cmdStr)
-	if err != nil {
-		fmt.Println("ERROR: containers.go, line 468: ", err.Error())
-		log.Fatal(err.Error())
-		return err
-	}
-	return nil
+	return co.DeleteSnapshotContext(context.Background(), snapName)
+}
+
+// DeleteSnapshotContext is like DeleteSnapshot but returns ctx.Err() once ctx is done
+func (co *GoContainer) DeleteSnapshotContext(ctx context.Context, snapName string) error {
+	err := co.getBackend().DeleteSnapshot(ctx, co.Name, snapName)
+	return newOpError("delete snapshot", co.Name+"/"+snapName, err, ErrSnapshotNotFound)
 }
 
 // GetSnapshots for all containers
 func (co *GoContainer) GetSnapshots() ([]*GoSnapshot, error) {
-	err := co.loadSnapshots()
+	return co.GetSnapshotsContext(context.Background())
+}
+
+// GetSnapshotsContext is like GetSnapshots but returns ctx.Err() once ctx is done
+func (co *GoContainer) GetSnapshotsContext(ctx context.Context) ([]*GoSnapshot, error) {
+	err := co.loadSnapshots(ctx)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 479: ", err.Error())
-		log.Fatal(err.Error())
 		return co.GoSnapshots, err
 	}
 	return co.GoSnapshots, nil
@@ -536,60 +720,83 @@ func (co *GoContainer) GetSnapshots() ([]*GoSnapshot, error) {
 
 // Restore a GoContainer from a snapshot
 func (co *GoContainer) Restore(snapName string) error {
-	cmdStr := `lxc restore ` + co.Name + ` ` + snapName
-	_, err := co.shellCMD(cmdStr)
-	if err != nil {
-		fmt.Println("ERROR: containers.go, line 491: ", err.Error())
-		log.Fatal(err.Error())
-		return err
-	}
-	return nil
+	return co.RestoreContext(context.Background(), snapName)
+}
+
+// RestoreContext is like Restore but returns ctx.Err() once ctx is done
+func (co *GoContainer) RestoreContext(ctx context.Context, snapName string) error {
+	err := co.getBackend().Restore(ctx, co.Name, snapName)
+	return newOpError("restore", co.Name+"/"+snapName, err, ErrSnapshotNotFound)
 }
 
 // Image of the GoContainer
 func (co *GoContainer) Image(snapShot string) (*GoImage, error) {
+	return co.ImageContext(context.Background(), snapShot)
+}
+
+// ImageContext is like Image but returns ctx.Err() once ctx is done
+func (co *GoContainer) ImageContext(ctx context.Context, snapShot string) (*GoImage, error) {
 	var reImg GoImage
 	ts := getTimeStamp()
 	imgName := co.Name + "-image-"
-	cmdStr := `lxc publish ` + co.Name
 	reImg.Type = "Container"
 	if snapShot != "" {
 		reImg.Type = "Snapshot"
-		cmdStr = cmdStr + `/` + snapShot
 		imgName = imgName + "-snap-"
 	}
 	imgName = imgName + ts
-	cmdStr = cmdStr + ` --alias ` + imgName
 	reImg.Name = imgName
-	out, err := co.shellCMD(cmdStr)
+	reImg.Keys = co.Keys
+	reImg.backend = co.getBackend()
+	fingerprint, err := reImg.backend.Publish(ctx, co.Name, snapShot, imgName)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 516: ", err.Error())
-		log.Fatal(err.Error())
-		return &reImg, err
+		notFound := ErrContainerNotFound
+		if snapShot != "" {
+			notFound = ErrSnapshotNotFound
+		}
+		return &reImg, newOpError("publish", co.Name, err, notFound)
 	}
-	reImg.loadNewOutput(out[0])
+	reImg.Fingerprint = fingerprint
 	return &reImg, nil
 }
 
 // Export a GoContainer from the GoCluster
 func (co *GoContainer) Export() (*GoImage, error) {
+	return co.ExportContext(context.Background())
+}
+
+// ExportContext is like Export but returns ctx.Err() once ctx is done
+func (co *GoContainer) ExportContext(ctx context.Context) (*GoImage, error) {
+	return co.export(ctx, func(exImage *GoImage) error {
+		return exImage.ExportContext(ctx)
+	})
+}
+
+// ExportTo streams a GoContainer's exported GoImage to w without loading its Contents
+func (co *GoContainer) ExportTo(w io.Writer) (*GoImage, error) {
+	return co.ExportToContext(context.Background(), w)
+}
+
+// ExportToContext is like ExportTo but returns ctx.Err() once ctx is done
+func (co *GoContainer) ExportToContext(ctx context.Context, w io.Writer) (*GoImage, error) {
+	return co.export(ctx, func(exImage *GoImage) error {
+		return exImage.ExportToContext(ctx, w)
+	})
+}
+
+// export snapshots a GoContainer, publishes the snapshot as a GoImage and exports it with exportImage
+func (co *GoContainer) export(ctx context.Context, exportImage func(*GoImage) error) (*GoImage, error) {
 	var exImage *GoImage
-	imageSnap, err := co.CreateSnapshot()
+	imageSnap, err := co.CreateSnapshotContext(ctx)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 529: ", err.Error())
-		log.Fatal(err.Error())
 		return exImage, err
 	}
-	exImage, err = co.Image(imageSnap)
+	exImage, err = co.ImageContext(ctx, imageSnap)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 535: ", err.Error())
-		log.Fatal(err.Error())
 		return exImage, err
 	}
-	err = exImage.Export()
+	err = exportImage(exImage)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 541: ", err.Error())
-		log.Fatal(err.Error())
 		return exImage, err
 	}
 	return exImage, nil
@@ -597,56 +804,44 @@ func (co *GoContainer) Export() (*GoImage, error) {
 
 // Import a GoContainer into the GoCluster
 func (co *GoContainer) Import(image *GoImage) error {
-	cmdStr := `lxc launch ` + image.Name + ` ` + co.Name
-	err := image.Import()
+	return co.ImportContext(context.Background(), image)
+}
+
+// ImportContext is like Import but returns ctx.Err() once ctx is done
+func (co *GoContainer) ImportContext(ctx context.Context, image *GoImage) error {
+	return co.importImage(ctx, image, image.ImportContext)
+}
+
+// importImage imports a GoImage into LXD with importImage and launches the GoContainer from it
+func (co *GoContainer) importImage(ctx context.Context, image *GoImage, importImage func(context.Context) error) error {
+	if image.backend == nil {
+		image.backend = co.getBackend()
+	}
+	err := importImage(ctx)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 553: ", err.Error())
-		log.Fatal(err.Error())
 		return err
 	}
-	_, err = co.shellCMD(cmdStr)
+	err = co.getBackend().Launch(ctx, co.Name, "", image.Name, map[string]string{})
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 559: ", err.Error())
-		log.Fatal(err.Error())
-		return err
+		return newOpError("create", co.Name, err, ErrImageNotFound)
 	}
+	co.trustHostKeys(ctx)
 	return nil
 }
 
 // loadNetworkData
-func (co *GoContainer) loadNetworkData(networkInt string) error {
-	cmdStr := `lxc network list-leases ` + networkInt + ` --format json`
-	oBytes, err := co.shellCMD(cmdStr)
-	if err != nil {
-		fmt.Println("ERROR: containers.go, line 571: ", err.Error())
-		log.Fatal(err.Error())
-		return err
-	}
-	if string(oBytes[0]) == "[RETRY]" {
-		time.Sleep(5 * time.Second)
-		oBytes, err = co.shellCMD(cmdStr)
-		if err != nil {
-			fmt.Println("ERROR: containers.go, line 579: ", err.Error())
-			log.Fatal(err.Error())
+func (co *GoContainer) loadNetworkData(ctx context.Context, networkInt string) error {
+	entries, err := co.getBackend().Leases(ctx, networkInt)
+	for i := 0; i < 2 && err == nil && len(entries) == 0; i++ {
+		if err = sleepContext(ctx, pollInterval); err != nil {
 			return err
-		} else {
-			if string(oBytes[0]) == "[RETRY]" {
-				time.Sleep(5 * time.Second)
-				oBytes, err = co.shellCMD(cmdStr)
-				if err != nil {
-					fmt.Println("ERROR: containers.go, line 587: ", err.Error())
-					log.Fatal(err.Error())
-					return err
-				}
-			}
 		}
+		entries, err = co.getBackend().Leases(ctx, networkInt)
 	}
-	nwOut, err := LoadNetworkOutput(string(oBytes[0]))
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 596: ", err.Error())
-		log.Fatal(err.Error())
-		return err
+		return newOpError("list leases", networkInt, err, nil)
 	}
+	nwOut := &NetworkOutput{NetworkEntries: entries}
 	network := nwOut.GetContainerEntry(co.Name)
 	co.Network = network
 	return nil
@@ -671,6 +866,10 @@ type GoCluster struct {
 	Containers   []*GoContainer
 	Images       []*GoImage
 	Network      *Network
+	Policy       *SignaturePolicy
+	Keys         KeyProvider
+	Store        ImageStore
+	backend      Backend
 }
 
 // NewGoCluster creates a pointer to a new GoCluster
@@ -686,40 +885,66 @@ func NewGoCluster(name string, cType string, reverseProxy string, loadBalancer s
 		containers,
 		imgs,
 		&Network{},
+		nil,
+		nil,
+		nil,
+		nil,
+	}
+}
+
+// getBackend returns the GoCluster's backend, defaulting to the DefaultDriver
+func (cu *GoCluster) getBackend() Backend {
+	if cu.backend == nil {
+		cu.backend = NewBackend(DefaultDriver)
 	}
+	return cu.backend
 }
 
-// shellCMD executes a unix shell Cmd
-func (cu *GoCluster) shellCMD(cmdStr string) ([][]byte, error) {
-	return SHELL(cu.Name, cu.Type, cmdStr)
+// SetBackend sets the Backend used by the GoCluster and its GoContainers and GoImages
+func (cu *GoCluster) SetBackend(b Backend) {
+	cu.backend = b
+	for _, con := range cu.Containers {
+		con.SetBackend(b)
+	}
+	for _, img := range cu.Images {
+		img.SetBackend(b)
+	}
+}
+
+// SetDriver selects the Driver used by the GoCluster and its GoContainers and GoImages
+func (cu *GoCluster) SetDriver(driver Driver) {
+	cu.SetBackend(NewBackend(driver))
 }
 
 // ScanImages from a GoCluster
 func (cu *GoCluster) ScanImages() ([]*GoImage, error) {
-	cmdStr := `lxc image list --format json`
-	oBytes, err := cu.shellCMD(cmdStr)
+	return cu.ScanImagesContext(context.Background())
+}
+
+// ScanImagesContext is like ScanImages but returns ctx.Err() once ctx is done
+func (cu *GoCluster) ScanImagesContext(ctx context.Context) ([]*GoImage, error) {
+	imgOuts, err := cu.getBackend().Images(ctx)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 652: ", err.Error())
-		log.Fatal(err.Error())
-		return cu.Images, err
+		return cu.Images, newOpError("list images", cu.Name, err, nil)
 	}
-	outImgs := LoadImagesOutput(string(oBytes[0]))
-	cu.Images = outImgs.GetImages()
+	outImgs := &ImagesOutput{Outputs: imgOuts}
+	cu.Images = outImgs.goImages(cu.getBackend())
 	return cu.Images, nil
 }
 
 // CreateImage an image of a GoCluster's GoContainer
 func (cu *GoCluster) CreateImage(cName string, sName string) error {
-	container, err := cu.GetContainer(cName)
+	return cu.CreateImageContext(context.Background(), cName, sName)
+}
+
+// CreateImageContext is like CreateImage but returns ctx.Err() once ctx is done
+func (cu *GoCluster) CreateImageContext(ctx context.Context, cName string, sName string) error {
+	container, err := cu.GetContainerContext(ctx, cName)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 665: ", err.Error())
-		log.Fatal(err.Error())
 		return err
 	}
-	exImage, err := container.Image(sName)
+	exImage, err := container.ImageContext(ctx, sName)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 671: ", err.Error())
-		log.Fatal(err.Error())
 		return err
 	}
 	cu.Images = append(cu.Images, exImage)
@@ -728,89 +953,377 @@ func (cu *GoCluster) CreateImage(cName string, sName string) error {
 
 // DeleteImage an Image from the GoCluster
 func (cu *GoCluster) DeleteImage(fingerprint string) error {
-	cmdStr := `lxc image delete ` + fingerprint
-	_, err := cu.shellCMD(cmdStr)
+	return cu.DeleteImageContext(context.Background(), fingerprint)
+}
+
+// DeleteImageContext is like DeleteImage but returns ctx.Err() once ctx is done
+func (cu *GoCluster) DeleteImageContext(ctx context.Context, fingerprint string) error {
+	err := cu.getBackend().DeleteImage(ctx, fingerprint)
+	return newOpError("delete image", fingerprint, err, ErrImageNotFound)
+}
+
+// GetImage gets a single image back from the GoCluster by its alias, fingerprint or fingerprint prefix
+func (cu *GoCluster) GetImage(name string) (*GoImage, error) {
+	return cu.GetImageContext(context.Background(), name)
+}
+
+// GetImageContext is like GetImage but returns ctx.Err() once ctx is done
+func (cu *GoCluster) GetImageContext(ctx context.Context, name string) (*GoImage, error) {
+	images, err := cu.ScanImagesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, img := range images {
+		if img.Fingerprint == name || len(name) >= 12 && strings.HasPrefix(img.Fingerprint, name) {
+			return img, nil
+		}
+		for _, alias := range img.Aliases {
+			if alias == name {
+				return img, nil
+			}
+		}
+	}
+	return nil, &OpError{"get image", name, ErrImageNotFound, ErrImageNotFound}
+}
+
+// AddImageAlias points alias at the image fingerprint
+func (cu *GoCluster) AddImageAlias(fingerprint string, alias string, description string) error {
+	return cu.AddImageAliasContext(context.Background(), fingerprint, alias, description)
+}
+
+// AddImageAliasContext is like AddImageAlias but returns ctx.Err() once ctx is done
+func (cu *GoCluster) AddImageAliasContext(ctx context.Context, fingerprint string, alias string, description string) error {
+	err := cu.getBackend().AddImageAlias(ctx, alias, fingerprint, description)
+	return newOpError("add image alias", alias, err, ErrImageNotFound)
+}
+
+// DeleteImageAlias removes alias, leaving the image it pointed at
+func (cu *GoCluster) DeleteImageAlias(alias string) error {
+	return cu.DeleteImageAliasContext(context.Background(), alias)
+}
+
+// DeleteImageAliasContext is like DeleteImageAlias but returns ctx.Err() once ctx is done
+func (cu *GoCluster) DeleteImageAliasContext(ctx context.Context, alias string) error {
+	err := cu.getBackend().DeleteImageAlias(ctx, alias)
+	return newOpError("delete image alias", alias, err, ErrImageNotFound)
+}
+
+// UpdateImage saves the Properties, Public and AutoUpdate of a GoImage, replacing the image's properties
+func (cu *GoCluster) UpdateImage(image *GoImage) error {
+	return cu.UpdateImageContext(context.Background(), image)
+}
+
+// UpdateImageContext is like UpdateImage but returns ctx.Err() once ctx is done
+func (cu *GoCluster) UpdateImageContext(ctx context.Context, image *GoImage) error {
+	update := ImageUpdate{Properties: image.Properties, Public: image.Public, AutoUpdate: image.AutoUpdate}
+	if update.Properties == nil {
+		update.Properties = map[string]string{}
+	}
+	err := cu.getBackend().UpdateImage(ctx, image.Fingerprint, update)
+	return newOpError("update image", image.Fingerprint, err, ErrImageNotFound)
+}
+
+// editImage loads the image name, applies edit to it and saves it
+func (cu *GoCluster) editImage(ctx context.Context, name string, edit func(*GoImage)) error {
+	image, err := cu.GetImageContext(ctx, name)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 684: ", err.Error())
-		log.Fatal(err.Error())
 		return err
 	}
-	return nil
+	props := map[string]string{}
+	for key, val := range image.Properties {
+		props[key] = val
+	}
+	image.Properties = props
+	edit(image)
+	return cu.UpdateImageContext(ctx, image)
+}
+
+// SetImageProperties sets properties on the image name, an empty value removes its property
+func (cu *GoCluster) SetImageProperties(name string, properties map[string]string) error {
+	return cu.SetImagePropertiesContext(context.Background(), name, properties)
+}
+
+// SetImagePropertiesContext is like SetImageProperties but returns ctx.Err() once ctx is done
+func (cu *GoCluster) SetImagePropertiesContext(ctx context.Context, name string, properties map[string]string) error {
+	return cu.editImage(ctx, name, func(image *GoImage) {
+		for key, val := range properties {
+			if val == "" {
+				delete(image.Properties, key)
+			} else {
+				image.Properties[key] = val
+			}
+		}
+	})
+}
+
+// SetImageDescription sets the description property of the image name
+func (cu *GoCluster) SetImageDescription(name string, description string) error {
+	return cu.SetImageDescriptionContext(context.Background(), name, description)
+}
+
+// SetImageDescriptionContext is like SetImageDescription but returns ctx.Err() once ctx is done
+func (cu *GoCluster) SetImageDescriptionContext(ctx context.Context, name string, description string) error {
+	return cu.SetImagePropertiesContext(ctx, name, map[string]string{"description": description})
+}
+
+// SetImagePublic sets whether the image name is served to hosts that are not trusted
+func (cu *GoCluster) SetImagePublic(name string, public bool) error {
+	return cu.SetImagePublicContext(context.Background(), name, public)
+}
+
+// SetImagePublicContext is like SetImagePublic but returns ctx.Err() once ctx is done
+func (cu *GoCluster) SetImagePublicContext(ctx context.Context, name string, public bool) error {
+	return cu.editImage(ctx, name, func(image *GoImage) {
+		image.Public = public
+	})
 }
 
-// ExportContainer from the GoCluster
+// SetImageAutoUpdate sets whether LXD keeps the image name, cached from a remote, up to date
+func (cu *GoCluster) SetImageAutoUpdate(name string, autoUpdate bool) error {
+	return cu.SetImageAutoUpdateContext(context.Background(), name, autoUpdate)
+}
+
+// SetImageAutoUpdateContext is like SetImageAutoUpdate but returns ctx.Err() once ctx is done
+func (cu *GoCluster) SetImageAutoUpdateContext(ctx context.Context, name string, autoUpdate bool) error {
+	return cu.editImage(ctx, name, func(image *GoImage) {
+		image.AutoUpdate = autoUpdate
+	})
+}
+
+// RefreshImage updates the image fingerprint from the remote it was cached from and reports whether it changed
+func (cu *GoCluster) RefreshImage(fingerprint string) (bool, error) {
+	return cu.RefreshImageContext(context.Background(), fingerprint)
+}
+
+// RefreshImageContext is like RefreshImage but returns ctx.Err() once ctx is done
+func (cu *GoCluster) RefreshImageContext(ctx context.Context, fingerprint string) (bool, error) {
+	refreshed, err := cu.getBackend().RefreshImage(ctx, fingerprint)
+	return refreshed, newOpError("refresh image", fingerprint, err, ErrImageNotFound)
+}
+
+// PruneImages deletes the images no GoContainer or GoSnapshot was launched from whose last use, or creation when
+// they were never used, is more than maxAge ago and returns them, a nil match prunes every such image
+func (cu *GoCluster) PruneImages(maxAge time.Duration, match func(*GoImage) bool) ([]*GoImage, error) {
+	return cu.PruneImagesContext(context.Background(), maxAge, match)
+}
+
+// PruneImagesContext is like PruneImages but returns ctx.Err() once ctx is done
+func (cu *GoCluster) PruneImagesContext(ctx context.Context, maxAge time.Duration, match func(*GoImage) bool) ([]*GoImage, error) {
+	var pruned []*GoImage
+	conOuts, err := cu.getBackend().List(ctx)
+	if err != nil {
+		return pruned, newOpError("list", cu.Name, err, nil)
+	}
+	inUse := map[string]bool{}
+	for _, conOut := range conOuts {
+		inUse[conOut.Config.BaseImage] = true
+		for _, snap := range conOut.State.SnapShots {
+			inUse[snap.Config.BaseImage] = true
+		}
+	}
+	images, err := cu.ScanImagesContext(ctx)
+	if err != nil {
+		return pruned, err
+	}
+	cutoff := time.Now().Add(-maxAge)
+	for _, img := range images {
+		lastUsed, ok := img.lastUsed()
+		if !ok || inUse[img.Fingerprint] || !lastUsed.Before(cutoff) || match != nil && !match(img) {
+			continue
+		}
+		if err = cu.DeleteImageContext(ctx, img.Fingerprint); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, img)
+	}
+	return pruned, nil
+}
+
+// AddImageRemote registers an image server, such as an ImageServer, as the image remote name of the GoCluster's
+// LXD host, trusting its certificate, in PEM, when not empty. Set a GoContainer's Remote, or DefaultImageRemote,
+// to name to create GoContainers from it
+func (cu *GoCluster) AddImageRemote(name string, server string, certificate string) error {
+	return cu.AddImageRemoteContext(context.Background(), name, server, certificate)
+}
+
+// AddImageRemoteContext is like AddImageRemote but returns ctx.Err() once ctx is done
+func (cu *GoCluster) AddImageRemoteContext(ctx context.Context, name string, server string, certificate string) error {
+	return newOpError("add image remote", name, cu.getBackend().AddRemote(ctx, name, server, certificate), nil)
+}
+
+// ExportContainer from the GoCluster, into its Store without loading the GoImage's Contents when it has one
 func (cu *GoCluster) ExportContainer(cName string) (*GoImage, error) {
+	return cu.ExportContainerContext(context.Background(), cName)
+}
+
+// ExportContainerContext is like ExportContainer but returns ctx.Err() once ctx is done
+func (cu *GoCluster) ExportContainerContext(ctx context.Context, cName string) (*GoImage, error) {
+	return cu.exportContainer(ctx, cName, func(container *GoContainer) (*GoImage, error) {
+		if cu.Store != nil {
+			return container.export(ctx, func(exImage *GoImage) error {
+				return cu.storeImage(ctx, exImage)
+			})
+		}
+		return container.ExportContext(ctx)
+	})
+}
+
+// storeImage streams an exported GoImage into the GoCluster's Store, indexed with the properties LXD holds for it
+func (cu *GoCluster) storeImage(ctx context.Context, image *GoImage) error {
+	lxdImage, err := cu.GetImageContext(ctx, image.Fingerprint)
+	if err != nil {
+		return err
+	}
+	image.Properties, image.DateTime = lxdImage.Properties, lxdImage.DateTime
+	return cu.Store.Put(ctx, image)
+}
+
+// ExportContainerTo streams an exported GoContainer to w without loading the GoImage's Contents
+func (cu *GoCluster) ExportContainerTo(cName string, w io.Writer) (*GoImage, error) {
+	return cu.ExportContainerToContext(context.Background(), cName, w)
+}
+
+// ExportContainerToContext is like ExportContainerTo but returns ctx.Err() once ctx is done
+func (cu *GoCluster) ExportContainerToContext(ctx context.Context, cName string, w io.Writer) (*GoImage, error) {
+	return cu.exportContainer(ctx, cName, func(container *GoContainer) (*GoImage, error) {
+		return container.ExportToContext(ctx, w)
+	})
+}
+
+// exportContainer exports a GoContainer with export, then deletes the GoImage it left on the LXD host
+func (cu *GoCluster) exportContainer(ctx context.Context, cName string, export func(*GoContainer) (*GoImage, error)) (*GoImage, error) {
 	var exImage *GoImage
-	container, err := cu.GetContainer(cName)
+	container, err := cu.GetContainerContext(ctx, cName)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 696: ", err.Error())
-		log.Fatal(err.Error())
 		return exImage, err
 	}
-	exImage, err = container.Export()
+	if container.Keys == nil {
+		container.Keys = cu.Keys
+	}
+	exImage, err = export(container)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 702: ", err.Error())
-		log.Fatal(err.Error())
 		return exImage, err
 	}
-	err = cu.DeleteImage(exImage.Fingerprint)
+	err = cu.DeleteImageContext(ctx, exImage.Fingerprint)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 708: ", err.Error())
-		log.Fatal(err.Error())
 		return exImage, err
 	}
 	return exImage, nil
 }
 
-// ImportContainer into the GoCluster
+// ImportContainer into the GoCluster, from its Store when it has one and the GoImage's Contents are not loaded
 func (cu *GoCluster) ImportContainer(containerName string, image *GoImage) (*GoContainer, error) {
+	return cu.ImportContainerContext(context.Background(), containerName, image)
+}
+
+// ImportContainerContext is like ImportContainer but returns ctx.Err() once ctx is done
+func (cu *GoCluster) ImportContainerContext(ctx context.Context, containerName string, image *GoImage) (*GoContainer, error) {
 	var newCon GoContainer
 	newCon.Name = containerName
-	err := newCon.Import(image)
+	newCon.backend = cu.getBackend()
+	if image.Policy == nil {
+		image.Policy = cu.Policy
+	}
+	if image.Keys == nil {
+		image.Keys = cu.Keys
+	}
+	importImage := image.ImportContext
+	if len(image.Contents) == 0 && cu.Store != nil {
+		importImage = func(ctx context.Context) error {
+			return cu.importStored(ctx, image)
+		}
+	}
+	err := newCon.importImage(ctx, image, importImage)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 721: ", err.Error())
-		log.Fatal(err.Error())
 		return &newCon, err
 	}
-	err = cu.DeleteImage(image.Name)
+	err = cu.DeleteImageContext(ctx, image.Fingerprint)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 727: ", err.Error())
-		log.Fatal(err.Error())
 		return &newCon, err
 	}
-	return cu.GetContainer(newCon.Name)
+	return cu.GetContainerContext(ctx, newCon.Name)
+}
+
+// importStored streams a GoImage from the GoCluster's Store into LXD, found by its fingerprint or else its name,
+// filling in the details the GoImage leaves empty from the stored entry
+func (cu *GoCluster) importStored(ctx context.Context, image *GoImage) error {
+	name := image.Fingerprint
+	if name == "" {
+		name = image.Name
+	}
+	stored, err := cu.Store.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	if image.Fingerprint == "" || strings.HasPrefix(stored.Fingerprint, strings.ToLower(image.Fingerprint)) {
+		image.Fingerprint = stored.Fingerprint
+	}
+	if image.Name == "" {
+		image.Name = stored.Name
+	}
+	if image.Type == "" {
+		image.Type = stored.Type
+	}
+	if image.DateTime == "" {
+		image.DateTime = stored.DateTime
+	}
+	if len(image.Properties) == 0 {
+		image.Properties = stored.Properties
+	}
+	if image.Signature == nil {
+		image.Signature = stored.Signature
+	}
+	files, err := cu.Store.Open(ctx, stored.Fingerprint)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	var rootfs io.Reader
+	if len(files) > 1 {
+		rootfs = files[1]
+	}
+	_, err = image.ImportFromContext(ctx, files[0], rootfs)
+	return err
 }
 
 // GetContainer gets a single container back from the GoCluster with GoContainer name as the filter
 func (cu *GoCluster) GetContainer(cName string) (*GoContainer, error) {
+	return cu.GetContainerContext(context.Background(), cName)
+}
+
+// GetContainerContext is like GetContainer but returns ctx.Err() once ctx is done
+func (cu *GoCluster) GetContainerContext(ctx context.Context, cName string) (*GoContainer, error) {
 	var goContainer *GoContainer
-	_, err := cu.Scan()
+	_, err := cu.ScanContext(ctx)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 739: ", err.Error())
-		log.Fatal(err.Error())
 		return goContainer, err
 	}
 	for _, con := range cu.Containers {
 		if con.Name == cName {
-			err = con.loadNetworkData("lxdbr0")
+			err = con.loadNetworkData(ctx, "lxdbr0")
 			if err != nil {
-				fmt.Println("ERROR: containers.go, line 747: ", err.Error())
-				log.Fatal(err.Error())
 				return con, err
 			}
 			return con, nil
 		}
 	}
-	return goContainer, nil
+	return goContainer, &OpError{"get container", cName, ErrContainerNotFound, ErrContainerNotFound}
 }
 
 // GetContainers gets all containers for a given GoCluster
 func (cu *GoCluster) GetContainers() ([]*GoContainer, error) {
+	return cu.GetContainersContext(context.Background())
+}
+
+// GetContainersContext is like GetContainers but returns ctx.Err() once ctx is done
+func (cu *GoCluster) GetContainersContext(ctx context.Context) ([]*GoContainer, error) {
 	for ind, _ := range cu.Containers {
-		err := cu.Containers[ind].loadNetworkData("lxdbr0")
+		err := cu.Containers[ind].loadNetworkData(ctx, "lxdbr0")
 		if err != nil {
-			fmt.Println("ERROR: containers.go, line 762: ", err.Error())
-			log.Fatal(err.Error())
 			return cu.Containers, err
 		}
 	}
@@ -819,59 +1332,66 @@ func (cu *GoCluster) GetContainers() ([]*GoContainer, error) {
 
 // Scan gets each GoContainer in a given GoCluster
 func (cu *GoCluster) Scan() ([]*GoContainer, error) {
+	return cu.ScanContext(context.Background())
+}
+
+// ScanContext is like Scan but returns ctx.Err() once ctx is done
+func (cu *GoCluster) ScanContext(ctx context.Context) ([]*GoContainer, error) {
 	var reContains []*GoContainer
-	cmdStr := `lxc ls --format json`
-	oBytes, err := cu.shellCMD(cmdStr)
+	conOuts, err := cu.getBackend().List(ctx)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 776: ", err.Error())
-		log.Fatal(err.Error())
-		return reContains, err
+		return reContains, newOpError("list containers", cu.Name, err, nil)
 	}
-	reOuts, err := LoadListOut(string(oBytes[0]))
-	if err != nil {
-		fmt.Println("ERROR: containers.go, line 782: ", err.Error())
-		log.Fatal(err.Error())
-		return reContains, err
-	}
-	cu.Containers = reOuts.GetContainers()
+	reOuts := &ListOutput{Outputs: conOuts}
+	cu.Containers = reOuts.goContainers(ctx, cu.getBackend())
 	return cu.Containers, nil
 }
 
 // DeleteContainer deletes the GoContainer whose name is inputted
 func (cu *GoCluster) DeleteContainer(cName string) error {
+	return cu.DeleteContainerContext(context.Background(), cName)
+}
+
+// DeleteContainerContext is like DeleteContainer but returns ctx.Err() once ctx is done
+func (cu *GoCluster) DeleteContainerContext(ctx context.Context, cName string) error {
 	var newContainers []*GoContainer
+	found := false
 	for _, con := range cu.Containers {
 		if con.Name == cName {
-			err := con.Delete()
+			err := con.DeleteContext(ctx)
 			if err != nil {
-				fmt.Println("ERROR: containers.go, line 797: ", err.Error())
-				log.Fatal(err.Error())
 				return err
 			}
+			found = true
 		} else {
 			newContainers = append(newContainers, con)
 		}
 	}
 	cu.Containers = newContainers
+	if !found {
+		return &OpError{"delete", cName, ErrContainerNotFound, ErrContainerNotFound}
+	}
 	return nil
 }
 
 // CreateContainer create a new GoContainer in the GoCluster
 func (cu *GoCluster) CreateContainer(auth *Auth, controller bool, name string, cType string, cRelease string, config []byte) error {
+	return cu.CreateContainerContext(context.Background(), auth, controller, name, cType, cRelease, config)
+}
+
+// CreateContainerContext is like CreateContainer but returns ctx.Err() once ctx is done
+func (cu *GoCluster) CreateContainerContext(ctx context.Context, auth *Auth, controller bool, name string, cType string, cRelease string, config []byte) error {
 	newContainer := NewGoContainer(name, controller, cType, cRelease, []string{}, config, "default", &Network{}, auth)
-	err := newContainer.Create()
+	newContainer.backend = cu.getBackend()
+	err := newContainer.CreateContext(ctx)
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 815: ", err.Error())
-		log.Fatal(err.Error())
 		return err
 	}
-	err = newContainer.loadNetworkData("lxdbr0")
+	err = newContainer.loadNetworkData(ctx, "lxdbr0")
 	if err != nil {
-		fmt.Println("ERROR: containers.go, line 820: ", err.Error())
-		log.Fatal(err.Error())
 		return err
 	}
-	if newContainer.Auth.Type != "" {
+	if newContainer.Auth != nil && newContainer.Auth.Type != "" {
 		newConn := NewConnection("auth", "ssh", newContainer.Auth.Port)
 		newContainer.Network.AddConnection(newConn)
 	}
@@ -13,11 +13,119 @@ Copyright 2021 John Connor Sanders
 package containers
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"golang.org/x/crypto/ssh"
 )
 
+// testLXD reports whether the tests run against a real LXD host instead of a FakeBackend
+func testLXD() bool {
+	return os.Getenv("GOCONTAINERS_TEST_LXD") != ""
+}
+
+// newTestCluster creates a test GoCluster, backed by a FakeBackend unless testing against LXD
+func newTestCluster(reverseProxy string) (*GoCluster, *FakeBackend) {
+	goCluster := NewGoCluster("test", "ubuntu", reverseProxy, "", "")
+	if testLXD() {
+		return goCluster, nil
+	}
+	fake := NewFakeBackend()
+	goCluster.SetBackend(fake)
+	return goCluster, fake
+}
+
+// newTestKey generates an ed25519 key pair for tests
+func newTestKey(t *testing.T) (ed25519.PrivateKey, ssh.Signer) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error Generating Test Key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("Error Loading Test Key: %v", err)
+	}
+	return priv, signer
+}
+
+// startTestSSHServer serves password or authorized key authenticated SSH connections with hostKey on 127.0.0.1 and returns its port
+func startTestSSHServer(t *testing.T, hostKey ssh.Signer, user string, password string, authorized ...ssh.PublicKey) string {
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if conn.User() == user && password != "" && string(pass) == password {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("password rejected for %s", conn.User())
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			for _, authKey := range authorized {
+				if conn.User() == user && bytes.Equal(key.Marshal(), authKey.Marshal()) {
+					return nil, nil
+				}
+			}
+			return nil, fmt.Errorf("public key rejected for %s", conn.User())
+		},
+	}
+	config.AddHostKey(hostKey)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error Starting Test SSH Server: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			nConn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSSHConn(nConn, config)
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port
+}
+
+// serveTestSSHConn completes an SSH handshake and serves session and direct-tcpip channels and tcpip-forward
+// requests, rejecting every other channel
+func serveTestSSHConn(nConn net.Conn, config *ssh.ServerConfig) {
+	sConn, chans, reqs, err := ssh.NewServerConn(nConn, config)
+	if err != nil {
+		return
+	}
+	go serveTestGlobalRequests(sConn, reqs)
+	for newChan := range chans {
+		switch newChan.ChannelType() {
+		case "session":
+			go serveTestSession(newChan)
+		case "direct-tcpip":
+			go serveTestDirectTCPIP(newChan)
+		default:
+			_ = newChan.Reject(ssh.UnknownChannelType, "not supported by the test server")
+		}
+	}
+}
+
+// TestMain keeps the tests' known_hosts out of the user's config directory
+func TestMain(m *testing.M) {
+	knownHostsDir, err := ioutil.TempDir("", "go-containers-known-hosts")
+	if err != nil {
+		fmt.Println("Error Creating Test known_hosts Directory: ", err.Error())
+		os.Exit(1)
+	}
+	KnownHostsFile = filepath.Join(knownHostsDir, "known_hosts")
+	code := m.Run()
+	_ = os.RemoveAll(knownHostsDir)
+	os.Exit(code)
+}
+
 // TestContainers
 func TestContainers(t *testing.T) {
 	t.Run("ClusterScan", testClusterScan)
@@ -30,7 +138,7 @@ func TestContainers(t *testing.T) {
 // testClusterScan
 func testClusterScan(t *testing.T) {
 	fmt.Println("\n<-----------BEGINNING 1: testClusterScan...")
-	goCluster := NewGoCluster("test", "ubuntu", "xenial", "", "")
+	goCluster, _ := newTestCluster("xenial")
 	cAuth := &Auth{}
 	fmt.Println("----------->BEGINNING 1.A: Create a Container...")
 	err := goCluster.CreateContainer(cAuth, true, "ClusterTest1", "ubuntu", "xenial", []byte{})
@@ -67,7 +175,7 @@ func testInitAuth(t *testing.T) {
 	password := "l0lThis1sAWeak1"
 	aType := "password"
 	port := "2222"
-	goCluster := NewGoCluster("test", "ubuntu", "xenial", "", "")
+	goCluster, fake := newTestCluster("xenial")
 	cAuth := NewAuth(username, aType, password, "", port)
 	fmt.Println("----------->BEGINNING 2.A: Create an Auth Container...")
 	err := goCluster.CreateContainer(cAuth, true, "CreateInitTest", "ubuntu", "xenial", []byte{})
@@ -76,6 +184,11 @@ func testInitAuth(t *testing.T) {
 		_ = goCluster.DeleteContainer("CreateInitTest")
 		t.Errorf("Error Creating Test Container: %v", err)
 	}
+	if fake != nil {
+		fakeCon := fake.Containers["CreateInitTest"]
+		fakeCon.Address = "127.0.0.1"
+		cAuth.Port = startTestSSHServer(t, fakeCon.HostKey, username, password)
+	}
 	fmt.Println("----------->PASSED 2.A: Create an Auth Container...")
 	fmt.Println("----------->BEGINNING 2.B: Get a Container...")
 	goCon, err := goCluster.GetContainer("CreateInitTest")
@@ -117,7 +230,7 @@ func testSnapshot(t *testing.T) {
 	password := "l0lThis1sAWeak1"
 	aType := "password"
 	port := "22"
-	goCluster := NewGoCluster("test", "ubuntu", "xenial", "", "")
+	goCluster, _ := newTestCluster("xenial")
 	cAuth := NewAuth(username, aType, password, "", port)
 	err := goCluster.CreateContainer(cAuth, true, "SnapshotTest", "ubuntu", "xenial", []byte{})
 	if err != nil {
@@ -166,7 +279,7 @@ func testSnapshot(t *testing.T) {
 func testContainerCMD(t *testing.T) {
 	fmt.Println("\n<-----------BEGINNING 4: testContainerCMD...")
 	expectOuts := []string{"/root\n", "/home\n", "/home/ubuntu\n"}
-	goCluster := NewGoCluster("test", "ubuntu", "", "", "")
+	goCluster, _ := newTestCluster("")
 	cAuth := &Auth{}
 	err := goCluster.CreateContainer(cAuth, true, "CMDTest", "ubuntu", "xenial", []byte{})
 	if err != nil {
@@ -239,6 +352,19 @@ func testContainerCMD(t *testing.T) {
 		t.Errorf("Error COMMAND TEST 3")
 	}
 	fmt.Println("----------->PASSED 4.D:  Login User Command...")
+	/*=============================TEST-5===============================*/
+	fmt.Println("----------->BEGINNING 4.E: Quoted Argument Command...")
+	output, err = goCon.CMD(`echo "a  b"`, "", true)
+	if err != nil {
+		fmt.Println("Error Executing Test CMD: ", err.Error())
+		_ = goCluster.DeleteContainer("CMDTest")
+		t.Errorf("Error Executing Test CMD: %v", err)
+	}
+	if string(output) != "a  b\n" {
+		_ = goCluster.DeleteContainer("CMDTest")
+		t.Errorf("Error COMMAND TEST 4, Expected The Quoted Argument To Be Kept Whole, Got %q", output)
+	}
+	fmt.Println("----------->PASSED 4.E: Quoted Argument Command...")
 	err = goCluster.DeleteContainer("CMDTest")
 	if err != nil {
 		fmt.Println("Error Deleting Test CMD Container: ", err.Error())
@@ -254,7 +380,7 @@ func testImportExport(t *testing.T) {
 	password := "l0lThis1sAWeak1"
 	aType := "password"
 	port := "22"
-	goCluster := NewGoCluster("test", "ubuntu", "xenial", "", "")
+	goCluster, _ := newTestCluster("xenial")
 	cAuth := NewAuth(username, aType, password, "", port)
 	err := goCluster.CreateContainer(cAuth, true, "ImportTest", "ubuntu", "xenial", []byte{})
 	if err != nil {
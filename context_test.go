@@ -0,0 +1,96 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// TestContext
+func TestContext(t *testing.T) {
+	t.Run("Canceled", testContextCanceled)
+	t.Run("BootDeadline", testContextBootDeadline)
+	t.Run("KillProcessGroup", testContextKillProcessGroup)
+}
+
+// testContextCanceled
+func testContextCanceled(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testContextCanceled...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("call counting needs the FakeBackend")
+	}
+	fake.AddContainer("CanceledTest", "ubuntu", "focal")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := goCluster.ScanContext(ctx); err != context.Canceled {
+		t.Errorf("Expected context.Canceled scanning, got %v", err)
+	}
+	goCon := &GoContainer{Name: "CanceledTest"}
+	goCon.SetBackend(fake)
+	if _, err := goCon.CMDContext(ctx, "true", "", true); err != context.Canceled {
+		t.Errorf("Expected context.Canceled running a command, got %v", err)
+	}
+	if _, err := goCon.ExportContext(ctx); err != context.Canceled {
+		t.Errorf("Expected context.Canceled exporting, got %v", err)
+	}
+	if calls := fake.CallCount("Publish"); calls != 0 {
+		t.Errorf("Expected a canceled export to stop before publishing, got %d publishes", calls)
+	}
+	fmt.Println("<-----------testContextCanceled COMPLETE")
+}
+
+// testContextBootDeadline
+func testContextBootDeadline(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testContextBootDeadline...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("fault injection needs the FakeBackend")
+	}
+	fake.BootChecks = 100
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := goCluster.CreateContainerContext(ctx, &Auth{}, true, "DeadlineTest", "ubuntu", "xenial", []byte{})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the boot wait to stop at the deadline, took %v", elapsed)
+	}
+	fmt.Println("<-----------testContextBootDeadline COMPLETE")
+}
+
+// testContextKillProcessGroup
+func testContextKillProcessGroup(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testContextKillProcessGroup...")
+	if _, err := exec.LookPath(ShellToUse); err != nil {
+		t.Skip("needs " + ShellToUse)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	// the sleep holds bash's stdout open, so only killing the whole group lets the command return
+	_, _, err := BASHContext(ctx, "sleep 5; echo done")
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the process group to be killed at the deadline, took %v", elapsed)
+	}
+	fmt.Println("<-----------testContextKillProcessGroup COMPLETE")
+}
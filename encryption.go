@@ -0,0 +1,283 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// KeyProvider supplies the AES-256 keys that encrypt and decrypt GoImage archives, such as keys held by a KMS
+type KeyProvider interface {
+	// EncryptionKey returns the ID and the 32 byte key new archives are encrypted with
+	EncryptionKey() (string, []byte, error)
+	// DecryptionKey returns the 32 byte key of the ID an archive was encrypted with
+	DecryptionKey(id string) ([]byte, error)
+}
+
+// DefaultKeyProvider encrypts the exports of every GoImage, GoContainer and GoCluster without their own Keys,
+// nil leaves exports unencrypted
+var DefaultKeyProvider KeyProvider
+
+// StaticKeys is a KeyProvider holding its keys in memory, the Current key encrypts and every key decrypts
+type StaticKeys struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+// NewStaticKeys creates a pointer to new StaticKeys encrypting with key
+func NewStaticKeys(id string, key []byte) *StaticKeys {
+	return &StaticKeys{id, map[string][]byte{id: key}}
+}
+
+// String prints StaticKeys without their keys
+func (sk StaticKeys) String() string {
+	return fmt.Sprintf("StaticKeys{Current: %s, Keys: %d}", sk.Current, len(sk.Keys))
+}
+
+// MarshalJSON serializes StaticKeys without their keys
+func (sk StaticKeys) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"Current": sk.Current})
+}
+
+// EncryptionKey returns the Current key
+func (sk *StaticKeys) EncryptionKey() (string, []byte, error) {
+	return sk.Current, sk.Keys[sk.Current], nil
+}
+
+// DecryptionKey returns the key with id
+func (sk *StaticKeys) DecryptionKey(id string) ([]byte, error) {
+	key, ok := sk.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("no image key with id %q", id)
+	}
+	return key, nil
+}
+
+const (
+	// encryptedMagic starts every encrypted image archive
+	encryptedMagic = "GOCENC\x01"
+	// encryptedExt is added to the file names of encrypted image archives
+	encryptedExt = ".enc"
+	// encryptedChunkSize is how much plaintext each AES-GCM chunk of an archive seals
+	encryptedChunkSize = 64 * 1024
+	// encryptedSaltSize is the size of the random salt each archive's key is derived with
+	encryptedSaltSize = 32
+)
+
+// archiveAEAD returns the AES-256-GCM cipher of one archive, keyed by key and the archive's salt
+func archiveAEAD(key []byte, salt []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("image keys must be 32 bytes, got %d", len(key))
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("go-containers image archive"))
+	mac.Write(salt)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns the nonce of an archive's chunk, the last chunk is marked so a truncated archive fails
+func chunkNonce(size int, counter uint64, last bool) []byte {
+	nonce := make([]byte, size)
+	binary.BigEndian.PutUint64(nonce[size-9:size-1], counter)
+	if last {
+		nonce[size-1] = 1
+	}
+	return nonce
+}
+
+// isEncrypted reports whether an image file starts like an encrypted image archive
+func isEncrypted(header []byte) bool {
+	return bytes.HasPrefix(header, []byte(encryptedMagic))
+}
+
+// archiveReader reads an image archive in chunks, sealing or opening each with its AEAD
+type archiveReader struct {
+	aead    cipher.AEAD
+	r       *bufio.Reader
+	seal    bool
+	counter uint64
+	chunk   []byte
+	out     []byte
+	done    bool
+	mu      sync.Mutex
+	err     error
+}
+
+// encryptArchive returns a reader of r encrypted with the EncryptionKey of keys
+func encryptArchive(r io.Reader, keys KeyProvider) (io.Reader, error) {
+	id, key, err := keys.EncryptionKey()
+	if err != nil {
+		return nil, err
+	} else if len(id) > 255 {
+		return nil, fmt.Errorf("image key id %q is longer than 255 bytes", id)
+	}
+	salt := make([]byte, encryptedSaltSize)
+	if _, err = io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	aead, err := archiveAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte(encryptedMagic), byte(len(id)))
+	header = append(append(header, id...), salt...)
+	return &archiveReader{
+		aead:  aead,
+		r:     bufio.NewReaderSize(r, encryptedChunkSize),
+		seal:  true,
+		chunk: make([]byte, encryptedChunkSize),
+		out:   header,
+	}, nil
+}
+
+// decryptArchive returns a reader of the encrypted archive r decrypted with the DecryptionKey it names
+func decryptArchive(r io.Reader, keys KeyProvider) (*archiveReader, error) {
+	br := bufio.NewReaderSize(r, encryptedChunkSize)
+	header := make([]byte, len(encryptedMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil || !isEncrypted(header) {
+		return nil, errors.New("image archive is not encrypted")
+	}
+	idSalt := make([]byte, int(header[len(header)-1])+encryptedSaltSize)
+	if _, err := io.ReadFull(br, idSalt); err != nil {
+		return nil, fmt.Errorf("image archive header is truncated: %v", err)
+	}
+	id, salt := string(idSalt[:len(idSalt)-encryptedSaltSize]), idSalt[len(idSalt)-encryptedSaltSize:]
+	if keys == nil {
+		return nil, fmt.Errorf("image archive is encrypted with key %q, but there is no KeyProvider", id)
+	}
+	key, err := keys.DecryptionKey(id)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := archiveAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveReader{
+		aead:  aead,
+		r:     br,
+		chunk: make([]byte, encryptedChunkSize+aead.Overhead()),
+	}, nil
+}
+
+// failed returns why the archive could not be decrypted, if it could not
+func (ar *archiveReader) failed() error {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	return ar.err
+}
+
+// Read the sealed or opened archive
+func (ar *archiveReader) Read(p []byte) (int, error) {
+	if err := ar.failed(); err != nil {
+		return 0, err
+	}
+	for len(ar.out) == 0 {
+		if ar.done {
+			return 0, io.EOF
+		}
+		if err := ar.next(); err != nil {
+			ar.mu.Lock()
+			ar.err = err
+			ar.mu.Unlock()
+			return 0, err
+		}
+	}
+	n := copy(p, ar.out)
+	ar.out = ar.out[n:]
+	return n, nil
+}
+
+// next seals or opens the archive's next chunk, a short chunk or one followed by nothing is the last chunk
+func (ar *archiveReader) next() error {
+	n, err := io.ReadFull(ar.r, ar.chunk)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	last := n < len(ar.chunk)
+	if !last {
+		if _, peekErr := ar.r.Peek(1); peekErr == io.EOF {
+			last = true
+		} else if peekErr != nil {
+			return peekErr
+		}
+	}
+	nonce := chunkNonce(ar.aead.NonceSize(), ar.counter, last)
+	if ar.seal {
+		ar.out = ar.aead.Seal(ar.out[:0], nonce, ar.chunk[:n], nil)
+	} else if ar.out, err = ar.aead.Open(ar.out[:0], nonce, ar.chunk[:n], nil); err != nil {
+		return errors.New("image archive failed authentication, it is corrupt, truncated or was encrypted with another key")
+	}
+	ar.counter++
+	ar.done = last
+	return nil
+}
+
+// stagingBackend is a Backend that writes image files to disk while it exports or imports them
+type stagingBackend interface {
+	stagesImages() bool
+}
+
+// stagesImages reports that lxc image export and import work on files on disk
+func (cb *CLIBackend) stagesImages() bool {
+	return true
+}
+
+// keys returns the GoImage's KeyProvider, defaulting to the DefaultKeyProvider
+func (im *GoImage) keys() KeyProvider {
+	if im.Keys != nil {
+		return im.Keys
+	}
+	return DefaultKeyProvider
+}
+
+// decryptPart returns a reader of one file being imported, decrypting it when it is an encrypted archive and
+// adding its archiveReader to archives
+func (im *GoImage) decryptPart(r io.Reader, archives []*archiveReader) (io.Reader, []*archiveReader, error) {
+	br := bufio.NewReaderSize(r, imageHeaderSize)
+	if header, _ := br.Peek(len(encryptedMagic)); !isEncrypted(header) {
+		return br, archives, nil
+	}
+	if err := im.checkStaging(); err != nil {
+		return nil, archives, err
+	}
+	archive, err := decryptArchive(br, im.keys())
+	if err != nil {
+		return nil, archives, err
+	}
+	return archive, append(archives, archive), nil
+}
+
+// checkStaging refuses to encrypt or decrypt a GoImage whose Backend would write it to disk unencrypted
+func (im *GoImage) checkStaging() error {
+	if sb, ok := im.getBackend().(stagingBackend); ok && sb.stagesImages() {
+		return errors.New("encrypted images cannot be moved through a Backend that stages them on disk, use the REST driver")
+	}
+	return nil
+}
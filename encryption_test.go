@@ -0,0 +1,154 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// TestEncryption
+func TestEncryption(t *testing.T) {
+	t.Run("Archives", testEncryptedArchives)
+	t.Run("ExportImport", testEncryptedExportImport)
+}
+
+// newTestImageKey generates a random image key
+func newTestImageKey(t *testing.T) []byte {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		t.Fatalf("Error Generating Test Image Key: %v", err)
+	}
+	return key
+}
+
+// testEncryptedArchives
+func testEncryptedArchives(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testEncryptedArchives...")
+	keys := NewStaticKeys("k1", newTestImageKey(t))
+	for _, size := range []int{0, 1, encryptedChunkSize - 1, encryptedChunkSize, encryptedChunkSize + 1, 3 * encryptedChunkSize} {
+		plain := make([]byte, size)
+		_, _ = io.ReadFull(rand.Reader, plain)
+		encReader, err := encryptArchive(bytes.NewReader(plain), keys)
+		if err != nil {
+			t.Fatalf("Error Encrypting %d Bytes: %v", size, err)
+		}
+		sealed, err := ioutil.ReadAll(encReader)
+		if err != nil || !isEncrypted(sealed) || size > 16 && bytes.Contains(sealed, plain) {
+			t.Fatalf("Expected %d Bytes To Be Sealed, Got %v", size, err)
+		}
+		archive, err := decryptArchive(bytes.NewReader(sealed), keys)
+		if err != nil {
+			t.Fatalf("Error Opening %d Bytes: %v", size, err)
+		}
+		if opened, err := ioutil.ReadAll(archive); err != nil || !bytes.Equal(opened, plain) {
+			t.Errorf("Expected %d Bytes To Round Trip, Got %d %v", size, len(opened), err)
+		}
+		if size != 3*encryptedChunkSize {
+			continue
+		}
+		tampered := append([]byte{}, sealed...)
+		tampered[len(tampered)/2] ^= 0x01
+		truncated := sealed[:len(sealed)-(encryptedChunkSize+16)]
+		for name, corrupt := range map[string][]byte{"Tampered": tampered, "Truncated": truncated} {
+			archive, err = decryptArchive(bytes.NewReader(corrupt), keys)
+			if err == nil {
+				_, err = ioutil.ReadAll(archive)
+			}
+			if err == nil {
+				t.Errorf("%s: Expected The Archive To Fail Authentication", name)
+			}
+		}
+		if _, err = decryptArchive(bytes.NewReader(sealed), NewStaticKeys("k2", newTestImageKey(t))); err == nil {
+			t.Errorf("Expected An Unknown Key ID To Fail")
+		}
+		wrongKey := NewStaticKeys("k1", newTestImageKey(t))
+		if archive, err = decryptArchive(bytes.NewReader(sealed), wrongKey); err == nil {
+			if _, err = ioutil.ReadAll(archive); err == nil {
+				t.Errorf("Expected The Wrong Key To Fail Authentication")
+			}
+		}
+	}
+	if strings.Contains(fmt.Sprint(*keys), string(keys.Keys["k1"])) {
+		t.Errorf("Expected StaticKeys To Print Without Their Keys")
+	}
+	fmt.Println("<-----------testEncryptedArchives COMPLETE")
+}
+
+// testEncryptedExportImport
+func testEncryptedExportImport(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testEncryptedExportImport...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("the encrypted export test needs a Backend that does not stage images on disk")
+	}
+	goCluster.Keys = NewStaticKeys("pipeline", newTestImageKey(t))
+	if err := goCluster.CreateContainer(NewAuth("tester", AuthPassword, "l0lThis1sAWeak1", "", "22"), false, "EncryptTest", "ubuntu", "focal", []byte{}); err != nil {
+		t.Fatalf("Error Creating Encrypt Test Container: %v", err)
+	}
+	fmt.Println("----------->BEGINNING A: Export an encrypted image...")
+	img, err := goCluster.ExportContainer("EncryptTest")
+	if err != nil {
+		t.Fatalf("Error Exporting Encrypted Image: %v", err)
+	}
+	if len(img.Contents) != 1 || !isEncrypted(img.Contents[0]) || !strings.HasSuffix(img.TarMeta[0], ".tar.gz.enc") {
+		t.Fatalf("Expected An Encrypted Archive, Got %v", img.TarMeta)
+	}
+	if img.Format != ImageUnified || img.Compression != CompressionGzip || img.Verified == "" {
+		t.Errorf("Expected The Plaintext Format And Fingerprint To Be Recorded, Got %s %s %q", img.Format, img.Compression, img.Verified)
+	}
+	fmt.Println("----------->PASSED A: Export an encrypted image...")
+	fmt.Println("----------->BEGINNING B: Refuse to decrypt without the key...")
+	keyless := *img
+	keyless.Keys = NewStaticKeys("other", newTestImageKey(t))
+	if _, err = goCluster.ImportContainer("KeylessImport", &keyless); !errors.Is(err, ErrImageEncryption) {
+		t.Errorf("Expected ErrImageEncryption Without The Key, Got %v", err)
+	}
+	tampered := *img
+	tampered.Contents = [][]byte{append([]byte{}, img.Contents[0]...)}
+	tampered.Contents[0][len(tampered.Contents[0])-20] ^= 0x01
+	if _, err = goCluster.ImportContainer("TamperedImport", &tampered); !errors.Is(err, ErrImageEncryption) {
+		t.Errorf("Expected ErrImageEncryption For A Tampered Archive, Got %v", err)
+	}
+	if len(fake.StoredImages) != 0 {
+		t.Errorf("Expected Nothing To Be Imported From A Refused Archive")
+	}
+	fmt.Println("----------->PASSED B: Refuse to decrypt without the key...")
+	fmt.Println("----------->BEGINNING C: Import an encrypted image...")
+	if _, err = goCluster.ImportContainer("EncryptedImport", img); err != nil {
+		t.Fatalf("Error Importing Encrypted Image: %v", err)
+	}
+	if _, ok := fake.Containers["EncryptedImport"]; !ok {
+		t.Errorf("Expected The Encrypted Image To Be Imported")
+	}
+	fmt.Println("----------->PASSED C: Import an encrypted image...")
+	fmt.Println("----------->BEGINNING D: Refuse to stage an encrypted image on disk...")
+	staged := NewGoImage(img.Name, img.Type, img.Fingerprint, "")
+	staged.Keys = goCluster.Keys
+	staged.SetBackend(NewBackend(DriverCLI))
+	if err = staged.Export(); !errors.Is(err, ErrImageEncryption) {
+		t.Errorf("Expected ErrImageEncryption Exporting Through lxc, Got %v", err)
+	}
+	staged.Contents, staged.TarMeta = img.Contents, img.TarMeta
+	if err = staged.Import(); !errors.Is(err, ErrImageEncryption) {
+		t.Errorf("Expected ErrImageEncryption Importing Through lxc, Got %v", err)
+	}
+	fmt.Println("----------->PASSED D: Refuse to stage an encrypted image on disk...")
+	fmt.Println("<-----------testEncryptedExportImport COMPLETE")
+}
@@ -0,0 +1,124 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os/exec"
+	"strings"
+)
+
+var (
+	// ErrContainerNotFound is returned when a GoContainer does not exist on the LXD host
+	ErrContainerNotFound = errors.New("container not found")
+	// ErrSnapshotNotFound is returned when a GoSnapshot does not exist on its GoContainer
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	// ErrImageNotFound is returned when a GoImage does not exist on the LXD host
+	ErrImageNotFound = errors.New("image not found")
+	// ErrBootTimeout is returned when a GoContainer does not finish booting in time
+	ErrBootTimeout = errors.New("container did not finish booting in time")
+	// ErrLXDUnavailable is returned when the LXD daemon or lxc client cannot be reached
+	ErrLXDUnavailable = errors.New("lxd is unavailable")
+	// ErrAuthIncomplete is returned when a GoContainer's Auth is missing what SSH needs
+	ErrAuthIncomplete = errors.New("auth profile is incomplete")
+	// ErrHostKeyMismatch is returned when an SSH server presents a host key other than the GoContainer's
+	ErrHostKeyMismatch = errors.New("ssh host key does not match the container")
+	// ErrHostKeyUnknown is returned when a GoContainer's SSH host keys could not be read
+	ErrHostKeyUnknown = errors.New("ssh host key of the container is unknown")
+	// ErrSplitImage is returned when a GoImage split into metadata and rootfs files is exported as a single stream
+	ErrSplitImage = errors.New("image is split into metadata and rootfs files")
+	// ErrImageMismatch is returned when imported image content does not match its expected size or fingerprint
+	ErrImageMismatch = errors.New("image content does not match its size or fingerprint")
+	// ErrImageSignature is returned when a GoImage's SignaturePolicy refuses its signature, or its lack of one
+	ErrImageSignature = errors.New("image signature is not trusted")
+	// ErrImageEncryption is returned when a GoImage archive cannot be encrypted or decrypted with its KeyProvider
+	ErrImageEncryption = errors.New("image archive cannot be encrypted or decrypted")
+	// ErrCloudInitFailed is returned when cloud-init reports errors setting up a GoContainer
+	ErrCloudInitFailed = errors.New("cloud-init failed")
+)
+
+// OpError records a failed GoCluster, GoContainer or GoImage operation
+type OpError struct {
+	Op   string
+	Name string
+	Kind error
+	Err  error
+}
+
+// Error returns the failed operation along with its underlying error
+func (e *OpError) Error() string {
+	if e.Name == "" {
+		return e.Op + ": " + e.Err.Error()
+	}
+	return e.Op + " " + e.Name + ": " + e.Err.Error()
+}
+
+// Unwrap returns the OpError's underlying error
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the sentinel error the OpError matches
+func (e *OpError) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+// newOpError wraps err from op on name, matching it to ErrLXDUnavailable or notFound when it applies,
+// errors from a done context are returned as the bare ctx.Err()
+func newOpError(op string, name string, err error, notFound error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.Canceled) {
+		return context.Canceled
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+	if _, ok := err.(*OpError); ok {
+		return err
+	}
+	var kind error
+	if isUnavailable(err) {
+		kind = ErrLXDUnavailable
+	} else if notFound != nil && isNotFound(err) {
+		kind = notFound
+	}
+	return &OpError{op, name, kind, err}
+}
+
+// isNotFound reports whether err is LXD saying something does not exist
+func isNotFound(err error) bool {
+	var lxdErr *LXDError
+	if errors.As(err, &lxdErr) {
+		return lxdErr.Code == http.StatusNotFound
+	}
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		return strings.HasPrefix(cmdErr.Stderr, "Error: ") && strings.Contains(strings.ToLower(cmdErr.Stderr), "not found")
+	}
+	return false
+}
+
+// isUnavailable reports whether err is a failure to reach LXD at all
+func isUnavailable(err error) bool {
+	if errors.Is(err, ErrLXDUnavailable) || errors.Is(err, exec.ErrNotFound) {
+		return true
+	}
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		return strings.HasPrefix(cmdErr.Stderr, "Error: ") && strings.Contains(cmdErr.Stderr, "dial unix")
+	}
+	return false
+}
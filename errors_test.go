@@ -0,0 +1,116 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestErrors
+func TestErrors(t *testing.T) {
+	defaultInterval := pollInterval
+	pollInterval = time.Millisecond
+	defer func() { pollInterval = defaultInterval }()
+	t.Run("NotFound", testErrorsNotFound)
+	t.Run("BootTimeout", testErrorsBootTimeout)
+	t.Run("AuthIncomplete", testErrorsAuthIncomplete)
+	t.Run("LXDUnavailable", testErrorsLXDUnavailable)
+	t.Run("CommandError", testErrorsCommandError)
+}
+
+// testErrorsNotFound
+func testErrorsNotFound(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testErrorsNotFound...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("error matching needs the FakeBackend")
+	}
+	if _, err := goCluster.GetContainer("MissingTest"); !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("Expected ErrContainerNotFound getting a missing container, got %v", err)
+	}
+	goCon := &GoContainer{Name: "MissingTest"}
+	goCon.SetBackend(fake)
+	if err := goCon.Stop(); !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("Expected ErrContainerNotFound stopping a missing container, got %v", err)
+	}
+	fake.AddContainer("SnapMissingTest", "ubuntu", "focal")
+	goCon = &GoContainer{Name: "SnapMissingTest"}
+	goCon.SetBackend(fake)
+	if err := goCon.DeleteSnapshot("missing"); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("Expected ErrSnapshotNotFound deleting a missing snapshot, got %v", err)
+	}
+	if err := goCluster.DeleteImage("missing"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("Expected ErrImageNotFound deleting a missing image, got %v", err)
+	}
+	fmt.Println("<-----------testErrorsNotFound COMPLETE")
+}
+
+// testErrorsBootTimeout
+func testErrorsBootTimeout(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testErrorsBootTimeout...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("fault injection needs the FakeBackend")
+	}
+	fake.BootChecks = 100
+	err := goCluster.CreateContainer(&Auth{}, true, "BootTimeoutTest", "ubuntu", "xenial", []byte{})
+	if !errors.Is(err, ErrBootTimeout) {
+		t.Errorf("Expected ErrBootTimeout, got %v", err)
+	}
+	fmt.Println("<-----------testErrorsBootTimeout COMPLETE")
+}
+
+// testErrorsAuthIncomplete
+func testErrorsAuthIncomplete(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testErrorsAuthIncomplete...")
+	goCon := &GoContainer{Name: "AuthTest", Auth: &Auth{Type: "password", User: "tester"}}
+	if err := goCon.OpenSSH(); !errors.Is(err, ErrAuthIncomplete) {
+		t.Errorf("Expected ErrAuthIncomplete, got %v", err)
+	}
+	fmt.Println("<-----------testErrorsAuthIncomplete COMPLETE")
+}
+
+// testErrorsLXDUnavailable
+func testErrorsLXDUnavailable(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testErrorsLXDUnavailable...")
+	goCluster := NewGoCluster("UnavailableTest", "test", "", "", "")
+	goCluster.SetBackend(NewRESTBackend(NewLXDClient("/nonexistent/go-containers/unix.socket")))
+	if _, err := goCluster.Scan(); !errors.Is(err, ErrLXDUnavailable) {
+		t.Errorf("Expected ErrLXDUnavailable, got %v", err)
+	}
+	fmt.Println("<-----------testErrorsLXDUnavailable COMPLETE")
+}
+
+// testErrorsCommandError
+func testErrorsCommandError(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testErrorsCommandError...")
+	_, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("exit codes need the FakeBackend")
+	}
+	fake.AddContainer("ExitTest", "ubuntu", "focal")
+	goCon := &GoContainer{Name: "ExitTest"}
+	goCon.SetBackend(fake)
+	_, err := goCon.CMD("cat /missing", "", true)
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		t.Fatalf("Expected a CommandError, got %v", err)
+	}
+	if cmdErr.ExitCode == 0 || cmdErr.Stderr == "" {
+		t.Errorf("Expected an exit code and stderr, got %d %q", cmdErr.ExitCode, cmdErr.Stderr)
+	}
+	fmt.Println("<-----------testErrorsCommandError COMPLETE")
+}
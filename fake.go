@@ -0,0 +1,1125 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeCommand emulates a command run inside a FakeContainer and returns its stdout, stderr and exit status
+type FakeCommand func(con *FakeContainer, user string, args []string) ([]byte, []byte, int)
+
+// FakeContainer is a container emulated by a FakeBackend
+type FakeContainer struct {
+	Name       string
+	Status     string
+	OS         string
+	Release    string
+	Config     map[string]string
+	Address    string
+	HWAddr     string
+	Files      map[string][]byte
+	Snapshots  []string
+	Execs      [][]string
+	HostKey    ssh.Signer
+	bootChecks int
+	snapFiles  map[string]map[string][]byte
+}
+
+// FakeImage is an image stored by a FakeBackend
+type FakeImage struct {
+	Fingerprint string
+	Aliases     []string
+	OS          string
+	Release     string
+	Files       map[string][]byte
+	Created     string
+	LastUsed    string
+	Properties  map[string]string
+	Public      bool
+	AutoUpdate  bool
+	Cached      bool
+}
+
+// FakeRemote is a simplestreams image server registered with a FakeBackend, which pulls images from it over
+// https like LXD does
+type FakeRemote struct {
+	Server      string
+	Certificate string
+}
+
+// readTarball calls fn for every regular file in a gzipped tarball
+func readTarball(tarball []byte, fn func(name string, contents []byte)) {
+	gr, err := gzip.NewReader(bytes.NewReader(tarball))
+	if err != nil {
+		return
+	}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			return
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		contents, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return
+		}
+		fn(strings.TrimPrefix(hdr.Name, "./"), contents)
+	}
+}
+
+// loadMetadata reads the os and release properties from a FakeImage's metadata.yaml
+func (img *FakeImage) loadMetadata() {
+	for _, contents := range img.Files {
+		readTarball(contents, func(name string, contents []byte) {
+			if name != "metadata.yaml" {
+				return
+			}
+			var metadata lxdMetadata
+			if yaml.Unmarshal(contents, &metadata) == nil {
+				img.OS, img.Release = metadata.Properties["os"], metadata.Properties["release"]
+			}
+		})
+	}
+}
+
+// rootfs returns the files under rootfs/ in a FakeImage's tarballs
+func (img *FakeImage) rootfs() map[string][]byte {
+	files := map[string][]byte{}
+	for _, contents := range img.Files {
+		readTarball(contents, func(name string, contents []byte) {
+			if strings.HasPrefix(name, "rootfs/") {
+				files[strings.TrimPrefix(name, "rootfs")] = contents
+			}
+		})
+	}
+	return files
+}
+
+// FakeBackend is an in-memory Backend that emulates an LXD host for tests
+type FakeBackend struct {
+	Containers   map[string]*FakeContainer
+	StoredImages map[string]*FakeImage
+	Commands     map[string]FakeCommand
+	Errors       map[string]error
+	BootChecks   int
+	EmptyLeases  int
+	Calls        []string
+	Remotes      map[string]FakeRemote
+	mu           sync.Mutex
+	nextHost     int
+}
+
+// NewFakeBackend creates a pointer to a new FakeBackend with the default FakeCommands
+func NewFakeBackend() *FakeBackend {
+	fb := &FakeBackend{
+		Containers:   map[string]*FakeContainer{},
+		StoredImages: map[string]*FakeImage{},
+		Commands:     map[string]FakeCommand{},
+		Errors:       map[string]error{},
+		Remotes:      map[string]FakeRemote{},
+	}
+	fb.Commands["systemctl"] = fakeSystemctl
+	fb.Commands["cat"] = fakeCat
+	fb.Commands["echo"] = fakeEcho
+	fb.Commands["cloud-init"] = fakeCloudInit
+	fb.Commands["true"] = func(*FakeContainer, string, []string) ([]byte, []byte, int) {
+		return []byte{}, []byte{}, 0
+	}
+	return fb
+}
+
+// Fail makes every following call of the Backend method op return err, a nil err clears it
+func (fb *FakeBackend) Fail(op string, err error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if err == nil {
+		delete(fb.Errors, op)
+		return
+	}
+	fb.Errors[op] = err
+}
+
+// call records a Backend method call and returns any error injected for it, or ctx's error once it is done
+func (fb *FakeBackend) call(ctx context.Context, op string, args ...string) error {
+	fb.Calls = append(fb.Calls, strings.TrimSpace(op+" "+strings.Join(args, " ")))
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fb.Errors[op]
+}
+
+// CallCount returns how many times the Backend method op has been called
+func (fb *FakeBackend) CallCount(op string) int {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	count := 0
+	for _, c := range fb.Calls {
+		if c == op || strings.HasPrefix(c, op+" ") {
+			count++
+		}
+	}
+	return count
+}
+
+// container returns a FakeContainer, or the LXD not found error
+func (fb *FakeBackend) container(name string) (*FakeContainer, error) {
+	con, ok := fb.Containers[name]
+	if !ok {
+		return nil, &LXDError{http.StatusNotFound, "Instance not found"}
+	}
+	return con, nil
+}
+
+// image returns a FakeImage by fingerprint or alias, or the LXD not found error
+func (fb *FakeBackend) image(name string) (*FakeImage, error) {
+	for _, img := range fb.StoredImages {
+		if img.Fingerprint == name || strings.HasPrefix(img.Fingerprint, name) && len(name) >= 12 {
+			return img, nil
+		}
+		for _, alias := range img.Aliases {
+			if alias == name {
+				return img, nil
+			}
+		}
+	}
+	return nil, &LXDError{http.StatusNotFound, "Image not found"}
+}
+
+// fingerprintImage returns a FakeImage by its fingerprint or a unique prefix of it, like the LXD endpoints that
+// take no aliases, or the LXD not found error
+func (fb *FakeBackend) fingerprintImage(fingerprint string) (*FakeImage, error) {
+	var found *FakeImage
+	for _, img := range fb.StoredImages {
+		if fingerprint != "" && strings.HasPrefix(img.Fingerprint, fingerprint) {
+			if found != nil {
+				return nil, &LXDError{http.StatusBadRequest, "More than one image matches"}
+			}
+			found = img
+		}
+	}
+	if found == nil {
+		return nil, &LXDError{http.StatusNotFound, "Image not found"}
+	}
+	return found, nil
+}
+
+// AddContainer adds a running FakeContainer as if it had been launched from os/release
+func (fb *FakeBackend) AddContainer(name string, imgOS string, release string) *FakeContainer {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	return fb.addContainer(name, imgOS, release)
+}
+
+// addContainer adds a running FakeContainer with the next free address
+func (fb *FakeBackend) addContainer(name string, imgOS string, release string) *FakeContainer {
+	fb.nextHost++
+	con := &FakeContainer{
+		Name:       name,
+		Status:     "Running",
+		OS:         imgOS,
+		Release:    release,
+		Config:     map[string]string{},
+		Address:    fmt.Sprintf("10.0.3.%d", fb.nextHost+1),
+		HWAddr:     fmt.Sprintf("00:16:3e:00:00:%02x", fb.nextHost),
+		Files:      map[string][]byte{"/etc/hostname": []byte(name + "\n")},
+		bootChecks: fb.BootChecks,
+		snapFiles:  map[string]map[string][]byte{},
+	}
+	con.SetHostKey(newFakeHostKey())
+	fb.Containers[name] = con
+	return con
+}
+
+// newFakeHostKey generates an ed25519 SSH host key for a FakeContainer
+func newFakeHostKey() ssh.Signer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		panic(err)
+	}
+	return signer
+}
+
+// SetHostKey sets the SSH host key of a FakeContainer, along with its /etc/ssh public key file
+func (con *FakeContainer) SetHostKey(hostKey ssh.Signer) {
+	con.HostKey = hostKey
+	con.Files["/etc/ssh/ssh_host_ed25519_key.pub"] = ssh.MarshalAuthorizedKey(hostKey.PublicKey())
+}
+
+// Launch creates and starts a FakeContainer
+func (fb *FakeBackend) Launch(ctx context.Context, name string, remote string, alias string, config map[string]string) error {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if err := fb.call(ctx, "Launch", name, remote+":"+alias); err != nil {
+		return err
+	}
+	if _, ok := fb.Containers[name]; ok {
+		return &LXDError{http.StatusConflict, "This instance already exists"}
+	}
+	imgOS, release, baseImage := remote, "", ""
+	files := map[string][]byte{}
+	fakeRemote, pull := fb.Remotes[remote]
+	if remote == "" || pull {
+		var img *FakeImage
+		var err error
+		if pull {
+			img, err = fb.pullImage(ctx, fakeRemote, alias)
+		} else {
+			img, err = fb.image(alias)
+		}
+		if err != nil {
+			return err
+		}
+		imgOS, release = img.OS, img.Release
+		files = img.rootfs()
+		img.LastUsed = time.Now().UTC().Format(time.RFC3339)
+		baseImage = img.Fingerprint
+	} else if sAlias := strings.Split(alias, "/"); len(sAlias) > 1 {
+		imgOS, release = sAlias[0], sAlias[1]
+	}
+	con := fb.addContainer(name, imgOS, release)
+	for fPath, contents := range files {
+		con.Files[fPath] = contents
+	}
+	con.SetHostKey(con.HostKey) // cloud-init gives every new instance its own host keys
+	for key, val := range config {
+		con.Config[key] = val
+	}
+	if baseImage != "" {
+		con.Config["volatile.base_image"] = baseImage
+	}
+	return nil
+}
+
+// setStatus moves a FakeContainer from one status to another
+func (fb *FakeBackend) setStatus(ctx context.Context, op string, name string, from string, to string) error {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if err := fb.call(ctx, op, name); err != nil {
+		return err
+	}
+	con, err := fb.container(name)
+	if err != nil {
+		return err
+	}
+	if con.Status != from {
+		return &LXDError{http.StatusBadRequest, "The instance is " + strings.ToLower(con.Status)}
+	}
+	con.Status = to
+	return nil
+}
+
+// Start a FakeContainer
+func (fb *FakeBackend) Start(ctx context.Context, name string) error {
+	return fb.setStatus(ctx, "Start", name, "Stopped", "Running")
+}
+
+// Stop a FakeContainer
+func (fb *FakeBackend) Stop(ctx context.Context, name string) error {
+	return fb.setStatus(ctx, "Stop", name, "Running", "Stopped")
+}
+
+// Restart a FakeContainer
+func (fb *FakeBackend) Restart(ctx context.Context, name string) error {
+	return fb.setStatus(ctx, "Restart", name, "Running", "Running")
+}
+
+// Delete a stopped FakeContainer
+func (fb *FakeBackend) Delete(ctx context.Context, name string) error {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if err := fb.call(ctx, "Delete", name); err != nil {
+		return err
+	}
+	con, err := fb.container(name)
+	if err != nil {
+		return err
+	}
+	if con.Status == "Running" {
+		return &LXDError{http.StatusBadRequest, "The instance is currently running, stop it first"}
+	}
+	delete(fb.Containers, name)
+	return nil
+}
+
+// Exec emulates running argv inside a FakeContainer with a minimal shell
+func (fb *FakeBackend) Exec(ctx context.Context, name string, argv []string) ([]byte, []byte, error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if err := fb.call(ctx, "Exec", append([]string{name}, argv...)...); err != nil {
+		return nil, nil, err
+	}
+	con, err := fb.container(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if con.Status != "Running" {
+		return nil, nil, &LXDError{http.StatusBadRequest, "Instance is not running"}
+	}
+	con.Execs = append(con.Execs, argv)
+	stdout, stderr, code := fb.run(con, argv)
+	if code != 0 {
+		return stdout, stderr, &CommandError{argv, code, strings.TrimSpace(string(stderr)), fmt.Errorf("exit status %d", code)}
+	}
+	return stdout, stderr, nil
+}
+
+// PushFile writes a file into a running FakeContainer
+func (fb *FakeBackend) PushFile(ctx context.Context, name string, fPath string, r io.Reader, mode os.FileMode) error {
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if err = fb.call(ctx, "PushFile", name, fPath); err != nil {
+		return err
+	}
+	con, err := fb.container(name)
+	if err != nil {
+		return err
+	}
+	if con.Status != "Running" {
+		return &LXDError{http.StatusBadRequest, "Instance is not running"}
+	}
+	con.Files[fPath] = contents
+	return nil
+}
+
+// run executes argv in a FakeContainer as LXD does, without a shell unless argv runs one
+func (fb *FakeBackend) run(con *FakeContainer, argv []string) ([]byte, []byte, int) {
+	user, home := "root", "/root"
+	if len(argv) == 7 && argv[0] == "sudo" && argv[1] == "--login" && argv[2] == "--user" && argv[4] == "bash" && argv[5] == "-ilc" {
+		user, home = argv[3], "/home/"+argv[3]
+		return fb.shell(con, user, home, argv[6])
+	} else if len(argv) == 4 && argv[0] == "sudo" && argv[1] == "bash" && argv[2] == "-ilc" {
+		return fb.shell(con, user, home, argv[3])
+	} else if len(argv) == 3 && (argv[0] == "bash" || argv[0] == "sh") && argv[1] == "-c" {
+		return fb.shell(con, user, home, argv[2])
+	} else if len(argv) > 1 && argv[0] == "env" {
+		args := argv[1:]
+		for len(args) > 1 && strings.Contains(args[0], "=") {
+			args = args[1:]
+		}
+		return fb.run(con, args)
+	}
+	if len(argv) == 0 {
+		return []byte{}, []byte("exec: no command\n"), 1
+	}
+	cmd, ok := fb.Commands[argv[0]]
+	if !ok {
+		return []byte{}, []byte("exec: " + argv[0] + ": executable file not found in $PATH\n"), 127
+	}
+	return cmd(con, user, argv[1:])
+}
+
+// shell emulates a script of commands joined by && or ;, splitting each command into words as sh does
+func (fb *FakeBackend) shell(con *FakeContainer, user string, home string, script string) ([]byte, []byte, int) {
+	var stdout, stderr bytes.Buffer
+	cwd := home
+	code := 0
+	commands, err := shellCommands(script)
+	if err != nil {
+		return []byte{}, []byte("sh: " + err.Error() + "\n"), 2
+	}
+	for _, args := range commands {
+		switch args[0] {
+		case "cd":
+			cwd = home
+			if len(args) > 1 && args[1] != "~" {
+				cwd = filepath.Clean(args[1])
+			}
+			code = 0
+		case "pwd":
+			stdout.WriteString(cwd + "\n")
+			code = 0
+		default:
+			cmd, ok := fb.Commands[args[0]]
+			if !ok {
+				stderr.WriteString("bash: " + args[0] + ": command not found\n")
+				return stdout.Bytes(), stderr.Bytes(), 127
+			}
+			out, errOut, cCode := cmd(con, user, args[1:])
+			stdout.Write(out)
+			stderr.Write(errOut)
+			code = cCode
+		}
+		if code != 0 {
+			break
+		}
+	}
+	return stdout.Bytes(), stderr.Bytes(), code
+}
+
+// shellCommands splits a script into the words of its commands, honouring quotes and backslashes, with unquoted
+// && and ; separating commands
+func shellCommands(script string) ([][]string, error) {
+	var commands [][]string
+	var args []string
+	var word strings.Builder
+	inWord := false
+	endWord := func() {
+		if inWord {
+			args = append(args, word.String())
+		}
+		word.Reset()
+		inWord = false
+	}
+	endCommand := func() {
+		endWord()
+		if len(args) > 0 {
+			commands = append(commands, args)
+		}
+		args = nil
+	}
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case c == '\'':
+			end := strings.IndexByte(script[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated quoted string")
+			}
+			word.WriteString(script[i+1 : i+1+end])
+			inWord = true
+			i += end + 1
+		case c == '"':
+			inWord = true
+			for i++; ; i++ {
+				if i >= len(script) {
+					return nil, errors.New("unterminated quoted string")
+				}
+				if script[i] == '"' {
+					break
+				}
+				if script[i] == '\\' && i+1 < len(script) && strings.IndexByte("\"\\$`", script[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(script[i])
+			}
+		case c == '\\' && i+1 < len(script):
+			i++
+			word.WriteByte(script[i])
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n':
+			endWord()
+		case c == ';':
+			endCommand()
+		case c == '&' && i+1 < len(script) && script[i+1] == '&':
+			endCommand()
+			i++
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	endCommand()
+	return commands, nil
+}
+
+// fakeSystemctl reports a FakeContainer as starting until its boot checks run out
+func fakeSystemctl(con *FakeContainer, user string, args []string) ([]byte, []byte, int) {
+	if len(args) == 0 || args[0] != "is-system-running" {
+		return []byte{}, []byte{}, 0
+	}
+	if con.bootChecks > 0 {
+		con.bootChecks--
+		return []byte("starting\n"), []byte{}, 1
+	}
+	return []byte("running\n"), []byte{}, 0
+}
+
+// fakeCat prints the contents of FakeContainer files
+func fakeCat(con *FakeContainer, user string, args []string) ([]byte, []byte, int) {
+	var out bytes.Buffer
+	for _, arg := range args {
+		matched := false
+		var paths []string
+		for fPath := range con.Files {
+			paths = append(paths, fPath)
+		}
+		sort.Strings(paths)
+		for _, fPath := range paths {
+			if ok, _ := filepath.Match(arg, fPath); ok {
+				out.Write(con.Files[fPath])
+				matched = true
+			}
+		}
+		if !matched {
+			return out.Bytes(), []byte("cat: " + arg + ": No such file or directory\n"), 1
+		}
+	}
+	return out.Bytes(), []byte{}, 0
+}
+
+// fakeCloudInit reports cloud-init as done, or as failed when the FakeContainer's result.json lists errors
+func fakeCloudInit(con *FakeContainer, user string, args []string) ([]byte, []byte, int) {
+	if len(args) == 0 || args[0] != "status" {
+		return []byte{}, []byte("cloud-init: unsupported command\n"), 2
+	}
+	var resultFile struct {
+		V1 struct {
+			Errors []string `json:"errors"`
+		} `json:"v1"`
+	}
+	_ = json.Unmarshal(con.Files[cloudInitResultFile], &resultFile)
+	if len(resultFile.V1.Errors) != 0 {
+		return []byte("status: error\n"), []byte{}, 1
+	}
+	return []byte("status: done\n"), []byte{}, 0
+}
+
+// fakeEcho prints its arguments
+func fakeEcho(con *FakeContainer, user string, args []string) ([]byte, []byte, int) {
+	return []byte(strings.Join(args, " ") + "\n"), []byte{}, 0
+}
+
+// List all FakeContainers
+func (fb *FakeBackend) List(ctx context.Context) ([]ContainerOutput, error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	var outputs []ContainerOutput
+	if err := fb.call(ctx, "List"); err != nil {
+		return outputs, err
+	}
+	var names []string
+	for name := range fb.Containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		con := fb.Containers[name]
+		statusCode := 102
+		if con.Status == "Running" {
+			statusCode = 103
+		}
+		outputs = append(outputs, ContainerOutput{
+			Architecture: "x86_64",
+			Config:       LXCConfig{ImageArchitecture: "amd64", ImageOS: con.OS, ImageRelease: con.Release, BaseImage: con.Config["volatile.base_image"]},
+			Name:         con.Name,
+			Status:       con.Status,
+			StatusCode:   statusCode,
+		})
+	}
+	return outputs, nil
+}
+
+// Leases lists a lease for every FakeContainer, unless EmptyLeases calls remain
+func (fb *FakeBackend) Leases(ctx context.Context, network string) ([]NetworkEntry, error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	var entries []NetworkEntry
+	if err := fb.call(ctx, "Leases", network); err != nil {
+		return entries, err
+	}
+	if fb.EmptyLeases > 0 {
+		fb.EmptyLeases--
+		return entries, nil
+	}
+	for _, con := range fb.Containers {
+		entries = append(entries, NetworkEntry{
+			Hostname: con.Name,
+			HWAddr:   con.HWAddr,
+			Address:  con.Address,
+			Type:     "dynamic",
+		})
+	}
+	return entries, nil
+}
+
+// copyFiles returns a copy of a FakeContainer file map
+func copyFiles(files map[string][]byte) map[string][]byte {
+	reFiles := map[string][]byte{}
+	for fPath, contents := range files {
+		reFiles[fPath] = append([]byte{}, contents...)
+	}
+	return reFiles
+}
+
+// Snapshot a FakeContainer
+func (fb *FakeBackend) Snapshot(ctx context.Context, name string, snapName string) error {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if err := fb.call(ctx, "Snapshot", name, snapName); err != nil {
+		return err
+	}
+	con, err := fb.container(name)
+	if err != nil {
+		return err
+	}
+	if _, ok := con.snapFiles[snapName]; ok {
+		return &LXDError{http.StatusConflict, "Snapshot '" + snapName + "' already in use"}
+	}
+	con.Snapshots = append(con.Snapshots, snapName)
+	con.snapFiles[snapName] = copyFiles(con.Files)
+	return nil
+}
+
+// Snapshots lists the snapshot names of a FakeContainer
+func (fb *FakeBackend) Snapshots(ctx context.Context, name string) ([]string, error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if err := fb.call(ctx, "Snapshots", name); err != nil {
+		return nil, err
+	}
+	con, err := fb.container(name)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{}, con.Snapshots...), nil
+}
+
+// DeleteSnapshot deletes a snapshot of a FakeContainer
+func (fb *FakeBackend) DeleteSnapshot(ctx context.Context, name string, snapName string) error {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if err := fb.call(ctx, "DeleteSnapshot", name, snapName); err != nil {
+		return err
+	}
+	con, err := fb.container(name)
+	if err != nil {
+		return err
+	}
+	for ind, sn := range con.Snapshots {
+		if sn == snapName {
+			con.Snapshots = append(con.Snapshots[:ind], con.Snapshots[ind+1:]...)
+			delete(con.snapFiles, snapName)
+			return nil
+		}
+	}
+	return &LXDError{http.StatusNotFound, "Snapshot not found"}
+}
+
+// Restore a FakeContainer's files from one of its snapshots
+func (fb *FakeBackend) Restore(ctx context.Context, name string, snapName string) error {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if err := fb.call(ctx, "Restore", name, snapName); err != nil {
+		return err
+	}
+	con, err := fb.container(name)
+	if err != nil {
+		return err
+	}
+	files, ok := con.snapFiles[snapName]
+	if !ok {
+		return &LXDError{http.StatusNotFound, "Snapshot not found"}
+	}
+	con.Files = copyFiles(files)
+	return nil
+}
+
+// fakeImageTarball builds a gzipped LXD image tarball holding metadata.yaml and the files as its rootfs
+func fakeImageTarball(imgOS string, release string, files map[string][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	metadata := fmt.Sprintf("architecture: x86_64\ncreation_date: %d\nproperties:\n  os: %s\n  release: %s\n", time.Now().Unix(), imgOS, release)
+	entries := map[string][]byte{"metadata.yaml": []byte(metadata)}
+	for fPath, contents := range files {
+		entries["rootfs"+fPath] = contents
+	}
+	var names []string
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(entries[name])), ModTime: time.Unix(0, 0)}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(entries[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// addImage stores image files under the sha256 fingerprint of their contents, hashed metadata first as LXD does
+func (fb *FakeBackend) addImage(names []string, contents [][]byte, alias string) *FakeImage {
+	hash := sha256.New()
+	files := map[string][]byte{}
+	byName := map[string][]byte{}
+	for ind, name := range names {
+		byName[name] = contents[ind]
+	}
+	sorted := append([]string{}, names...)
+	sortImageParts(sorted)
+	for _, name := range sorted {
+		hash.Write(byName[name])
+	}
+	fingerprint := hex.EncodeToString(hash.Sum(nil))
+	for ind, name := range names {
+		files[strings.Replace(name, "{{fingerprint}}", fingerprint, 1)] = contents[ind]
+	}
+	img, ok := fb.StoredImages[fingerprint]
+	if !ok {
+		img = &FakeImage{
+			Fingerprint: fingerprint,
+			Files:       files,
+			Created:     time.Now().UTC().Format(time.RFC3339),
+		}
+		img.loadMetadata()
+		fb.StoredImages[fingerprint] = img
+	}
+	if alias != "" {
+		img.Aliases = append(img.Aliases, alias)
+	}
+	return img
+}
+
+// Publish a FakeContainer or one of its snapshots as a FakeImage
+func (fb *FakeBackend) Publish(ctx context.Context, name string, snapName string, alias string) (string, error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if err := fb.call(ctx, "Publish", name, snapName, alias); err != nil {
+		return "", err
+	}
+	con, err := fb.container(name)
+	if err != nil {
+		return "", err
+	}
+	files := con.Files
+	if snapName != "" {
+		var ok bool
+		if files, ok = con.snapFiles[snapName]; !ok {
+			return "", &LXDError{http.StatusNotFound, "Snapshot not found"}
+		}
+	}
+	tarball, err := fakeImageTarball(con.OS, con.Release, files)
+	if err != nil {
+		return "", err
+	}
+	img := fb.addImage([]string{"{{fingerprint}}.tar.gz"}, [][]byte{tarball}, alias)
+	return img.Fingerprint, nil
+}
+
+// Images lists all FakeImages
+func (fb *FakeBackend) Images(ctx context.Context) ([]ImageOutput, error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	var outputs []ImageOutput
+	if err := fb.call(ctx, "Images"); err != nil {
+		return outputs, err
+	}
+	for _, img := range fb.StoredImages {
+		size := 0
+		imgType := ImageTypeContainer
+		var names []string
+		for fName, contents := range img.Files {
+			size += len(contents)
+			names = append(names, fName)
+			if imageCompressionOf(fName) == CompressionQcow2 {
+				imgType = ImageTypeVM
+			}
+		}
+		sort.Strings(names)
+		var aliases []ImageAlias
+		for _, alias := range img.Aliases {
+			aliases = append(aliases, ImageAlias{Name: alias})
+		}
+		props := map[string]string{"architecture": "x86_64", "os": img.OS, "release": img.Release}
+		for key, val := range img.Properties {
+			props[key] = val
+		}
+		outputs = append(outputs, ImageOutput{
+			Public:      img.Public,
+			AutoUpdate:  img.AutoUpdate,
+			Cached:      img.Cached,
+			Aliases:     aliases,
+			Props:       ImageProperties{Architecture: "x86_64", OSType: img.OS, OSRelease: img.Release},
+			Properties:  props,
+			Filename:    names[0],
+			Fingerprint: img.Fingerprint,
+			Size:        size,
+			Type:        imgType,
+			Created:     img.Created,
+			LastUsed:    img.LastUsed,
+		})
+	}
+	sort.Slice(outputs, func(i, j int) bool { return outputs[i].Fingerprint < outputs[j].Fingerprint })
+	return outputs, nil
+}
+
+// UpdateImage replaces the Properties, Public and AutoUpdate of a FakeImage
+func (fb *FakeBackend) UpdateImage(ctx context.Context, fingerprint string, update ImageUpdate) error {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if err := fb.call(ctx, "UpdateImage", fingerprint); err != nil {
+		return err
+	}
+	img, err := fb.fingerprintImage(fingerprint)
+	if err != nil {
+		return err
+	}
+	img.Properties = map[string]string{}
+	for key, val := range update.Properties {
+		img.Properties[key] = val
+	}
+	img.Public, img.AutoUpdate = update.Public, update.AutoUpdate
+	return nil
+}
+
+// AddImageAlias points alias at a FakeImage
+func (fb *FakeBackend) AddImageAlias(ctx context.Context, alias string, fingerprint string, description string) error {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if err := fb.call(ctx, "AddImageAlias", alias, fingerprint); err != nil {
+		return err
+	}
+	if fb.aliasImage(alias) != nil {
+		return &LXDError{http.StatusConflict, "Alias already exists"}
+	}
+	img, err := fb.fingerprintImage(fingerprint)
+	if err != nil {
+		return err
+	}
+	img.Aliases = append(img.Aliases, alias)
+	return nil
+}
+
+// DeleteImageAlias removes alias from its FakeImage
+func (fb *FakeBackend) DeleteImageAlias(ctx context.Context, alias string) error {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if err := fb.call(ctx, "DeleteImageAlias", alias); err != nil {
+		return err
+	}
+	img := fb.aliasImage(alias)
+	if img == nil {
+		return &LXDError{http.StatusNotFound, "Alias not found"}
+	}
+	for ind, name := range img.Aliases {
+		if name == alias {
+			img.Aliases = append(img.Aliases[:ind], img.Aliases[ind+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// aliasImage returns the FakeImage alias points at, if any
+func (fb *FakeBackend) aliasImage(alias string) *FakeImage {
+	for _, img := range fb.StoredImages {
+		for _, name := range img.Aliases {
+			if name == alias {
+				return img
+			}
+		}
+	}
+	return nil
+}
+
+// RefreshImage checks a FakeImage exists, FakeImages are never cached from a remote so none are refreshed
+func (fb *FakeBackend) RefreshImage(ctx context.Context, fingerprint string) (bool, error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if err := fb.call(ctx, "RefreshImage", fingerprint); err != nil {
+		return false, err
+	}
+	_, err := fb.fingerprintImage(fingerprint)
+	return false, err
+}
+
+// AddRemote registers a simplestreams image server as a FakeRemote
+func (fb *FakeBackend) AddRemote(ctx context.Context, name string, server string, certificate string) error {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if err := fb.call(ctx, "AddRemote", name, server); err != nil {
+		return err
+	}
+	if current, ok := fb.Remotes[name]; ok && current.Server != server {
+		return fmt.Errorf("remote %s exists as <%s>", name, fb.Remotes[name].Server)
+	}
+	fb.Remotes[name] = FakeRemote{server, certificate}
+	return nil
+}
+
+// pullImage downloads the newest version of the product aliased alias from a FakeRemote's simplestreams
+// products, checks the sha256 of every file and caches it as a FakeImage
+func (fb *FakeBackend) pullImage(ctx context.Context, remote FakeRemote, alias string) (*FakeImage, error) {
+	client := &http.Client{Timeout: time.Minute}
+	if remote.Certificate != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(remote.Certificate)) {
+			return nil, errors.New("invalid remote certificate")
+		}
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+	get := func(path string) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(remote.Server, "/")+"/"+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, &LXDError{resp.StatusCode, "Failed to fetch " + path}
+		}
+		return ioutil.ReadAll(resp.Body)
+	}
+	body, err := get("streams/v1/images.json")
+	if err != nil {
+		return nil, err
+	}
+	var products simplestreamsProducts
+	if err = json.Unmarshal(body, &products); err != nil {
+		return nil, err
+	}
+	var newest string
+	var items map[string]simplestreamsItem
+	for _, product := range products.Products {
+		for _, name := range strings.Split(product.Aliases, ",") {
+			if name != alias {
+				continue
+			}
+			for version, ver := range product.Versions {
+				if version > newest {
+					newest, items = version, ver.Items
+				}
+			}
+		}
+	}
+	if items == nil {
+		return nil, &LXDError{http.StatusNotFound, "The requested image couldn't be found"}
+	}
+	var names []string
+	var contents [][]byte
+	for _, item := range items {
+		data, err := get(item.Path)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != item.SHA256 {
+			return nil, fmt.Errorf("image file %s has the wrong sha256", item.Path)
+		}
+		meta := item.CombinedSquashFS != "" || item.CombinedDiskKVM != ""
+		names = append(names, imageFileName("{{fingerprint}}", meta, imageCompressionOf(item.Path)))
+		contents = append(contents, data)
+	}
+	img := fb.addImage(names, contents, "")
+	img.Cached = true
+	return img, nil
+}
+
+// DeleteImage deletes a FakeImage by its fingerprint
+func (fb *FakeBackend) DeleteImage(ctx context.Context, fingerprint string) error {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if err := fb.call(ctx, "DeleteImage", fingerprint); err != nil {
+		return err
+	}
+	img, err := fb.fingerprintImage(fingerprint)
+	if err != nil {
+		return err
+	}
+	delete(fb.StoredImages, img.Fingerprint)
+	return nil
+}
+
+// ImportImage stores a unified image tarball, or a split image's metadata and rootfs, as a FakeImage
+func (fb *FakeBackend) ImportImage(ctx context.Context, metadata io.Reader, rootfs io.Reader, alias string) (string, error) {
+	fb.mu.Lock()
+	err := fb.call(ctx, "ImportImage", alias)
+	fb.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	readers := []io.Reader{metadata}
+	if rootfs != nil {
+		readers = append(readers, rootfs)
+	}
+	var names []string
+	var contents [][]byte
+	for _, r := range readers {
+		fContents, err := ioutil.ReadAll(r)
+		if err != nil {
+			return "", err
+		}
+		names = append(names, imageFileName("{{fingerprint}}", rootfs != nil && len(names) == 0, detectImageCompression(fContents)))
+		contents = append(contents, fContents)
+	}
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	img := fb.addImage(names, contents, alias)
+	return img.Fingerprint, nil
+}
+
+// ExportImage streams the files of a FakeImage to part
+func (fb *FakeBackend) ExportImage(ctx context.Context, name string, part ImagePartFunc) error {
+	fb.mu.Lock()
+	if err := fb.call(ctx, "ExportImage", name); err != nil {
+		fb.mu.Unlock()
+		return err
+	}
+	img, err := fb.image(name)
+	if err != nil {
+		fb.mu.Unlock()
+		return err
+	}
+	files := map[string][]byte{}
+	var names []string
+	for fName, contents := range img.Files {
+		files[fName] = contents
+		names = append(names, fName)
+	}
+	fb.mu.Unlock()
+	sortImageParts(names)
+	for _, fName := range names {
+		if err = part(fName, bytes.NewReader(files[fName])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestFakeBackend
+func TestFakeBackend(t *testing.T) {
+	defaultInterval := pollInterval
+	pollInterval = time.Millisecond
+	defer func() { pollInterval = defaultInterval }()
+	t.Run("SlowBoot", testFakeSlowBoot)
+	t.Run("EmptyLeases", testFakeEmptyLeases)
+	t.Run("RestoreSnapshot", testFakeRestoreSnapshot)
+	t.Run("Strict", testFakeStrict)
+}
+
+// testFakeSlowBoot
+func testFakeSlowBoot(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testFakeSlowBoot...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("fault injection needs the FakeBackend")
+	}
+	fake.BootChecks = 3
+	err := goCluster.CreateContainer(&Auth{}, true, "SlowBootTest", "ubuntu", "xenial", []byte{})
+	if err != nil {
+		t.Fatalf("Error Creating Slow Boot Container: %v", err)
+	}
+	checks := 0
+	for _, argv := range fake.Containers["SlowBootTest"].Execs {
+		if argv[len(argv)-1] == "systemctl is-system-running" {
+			checks++
+		}
+	}
+	if checks != 4 {
+		t.Errorf("Expected 4 boot checks, got %d", checks)
+	}
+	fmt.Println("<-----------testFakeSlowBoot COMPLETE")
+}
+
+// testFakeEmptyLeases
+func testFakeEmptyLeases(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testFakeEmptyLeases...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("fault injection needs the FakeBackend")
+	}
+	fakeCon := fake.AddContainer("LeaseTest", "ubuntu", "focal")
+	fake.EmptyLeases = 2
+	goCon := &GoContainer{Name: "LeaseTest"}
+	goCon.SetBackend(fake)
+	if err := goCon.loadNetworkData(context.Background(), "lxdbr0"); err != nil {
+		t.Fatalf("Error Loading Lease Test Network: %v", err)
+	}
+	if goCon.Network.PrivateIP != fakeCon.Address {
+		t.Errorf("Expected PrivateIP %s, got %q", fakeCon.Address, goCon.Network.PrivateIP)
+	}
+	if calls := fake.CallCount("Leases"); calls != 3 {
+		t.Errorf("Expected 3 lease lookups, got %d", calls)
+	}
+	if _, err := goCluster.GetContainer("LeaseTest"); err != nil {
+		t.Errorf("Error Getting Lease Test Container: %v", err)
+	}
+	fmt.Println("<-----------testFakeEmptyLeases COMPLETE")
+}
+
+// testFakeRestoreSnapshot
+func testFakeRestoreSnapshot(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testFakeRestoreSnapshot...")
+	_, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("file contents need the FakeBackend")
+	}
+	fakeCon := fake.AddContainer("RestoreTest", "ubuntu", "focal")
+	goCon := &GoContainer{Name: "RestoreTest"}
+	goCon.SetBackend(fake)
+	snapName, err := goCon.CreateSnapshot()
+	if err != nil {
+		t.Fatalf("Error Creating Restore Test Snapshot: %v", err)
+	}
+	fakeCon.Files["/etc/hostname"] = []byte("changed\n")
+	if err = goCon.Restore(snapName); err != nil {
+		t.Fatalf("Error Restoring Test Snapshot: %v", err)
+	}
+	out, err := goCon.CMD("cat /etc/hostname", "", true)
+	if err != nil {
+		t.Fatalf("Error Reading Restored Hostname: %v", err)
+	}
+	if string(out) != "RestoreTest\n" {
+		t.Errorf("Expected the restored hostname, got %q", string(out))
+	}
+	fmt.Println("<-----------testFakeRestoreSnapshot COMPLETE")
+}
+
+// testFakeStrict
+func testFakeStrict(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testFakeStrict...")
+	fake := NewFakeBackend()
+	ctx := context.Background()
+	fake.AddContainer("StrictTest", "ubuntu", "focal")
+	fmt.Println("----------->BEGINNING A: Executing Argv As Given...")
+	out, _, err := fake.Exec(ctx, "StrictTest", []string{"echo", `"a`, `b"`})
+	if err != nil || string(out) != "\"a b\"\n" {
+		t.Errorf("Expected Argv To Reach echo Unparsed, Got %q %v", out, err)
+	}
+	var cmdErr *CommandError
+	if _, _, err = fake.Exec(ctx, "StrictTest", []string{"pwd && echo"}); !errors.As(err, &cmdErr) || cmdErr.ExitCode != 127 {
+		t.Errorf("Expected A Script Executed Without A Shell To Be Not Found, Got %v", err)
+	}
+	if out, _, err = fake.Exec(ctx, "StrictTest", []string{"sh", "-c", `echo 'a  b' "c;d" && echo e\ f`}); err != nil || string(out) != "a  b c;d\ne f\n" {
+		t.Errorf("Expected sh -c To Honour Quotes, Got %q %v", out, err)
+	}
+	fmt.Println("----------->PASSED A: Executing Argv As Given...")
+	fmt.Println("----------->BEGINNING B: Deleting Images By Fingerprint Only...")
+	tarball, err := fakeImageTarball("ubuntu", "focal", nil)
+	if err != nil {
+		t.Fatalf("Error Building Fake Image: %v", err)
+	}
+	fingerprint, err := fake.ImportImage(ctx, bytes.NewReader(tarball), nil, "strict")
+	if err != nil {
+		t.Fatalf("Error Importing Fake Image: %v", err)
+	}
+	if err = fake.DeleteImage(ctx, "strict"); !isNotFound(err) {
+		t.Errorf("Expected Deleting By Alias To Be Not Found, Got %v", err)
+	}
+	if err = fake.DeleteImage(ctx, fingerprint[:8]); err != nil {
+		t.Errorf("Error Deleting By Fingerprint Prefix: %v", err)
+	}
+	fmt.Println("----------->PASSED B: Deleting Images By Fingerprint Only...")
+	fmt.Println("<-----------testFakeStrict COMPLETE")
+}
@@ -0,0 +1,305 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// ForwardType is how a Forward's connections reach their target
+type ForwardType string
+
+const (
+	ForwardLocal  ForwardType = "local"  // a local listener whose connections are dialed from the container
+	ForwardRemote ForwardType = "remote" // a container listener whose connections are dialed from the local host
+	ForwardSOCKS  ForwardType = "socks"  // a local SOCKS5 proxy whose connections are dialed from the container
+)
+
+// Forward is a TCP port forward, or SOCKS5 proxy, carried by an SSHClient
+type Forward struct {
+	Type       ForwardType
+	ListenAddr string
+	TargetAddr string
+	client     *SSHClient
+	listener   net.Listener
+	dial       func(network string, addr string) (net.Conn, error)
+	mu         sync.Mutex
+	conns      map[net.Conn]struct{}
+	closed     bool
+}
+
+// newForward creates a pointer to a new Forward serving the connections of listener
+func newForward(sc *SSHClient, fType ForwardType, targetAddr string, listener net.Listener, dial func(string, string) (net.Conn, error)) *Forward {
+	return &Forward{
+		Type:       fType,
+		ListenAddr: listener.Addr().String(),
+		TargetAddr: targetAddr,
+		client:     sc,
+		listener:   listener,
+		dial:       dial,
+		conns:      map[net.Conn]struct{}{},
+	}
+}
+
+// LocalForward listens on the local localAddr and forwards its connections to remoteAddr as dialed from the container
+func (sc *SSHClient) LocalForward(localAddr string, remoteAddr string) (*Forward, error) {
+	if sc.SSHConn == nil {
+		return nil, errors.New("the SSHClient is not connected")
+	}
+	listener, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, err
+	}
+	return sc.addForward(newForward(sc, ForwardLocal, remoteAddr, listener, sc.SSHConn.Dial))
+}
+
+// RemoteForward listens on remoteAddr inside the container and forwards its connections to the local localAddr
+func (sc *SSHClient) RemoteForward(remoteAddr string, localAddr string) (*Forward, error) {
+	if sc.SSHConn == nil {
+		return nil, errors.New("the SSHClient is not connected")
+	}
+	listener, err := sc.SSHConn.Listen("tcp", remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	return sc.addForward(newForward(sc, ForwardRemote, localAddr, listener, net.Dial))
+}
+
+// SOCKSProxy runs a SOCKS5 proxy on the local localAddr whose connections are dialed from the container
+func (sc *SSHClient) SOCKSProxy(localAddr string) (*Forward, error) {
+	if sc.SSHConn == nil {
+		return nil, errors.New("the SSHClient is not connected")
+	}
+	listener, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, err
+	}
+	return sc.addForward(newForward(sc, ForwardSOCKS, "", listener, sc.SSHConn.Dial))
+}
+
+// Forwards returns the open Forwards of the SSHClient
+func (sc *SSHClient) Forwards() []*Forward {
+	sc.forwardMu.Lock()
+	defer sc.forwardMu.Unlock()
+	return append([]*Forward{}, sc.forwards...)
+}
+
+// addForward tracks and starts serving a Forward
+func (sc *SSHClient) addForward(fw *Forward) (*Forward, error) {
+	sc.forwardMu.Lock()
+	sc.forwards = append(sc.forwards, fw)
+	sc.forwardMu.Unlock()
+	go fw.serve()
+	return fw, nil
+}
+
+// removeForward stops tracking a Forward
+func (sc *SSHClient) removeForward(fw *Forward) {
+	sc.forwardMu.Lock()
+	defer sc.forwardMu.Unlock()
+	for i, open := range sc.forwards {
+		if open == fw {
+			sc.forwards = append(sc.forwards[:i], sc.forwards[i+1:]...)
+			return
+		}
+	}
+}
+
+// closeForwards closes every open Forward of the SSHClient
+func (sc *SSHClient) closeForwards() {
+	for _, fw := range sc.Forwards() {
+		_ = fw.Close()
+	}
+}
+
+// Close stops the Forward's listener and closes the connections it is carrying
+func (fw *Forward) Close() error {
+	fw.mu.Lock()
+	if fw.closed {
+		fw.mu.Unlock()
+		return nil
+	}
+	fw.closed = true
+	for conn := range fw.conns {
+		_ = conn.Close()
+	}
+	fw.conns = map[net.Conn]struct{}{}
+	fw.mu.Unlock()
+	fw.client.removeForward(fw)
+	return fw.listener.Close()
+}
+
+// track adds a connection to be closed with the Forward, closing it instead if the Forward already is
+func (fw *Forward) track(conn net.Conn) bool {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if fw.closed {
+		_ = conn.Close()
+		return false
+	}
+	fw.conns[conn] = struct{}{}
+	return true
+}
+
+// untrack closes a connection and forgets it
+func (fw *Forward) untrack(conn net.Conn) {
+	fw.mu.Lock()
+	delete(fw.conns, conn)
+	fw.mu.Unlock()
+	_ = conn.Close()
+}
+
+// serve accepts connections until the Forward's listener is closed
+func (fw *Forward) serve() {
+	for {
+		conn, err := fw.listener.Accept()
+		if err != nil {
+			return
+		}
+		if fw.track(conn) {
+			go fw.handle(conn)
+		}
+	}
+}
+
+// handle dials the target of an accepted connection and copies between the two until both sides are done
+func (fw *Forward) handle(conn net.Conn) {
+	defer fw.untrack(conn)
+	targetAddr := fw.TargetAddr
+	if fw.Type == ForwardSOCKS {
+		var err error
+		if targetAddr, err = socksHandshake(conn); err != nil {
+			return
+		}
+	}
+	target, err := fw.dial("tcp", targetAddr)
+	if fw.Type == ForwardSOCKS && err != nil {
+		_ = socksReply(conn, socksHostUnreachable)
+	} else if fw.Type == ForwardSOCKS {
+		if err = socksReply(conn, socksSucceeded); err != nil {
+			_ = target.Close()
+		}
+	}
+	if err != nil || !fw.track(target) {
+		return
+	}
+	defer fw.untrack(target)
+	done := make(chan struct{})
+	go func() {
+		pipeConn(target, conn)
+		close(done)
+	}()
+	pipeConn(conn, target)
+	<-done
+}
+
+// pipeConn copies src to dst, then closes dst for writing so its peer sees the end of the stream
+func pipeConn(dst net.Conn, src net.Conn) {
+	_, _ = io.Copy(dst, src)
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+	} else {
+		_ = dst.Close()
+	}
+}
+
+// SOCKS5 protocol values, see RFC 1928
+const (
+	socksVersion         = 5
+	socksNoAuth          = 0
+	socksNoAcceptable    = 0xff
+	socksConnect         = 1
+	socksIPv4            = 1
+	socksDomain          = 3
+	socksIPv6            = 4
+	socksSucceeded       = 0
+	socksHostUnreachable = 4
+	socksCMDUnsupported  = 7
+	socksATYPUnsupported = 8
+)
+
+// socksHandshake negotiates an unauthenticated SOCKS5 CONNECT and returns the requested address
+func socksHandshake(conn net.Conn) (string, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return "", err
+	}
+	if head[0] != socksVersion {
+		return "", errors.New("unsupported SOCKS version " + strconv.Itoa(int(head[0])))
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+	method := byte(socksNoAcceptable)
+	for _, m := range methods {
+		if m == socksNoAuth {
+			method = socksNoAuth
+		}
+	}
+	if _, err := conn.Write([]byte{socksVersion, method}); err != nil {
+		return "", err
+	}
+	if method == socksNoAcceptable {
+		return "", errors.New("the SOCKS client offered no supported authentication method")
+	}
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return "", err
+	}
+	if req[1] != socksConnect {
+		_ = socksReply(conn, socksCMDUnsupported)
+		return "", errors.New("unsupported SOCKS command " + strconv.Itoa(int(req[1])))
+	}
+	var host string
+	switch req[3] {
+	case socksIPv4, socksIPv6:
+		ip := make([]byte, net.IPv4len)
+		if req[3] == socksIPv6 {
+			ip = make([]byte, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case socksDomain:
+		size := make([]byte, 1)
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return "", err
+		}
+		domain := make([]byte, size[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		_ = socksReply(conn, socksATYPUnsupported)
+		return "", errors.New("unsupported SOCKS address type " + strconv.Itoa(int(req[3])))
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// socksReply sends a SOCKS5 reply without a bound address
+func socksReply(conn net.Conn, reply byte) error {
+	_, err := conn.Write([]byte{socksVersion, reply, 0, socksIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
@@ -0,0 +1,324 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// serveTestGlobalRequests listens on the test host for tcpip-forward requests, opening a forwarded-tcpip channel
+// for each connection accepted
+func serveTestGlobalRequests(sConn *ssh.ServerConn, reqs <-chan *ssh.Request) {
+	var mu sync.Mutex
+	listeners := map[string]net.Listener{}
+	for req := range reqs {
+		var fwd struct {
+			Addr string
+			Port uint32
+		}
+		switch req.Type {
+		case "tcpip-forward":
+			_ = ssh.Unmarshal(req.Payload, &fwd)
+			listener, err := net.Listen("tcp", net.JoinHostPort(fwd.Addr, strconv.Itoa(int(fwd.Port))))
+			if err != nil {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			port := uint32(listener.Addr().(*net.TCPAddr).Port)
+			mu.Lock()
+			listeners[net.JoinHostPort(fwd.Addr, strconv.Itoa(int(port)))] = listener
+			mu.Unlock()
+			_ = req.Reply(true, ssh.Marshal(struct{ Port uint32 }{port}))
+			go func(addr string) {
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					origin := conn.RemoteAddr().(*net.TCPAddr)
+					payload := ssh.Marshal(struct {
+						Addr       string
+						Port       uint32
+						OriginAddr string
+						OriginPort uint32
+					}{addr, port, origin.IP.String(), uint32(origin.Port)})
+					channel, chReqs, err := sConn.OpenChannel("forwarded-tcpip", payload)
+					if err != nil {
+						_ = conn.Close()
+						continue
+					}
+					go ssh.DiscardRequests(chReqs)
+					go pipeTestConn(conn, channel)
+				}
+			}(fwd.Addr)
+		case "cancel-tcpip-forward":
+			_ = ssh.Unmarshal(req.Payload, &fwd)
+			key := net.JoinHostPort(fwd.Addr, strconv.Itoa(int(fwd.Port)))
+			mu.Lock()
+			listener, ok := listeners[key]
+			delete(listeners, key)
+			mu.Unlock()
+			if ok {
+				_ = listener.Close()
+			}
+			_ = req.Reply(ok, nil)
+		default:
+			if req.WantReply {
+				_ = req.Reply(false, nil)
+			}
+		}
+	}
+	mu.Lock()
+	for _, listener := range listeners {
+		_ = listener.Close()
+	}
+	mu.Unlock()
+}
+
+// serveTestDirectTCPIP dials the target of a direct-tcpip channel from the test host
+func serveTestDirectTCPIP(newChan ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChan.ExtraData(), &target); err != nil {
+		_ = newChan.Reject(ssh.Prohibited, err.Error())
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+	if err != nil {
+		_ = newChan.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, reqs, err := newChan.Accept()
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	pipeTestConn(conn, channel)
+}
+
+// pipeTestConn copies between a connection and a channel until both sides are done, then closes them
+func pipeTestConn(conn net.Conn, channel ssh.Channel) {
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(channel, conn)
+		_ = channel.CloseWrite()
+		close(done)
+	}()
+	_, _ = io.Copy(conn, channel)
+	_ = conn.(*net.TCPConn).CloseWrite()
+	<-done
+	_ = conn.Close()
+	_ = channel.Close()
+}
+
+// startTestEchoServer serves TCP connections on 127.0.0.1 that echo back what they read and returns its address
+func startTestEchoServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error Starting Test Echo Server: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(conn, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// checkTestEcho sends a message over a connection to a test echo server and checks it comes back
+func checkTestEcho(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	msg := []byte("hello through the container\n")
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatalf("Error Writing To Forward: %v", err)
+	}
+	got := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, got); err != nil || !bytes.Equal(got, msg) {
+		t.Fatalf("Expected %q From Forward, Got %q %v", msg, got, err)
+	}
+}
+
+// checkTestForwardClosed checks a Forward no longer accepts connections and is no longer listed
+func checkTestForwardClosed(t *testing.T, sshClient *SSHClient, fw *Forward) {
+	if len(sshClient.Forwards()) != 0 {
+		t.Errorf("Expected No Open Forwards, Got %v", sshClient.Forwards())
+	}
+	if conn, err := net.DialTimeout("tcp", fw.ListenAddr, time.Second); err == nil {
+		_ = conn.Close()
+		t.Errorf("Closed Forward %s Still Accepting Connections", fw.ListenAddr)
+	}
+}
+
+// TestForward
+func TestForward(t *testing.T) {
+	if testLXD() {
+		t.Skip("the test SSH server forwards to the test host")
+	}
+	t.Run("Local", testForwardLocal)
+	t.Run("Remote", testForwardRemote)
+	t.Run("SOCKS", testForwardSOCKS)
+	t.Run("CloseClient", testForwardCloseClient)
+}
+
+// testForwardLocal
+func testForwardLocal(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testForwardLocal...")
+	sshClient := startTestSSHClient(t)
+	echoAddr := startTestEchoServer(t)
+	fw, err := sshClient.LocalForward("127.0.0.1:0", echoAddr)
+	if err != nil {
+		t.Fatalf("Error Opening Local Forward: %v", err)
+	}
+	if fws := sshClient.Forwards(); len(fws) != 1 || fws[0] != fw || fw.Type != ForwardLocal || fw.TargetAddr != echoAddr {
+		t.Errorf("Unexpected Forwards: %v", fws)
+	}
+	conn, err := net.Dial("tcp", fw.ListenAddr)
+	if err != nil {
+		t.Fatalf("Error Dialing Local Forward: %v", err)
+	}
+	checkTestEcho(t, conn)
+	if err = fw.Close(); err != nil {
+		t.Errorf("Error Closing Local Forward: %v", err)
+	}
+	checkTestForwardClosed(t, sshClient, fw)
+	fmt.Println("<-----------testForwardLocal COMPLETE")
+}
+
+// testForwardRemote
+func testForwardRemote(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testForwardRemote...")
+	sshClient := startTestSSHClient(t)
+	echoAddr := startTestEchoServer(t)
+	fw, err := sshClient.RemoteForward("127.0.0.1:0", echoAddr)
+	if err != nil {
+		t.Fatalf("Error Opening Remote Forward: %v", err)
+	}
+	if fw.Type != ForwardRemote || fw.ListenAddr == "127.0.0.1:0" {
+		t.Errorf("Unexpected Remote Forward: %v", fw)
+	}
+	conn, err := net.Dial("tcp", fw.ListenAddr)
+	if err != nil {
+		t.Fatalf("Error Dialing Remote Forward: %v", err)
+	}
+	checkTestEcho(t, conn)
+	if err = fw.Close(); err != nil {
+		t.Errorf("Error Closing Remote Forward: %v", err)
+	}
+	checkTestForwardClosed(t, sshClient, fw)
+	fmt.Println("<-----------testForwardRemote COMPLETE")
+}
+
+// testForwardSOCKS
+func testForwardSOCKS(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testForwardSOCKS...")
+	sshClient := startTestSSHClient(t)
+	echoAddr := startTestEchoServer(t)
+	fw, err := sshClient.SOCKSProxy("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error Opening SOCKS Proxy: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(echoAddr)
+	portNum, _ := strconv.Atoi(port)
+	socksRequest := func(cmd byte) (net.Conn, []byte) {
+		conn, err := net.Dial("tcp", fw.ListenAddr)
+		if err != nil {
+			t.Fatalf("Error Dialing SOCKS Proxy: %v", err)
+		}
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		host := "localhost"
+		req := []byte{5, 1, 0, 5, cmd, 0, 3, byte(len(host))}
+		req = append(append(req, host...), byte(portNum>>8), byte(portNum))
+		if _, err = conn.Write(req); err != nil {
+			t.Fatalf("Error Writing SOCKS Request: %v", err)
+		}
+		resp := make([]byte, 12)
+		if _, err = io.ReadFull(conn, resp); err != nil {
+			t.Fatalf("Error Reading SOCKS Reply: %v", err)
+		}
+		_ = conn.SetDeadline(time.Time{})
+		return conn, resp
+	}
+	conn, resp := socksRequest(1)
+	if !bytes.Equal(resp[:4], []byte{5, 0, 5, 0}) {
+		t.Fatalf("Unexpected SOCKS Reply: %v", resp)
+	}
+	checkTestEcho(t, conn)
+	conn, resp = socksRequest(2)
+	_ = conn.Close()
+	if resp[3] != 7 {
+		t.Errorf("Expected A Command Not Supported Reply, Got %v", resp)
+	}
+	if err = fw.Close(); err != nil {
+		t.Errorf("Error Closing SOCKS Proxy: %v", err)
+	}
+	checkTestForwardClosed(t, sshClient, fw)
+	fmt.Println("<-----------testForwardSOCKS COMPLETE")
+}
+
+// testForwardCloseClient
+func testForwardCloseClient(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testForwardCloseClient...")
+	sshClient := startTestSSHClient(t)
+	echoAddr := startTestEchoServer(t)
+	local, err := sshClient.LocalForward("127.0.0.1:0", echoAddr)
+	if err != nil {
+		t.Fatalf("Error Opening Local Forward: %v", err)
+	}
+	if _, err = sshClient.RemoteForward("127.0.0.1:0", echoAddr); err != nil {
+		t.Fatalf("Error Opening Remote Forward: %v", err)
+	}
+	conn, err := net.Dial("tcp", local.ListenAddr)
+	if err != nil {
+		t.Fatalf("Error Dialing Local Forward: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err = conn.Write([]byte("x")); err != nil {
+		t.Fatalf("Error Writing To Forward: %v", err)
+	}
+	if _, err = io.ReadFull(conn, make([]byte, 1)); err != nil {
+		t.Fatalf("Error Reading From Forward: %v", err)
+	}
+	if len(sshClient.Forwards()) != 2 {
+		t.Errorf("Expected 2 Open Forwards, Got %v", sshClient.Forwards())
+	}
+	_ = sshClient.Close()
+	checkTestForwardClosed(t, sshClient, local)
+	if _, err = conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Expected The Forwarded Connection To Close, Got %v", err)
+	}
+	fmt.Println("<-----------testForwardCloseClient COMPLETE")
+}
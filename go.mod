@@ -4,5 +4,7 @@ go 1.14
 
 require (
 	github.com/gofrs/uuid v4.0.0+incompatible
+	github.com/pkg/sftp v1.13.0
 	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,503 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestImageStreaming
+func TestImageStreaming(t *testing.T) {
+	t.Run("ExportTo", testImageExportTo)
+	t.Run("ExportContainerTo", testImageExportContainerTo)
+	t.Run("SplitParts", testImageSplitParts)
+	t.Run("ImportFrom", testImageImportFrom)
+	t.Run("ImportMismatch", testImageImportMismatch)
+	t.Run("Formats", testImageFormats)
+	t.Run("Verification", testImageVerification)
+}
+
+// testImageExportTo
+func testImageExportTo(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testImageExportTo...")
+	goCluster, _ := newTestCluster("")
+	if err := goCluster.CreateContainer(NewAuth("tester", AuthPassword, "l0lThis1sAWeak1", "", "22"), false, "StreamTest", "ubuntu", "focal", []byte{}); err != nil {
+		t.Fatalf("Error Creating Stream Test Container: %v", err)
+	}
+	defer goCluster.DeleteContainer("StreamTest")
+	goCon, err := goCluster.GetContainer("StreamTest")
+	if err != nil {
+		t.Fatalf("Error Getting Stream Test Container: %v", err)
+	}
+	img, err := goCon.Image("")
+	if err != nil {
+		t.Fatalf("Error Publishing Stream Test Image: %v", err)
+	}
+	defer goCluster.DeleteImage(img.Fingerprint)
+	var streamed bytes.Buffer
+	if err = img.ExportTo(&streamed); err != nil {
+		t.Fatalf("Error Streaming Image: %v", err)
+	}
+	if len(img.Contents) != 0 {
+		t.Errorf("Expected ExportTo To Leave Contents Empty")
+	}
+	if err = img.Export(); err != nil || len(img.Contents) != 1 || !bytes.Equal(img.Contents[0], streamed.Bytes()) {
+		t.Errorf("Expected Export To Load The Streamed Tarball Into Contents: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = img.ExportToContext(ctx, ioutil.Discard); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, Got %v", err)
+	}
+	failed := errors.New("disk full")
+	err = img.ExportParts(func(fileName string, r io.Reader) error { return failed })
+	if !errors.Is(err, failed) {
+		t.Errorf("Expected The Part Error, Got %v", err)
+	}
+	fmt.Println("<-----------testImageExportTo COMPLETE")
+}
+
+// testImageExportContainerTo
+func testImageExportContainerTo(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testImageExportContainerTo...")
+	goCluster, fake := newTestCluster("")
+	if err := goCluster.CreateContainer(NewAuth("tester", AuthPassword, "l0lThis1sAWeak1", "", "22"), false, "StreamTest", "ubuntu", "focal", []byte{}); err != nil {
+		t.Fatalf("Error Creating Stream Test Container: %v", err)
+	}
+	defer goCluster.DeleteContainer("StreamTest")
+	pr, pw := io.Pipe()
+	names := make(chan []string, 1)
+	go func() {
+		var fNames []string
+		gr, err := gzip.NewReader(pr)
+		if err == nil {
+			tr := tar.NewReader(gr)
+			for hdr, err := tr.Next(); err == nil; hdr, err = tr.Next() {
+				fNames = append(fNames, hdr.Name)
+			}
+		}
+		_, _ = io.Copy(ioutil.Discard, pr)
+		names <- fNames
+	}()
+	reImg, err := goCluster.ExportContainerTo("StreamTest", pw)
+	_ = pw.Close()
+	if err != nil {
+		t.Fatalf("Error Streaming Container Export: %v", err)
+	}
+	fNames := <-names
+	hasMetadata := false
+	for _, fName := range fNames {
+		hasMetadata = hasMetadata || fName == "metadata.yaml"
+	}
+	if !hasMetadata || len(reImg.Contents) != 0 {
+		t.Errorf("Expected A Streamed Image Tarball With metadata.yaml, Got %v", fNames)
+	}
+	if fake != nil && len(fake.StoredImages) != 0 {
+		t.Errorf("Expected The Exported Image To Be Deleted From The Host")
+	}
+	fmt.Println("<-----------testImageExportContainerTo COMPLETE")
+}
+
+// testImageSplitParts
+func testImageSplitParts(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testImageSplitParts...")
+	_, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("the split test image needs the FakeBackend")
+	}
+	fake.mu.Lock()
+	split := fake.addImage([]string{"{{fingerprint}}.squashfs", "meta-{{fingerprint}}.tar.xz"},
+		[][]byte{[]byte("rootfs"), []byte("metadata")}, "split")
+	fake.mu.Unlock()
+	img := NewGoImage("split", "Container", split.Fingerprint, "")
+	img.SetBackend(fake)
+	var streamed bytes.Buffer
+	if err := img.ExportTo(&streamed); !errors.Is(err, ErrSplitImage) || streamed.Len() != 0 {
+		t.Errorf("Expected ErrSplitImage Before Anything Is Written, Got %v %q", err, streamed.String())
+	}
+	var parts []string
+	err := img.ExportParts(func(fileName string, r io.Reader) error {
+		contents, err := ioutil.ReadAll(r)
+		parts = append(parts, fileName+"="+string(contents))
+		return err
+	})
+	expected := []string{"meta-" + split.Fingerprint + ".tar.xz=metadata", split.Fingerprint + ".squashfs=rootfs"}
+	if err != nil || fmt.Sprint(parts) != fmt.Sprint(expected) {
+		t.Errorf("Expected The Metadata Part First, Got %v %v", parts, err)
+	}
+	if err = img.Export(); err != nil || len(img.TarMeta) != 2 || string(img.Contents[1]) != "rootfs" {
+		t.Errorf("Expected Export To Load Both Parts, Got %v %v", img.TarMeta, err)
+	}
+	fmt.Println("<-----------testImageSplitParts COMPLETE")
+}
+
+// testImageImportFrom
+func testImageImportFrom(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testImageImportFrom...")
+	_, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("the import test images need the FakeBackend")
+	}
+	fmt.Println("----------->BEGINNING A: Import a unified image...")
+	tarball := []byte("unified image tarball")
+	sum := sha256.Sum256(tarball)
+	img := NewGoImage("unified", "Container", "", "")
+	img.SetBackend(fake)
+	fingerprint, err := img.ImportFrom(bytes.NewReader(tarball), nil)
+	if err != nil || fingerprint != hex.EncodeToString(sum[:]) {
+		t.Fatalf("Expected The Tarball's SHA-256 Fingerprint, Got %q %v", fingerprint, err)
+	}
+	if img.Fingerprint != fingerprint || img.Size != int64(len(tarball)) {
+		t.Errorf("Expected ImportFrom To Set Fingerprint And Size, Got %q %d", img.Fingerprint, img.Size)
+	}
+	if _, ok := fake.StoredImages[fingerprint]; !ok {
+		t.Errorf("Expected The Unified Image To Be Stored")
+	}
+	fmt.Println("----------->PASSED A: Import a unified image...")
+	fmt.Println("----------->BEGINNING B: Import a split image...")
+	hash := sha256.New()
+	hash.Write([]byte("metadata"))
+	hash.Write([]byte("rootfs"))
+	split := NewGoImage("split", "Container", hex.EncodeToString(hash.Sum(nil)), "")
+	split.Size = int64(len("metadata") + len("rootfs"))
+	split.SetBackend(fake)
+	if fingerprint, err = split.ImportFrom(bytes.NewReader([]byte("metadata")), bytes.NewReader([]byte("rootfs"))); err != nil {
+		t.Fatalf("Error Importing Split Image: %v", err)
+	}
+	if stored, ok := fake.StoredImages[fingerprint]; !ok || len(stored.Files) != 2 {
+		t.Errorf("Expected The Split Image To Be Stored In Two Parts")
+	}
+	fmt.Println("----------->PASSED B: Import a split image...")
+	fmt.Println("<-----------testImageImportFrom COMPLETE")
+}
+
+// testImageImportMismatch
+func testImageImportMismatch(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testImageImportMismatch...")
+	_, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("the import test images need the FakeBackend")
+	}
+	tarball := []byte("unified image tarball")
+	img := NewGoImage("sized", "Container", "", "")
+	img.Size = int64(len(tarball)) + 1
+	img.SetBackend(fake)
+	if _, err := img.ImportFrom(bytes.NewReader(tarball), nil); !errors.Is(err, ErrImageMismatch) {
+		t.Errorf("Expected ErrImageMismatch For A Short Image, Got %v", err)
+	}
+	img = NewGoImage("fingerprinted", "Container", hex.EncodeToString(make([]byte, sha256.Size)), "")
+	img.SetBackend(fake)
+	if _, err := img.ImportFrom(bytes.NewReader(tarball), nil); !errors.Is(err, ErrImageMismatch) {
+		t.Errorf("Expected ErrImageMismatch For The Wrong Fingerprint, Got %v", err)
+	}
+	if len(fake.StoredImages) != 0 {
+		t.Errorf("Expected Mismatching Images Not To Be Stored, Got %d", len(fake.StoredImages))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	img = NewGoImage("canceled", "Container", "", "")
+	img.SetBackend(fake)
+	if _, err := img.ImportFromContext(ctx, bytes.NewReader(tarball), nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, Got %v", err)
+	}
+	fmt.Println("<-----------testImageImportMismatch COMPLETE")
+}
+
+// testImageFormats
+func testImageFormats(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testImageFormats...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("the format test images need the FakeBackend")
+	}
+	gzipped := append([]byte{0x1f, 0x8b}, "tarball"...)
+	xzMeta := append([]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, "metadata"...)
+	squashfs := append([]byte("hsqs"), "rootfs"...)
+	qcow2 := append([]byte{'Q', 'F', 'I', 0xfb}, "disk"...)
+	tests := []struct {
+		name        string
+		contents    [][]byte
+		format      ImageFormat
+		compression ImageCompression
+		rootfs      ImageCompression
+		files       []string
+		vm          bool
+	}{
+		{"UnifiedGzip", [][]byte{gzipped}, ImageUnified, CompressionGzip, "", []string{".tar.gz"}, false},
+		{"UnifiedXZ", [][]byte{xzMeta}, ImageUnified, CompressionXZ, "", []string{".tar.xz"}, false},
+		{"SplitSquashFS", [][]byte{xzMeta, squashfs}, ImageSplit, CompressionXZ, CompressionSquashFS, []string{".tar.xz", ".squashfs"}, false},
+		{"SplitVM", [][]byte{xzMeta, qcow2}, ImageSplit, CompressionXZ, CompressionQcow2, []string{".tar.xz", ".qcow2"}, true},
+	}
+	for _, tt := range tests {
+		fmt.Println("----------->BEGINNING: " + tt.name + "...")
+		img := NewGoImage(tt.name, "", "", "")
+		img.SetBackend(fake)
+		var rootfs io.Reader
+		if len(tt.contents) == 2 {
+			rootfs = bytes.NewReader(tt.contents[1])
+		}
+		fingerprint, err := img.ImportFrom(bytes.NewReader(tt.contents[0]), rootfs)
+		if err != nil {
+			t.Fatalf("%s: Error Importing Image: %v", tt.name, err)
+		}
+		if img.Format != tt.format || img.Compression != tt.compression || img.Rootfs != tt.rootfs || img.IsVM() != tt.vm {
+			t.Errorf("%s: Expected Import To Detect %s/%s/%s, Got %s/%s/%s", tt.name, tt.format, tt.compression, tt.rootfs, img.Format, img.Compression, img.Rootfs)
+		}
+		exported := NewGoImage(tt.name, "", fingerprint, "")
+		exported.SetBackend(fake)
+		if err = exported.Export(); err != nil || len(exported.TarMeta) != len(tt.files) {
+			t.Fatalf("%s: Error Exporting Image: %v %v", tt.name, exported.TarMeta, err)
+		}
+		for ind, ext := range tt.files {
+			if !strings.HasSuffix(exported.TarMeta[ind], ext) || !bytes.Equal(exported.Contents[ind], tt.contents[ind]) {
+				t.Errorf("%s: Expected Exported File %d To Be The %s Part, Got %s", tt.name, ind, ext, exported.TarMeta[ind])
+			}
+		}
+		if exported.Format != tt.format || exported.Compression != tt.compression || exported.Rootfs != tt.rootfs || exported.IsVM() != tt.vm {
+			t.Errorf("%s: Expected Export To Detect %s/%s/%s, Got %s/%s/%s", tt.name, tt.format, tt.compression, tt.rootfs, exported.Format, exported.Compression, exported.Rootfs)
+		}
+		if err = goCluster.DeleteImage(fingerprint); err != nil {
+			t.Fatalf("%s: Error Deleting Image: %v", tt.name, err)
+		}
+		for i, j := 0, len(exported.Contents)-1; i < j; i, j = i+1, j-1 {
+			exported.TarMeta[i], exported.TarMeta[j] = exported.TarMeta[j], exported.TarMeta[i]
+			exported.Contents[i], exported.Contents[j] = exported.Contents[j], exported.Contents[i]
+		}
+		if err = exported.Import(); err != nil || exported.Fingerprint != fingerprint {
+			t.Errorf("%s: Expected The Exported Image To Import Back As %s, Got %s %v", tt.name, fingerprint, exported.Fingerprint, err)
+		}
+		fmt.Println("----------->PASSED: " + tt.name + "...")
+	}
+	img := NewGoImage("mismatch", "", "", "")
+	img.Format = ImageSplit
+	img.SetBackend(fake)
+	if _, err := img.ImportFrom(bytes.NewReader(gzipped), nil); err == nil {
+		t.Errorf("Expected A Split Image To Need A Rootfs")
+	}
+	fmt.Println("<-----------testImageFormats COMPLETE")
+}
+
+// testImageVerification
+func testImageVerification(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testImageVerification...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("tampering with a stored image needs the FakeBackend")
+	}
+	fmt.Println("----------->BEGINNING A: Parse lxc fingerprints...")
+	sum := sha256.Sum256([]byte("tarball"))
+	want := hex.EncodeToString(sum[:])
+	if fingerprint, err := parseFingerprint([]byte("Image imported with fingerprint: " + want + "\n")); err != nil || fingerprint != want {
+		t.Errorf("Expected The Reported Fingerprint, Got %q %v", fingerprint, err)
+	}
+	if fingerprint, err := parseFingerprint([]byte("Transferring image: 100%\n")); err == nil || fingerprint != "" {
+		t.Errorf("Expected An Error Without A Reported Fingerprint, Got %q", fingerprint)
+	}
+	fmt.Println("----------->PASSED A: Parse lxc fingerprints...")
+	fmt.Println("----------->BEGINNING B: Verify an exported image...")
+	fake.mu.Lock()
+	stored := fake.addImage([]string{"{{fingerprint}}.tar.gz"}, [][]byte{[]byte("tarball")}, "verified")
+	fake.mu.Unlock()
+	img := NewGoImage("verified", "Container", stored.Fingerprint, "")
+	img.SetBackend(fake)
+	if err := img.Export(); err != nil || img.Verified != want || img.Size != int64(len("tarball")) {
+		t.Fatalf("Expected Export To Verify %s, Got %q %d %v", want, img.Verified, img.Size, err)
+	}
+	fake.mu.Lock()
+	stored.Files[want+".tar.gz"] = []byte("tampered")
+	fake.mu.Unlock()
+	tampered := NewGoImage("verified", "Container", stored.Fingerprint, "")
+	tampered.SetBackend(fake)
+	if err := tampered.Export(); !errors.Is(err, ErrImageMismatch) || len(tampered.Contents) != 0 || tampered.Verified != "" {
+		t.Errorf("Expected Export To Refuse Tampered Content, Got %v", err)
+	}
+	if err := tampered.ExportTo(ioutil.Discard); !errors.Is(err, ErrImageMismatch) {
+		t.Errorf("Expected ExportTo To Report Tampered Content, Got %v", err)
+	}
+	fmt.Println("----------->PASSED B: Verify an exported image...")
+	fmt.Println("----------->BEGINNING C: Refuse to import tampered content...")
+	if err := goCluster.DeleteImage(want); err != nil {
+		t.Fatalf("Error Deleting Verified Image: %v", err)
+	}
+	img.Contents[0] = []byte("tampered")
+	if err := img.Import(); !errors.Is(err, ErrImageMismatch) || img.Verified != "" {
+		t.Errorf("Expected Import To Refuse Tampered Content, Got %v", err)
+	}
+	if len(fake.StoredImages) != 0 {
+		t.Errorf("Expected The Tampered Image Not To Be Stored")
+	}
+	img.Contents[0] = []byte("tarball")
+	if err := img.Import(); err != nil || img.Verified != want {
+		t.Errorf("Expected Import To Verify %s, Got %q %v", want, img.Verified, err)
+	}
+	fmt.Println("----------->PASSED C: Refuse to import tampered content...")
+	fmt.Println("<-----------testImageVerification COMPLETE")
+}
+
+// TestImageManagement
+func TestImageManagement(t *testing.T) {
+	t.Run("LoadImagesOutput", testLoadImagesOutput)
+	t.Run("AliasesAndProperties", testImageAliasesAndProperties)
+	t.Run("PruneImages", testPruneImages)
+}
+
+// testLoadImagesOutput
+func testLoadImagesOutput(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testLoadImagesOutput...")
+	imgsOut, err := LoadImagesOutput(`[{"aliases":[{"name":"web","description":"web tier"}],"auto_update":true,
+		"properties":{"os":"ubuntu","release":"focal","description":"Ubuntu focal","build":"42"},"public":true,
+		"fingerprint":"aabbccddeeff","filename":"web.tar.gz","size":3,"type":"container",
+		"created_at":"2021-04-18T10:00:00Z","last_used_at":"0001-01-01T00:00:00Z"}]`)
+	if err != nil {
+		t.Fatalf("Error Loading Images Output: %v", err)
+	}
+	images := imgsOut.GetImages()
+	if len(images) != 1 {
+		t.Fatalf("Expected One GoImage, Got %d", len(images))
+	}
+	img := images[0]
+	if img.Name != "web" || fmt.Sprint(img.Aliases) != "[web]" || !img.Public || !img.AutoUpdate || img.Size != 3 {
+		t.Errorf("Expected The Alias, Flags And Size To Load, Got %+v", img)
+	}
+	if img.Properties["build"] != "42" || imgsOut.Outputs[0].Props.OSType != "ubuntu" {
+		t.Errorf("Expected Every Property To Load, Got %v", img.Properties)
+	}
+	if created, ok := img.lastUsed(); !ok || created.Year() != 2021 {
+		t.Errorf("Expected A Never Used Image To Date From Its Creation, Got %v", created)
+	}
+	fmt.Println("<-----------testLoadImagesOutput COMPLETE")
+}
+
+// testImageAliasesAndProperties
+func testImageAliasesAndProperties(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testImageAliasesAndProperties...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("the image management test needs the FakeBackend")
+	}
+	fake.mu.Lock()
+	stored := fake.addImage([]string{"{{fingerprint}}.tar.gz"}, [][]byte{[]byte("managed")}, "managed")
+	fake.mu.Unlock()
+	fmt.Println("----------->BEGINNING A: Add and remove aliases...")
+	if err := goCluster.AddImageAlias(stored.Fingerprint, "managed-latest", "newest build"); err != nil {
+		t.Fatalf("Error Adding Image Alias: %v", err)
+	}
+	if err := goCluster.AddImageAlias(stored.Fingerprint, "managed-latest", ""); err == nil {
+		t.Errorf("Expected A Duplicate Alias To Fail")
+	}
+	img, err := goCluster.GetImage("managed-latest")
+	if err != nil || img.Fingerprint != stored.Fingerprint || fmt.Sprint(img.Aliases) != "[managed managed-latest]" {
+		t.Fatalf("Expected The Image By Its New Alias, Got %v %v", img, err)
+	}
+	if err = goCluster.DeleteImageAlias("managed"); err != nil {
+		t.Fatalf("Error Deleting Image Alias: %v", err)
+	}
+	if _, err = goCluster.GetImage("managed"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("Expected ErrImageNotFound For A Deleted Alias, Got %v", err)
+	}
+	if err = goCluster.DeleteImageAlias("managed"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("Expected ErrImageNotFound Deleting A Missing Alias, Got %v", err)
+	}
+	fmt.Println("----------->PASSED A: Add and remove aliases...")
+	fmt.Println("----------->BEGINNING B: Edit properties and flags...")
+	if err = goCluster.SetImageProperties("managed-latest", map[string]string{"build": "42", "stage": "ci"}); err != nil {
+		t.Fatalf("Error Setting Image Properties: %v", err)
+	}
+	if err = goCluster.SetImageProperties("managed-latest", map[string]string{"stage": ""}); err != nil {
+		t.Fatalf("Error Removing Image Property: %v", err)
+	}
+	if err = goCluster.SetImageDescription("managed-latest", "CI build 42"); err != nil {
+		t.Fatalf("Error Setting Image Description: %v", err)
+	}
+	if err = goCluster.SetImagePublic("managed-latest", true); err != nil {
+		t.Fatalf("Error Setting Image Public: %v", err)
+	}
+	if err = goCluster.SetImageAutoUpdate("managed-latest", true); err != nil {
+		t.Fatalf("Error Setting Image AutoUpdate: %v", err)
+	}
+	img, err = goCluster.GetImage(stored.Fingerprint[:12])
+	if err != nil {
+		t.Fatalf("Error Getting Image By Fingerprint Prefix: %v", err)
+	}
+	if img.Properties["build"] != "42" || img.Properties["description"] != "CI build 42" || img.Properties["stage"] != "" {
+		t.Errorf("Expected The Edited Properties, Got %v", img.Properties)
+	}
+	if !img.Public || !img.AutoUpdate {
+		t.Errorf("Expected The Image To Be Public And AutoUpdate")
+	}
+	if refreshed, err := goCluster.RefreshImage(stored.Fingerprint); err != nil || refreshed {
+		t.Errorf("Expected A Local Image Not To Refresh, Got %v %v", refreshed, err)
+	}
+	if err = goCluster.SetImagePublic("missing", true); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("Expected ErrImageNotFound Editing A Missing Image, Got %v", err)
+	}
+	fmt.Println("----------->PASSED B: Edit properties and flags...")
+	fmt.Println("<-----------testImageAliasesAndProperties COMPLETE")
+}
+
+// testPruneImages
+func testPruneImages(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testPruneImages...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("the prune test needs the FakeBackend")
+	}
+	old := time.Now().Add(-48 * time.Hour).UTC().Format(time.RFC3339)
+	fake.mu.Lock()
+	stale := fake.addImage([]string{"{{fingerprint}}.tar.gz"}, [][]byte{[]byte("stale")}, "web-image--snap-1")
+	kept := fake.addImage([]string{"{{fingerprint}}.tar.gz"}, [][]byte{[]byte("kept")}, "golden")
+	fresh := fake.addImage([]string{"{{fingerprint}}.tar.gz"}, [][]byte{[]byte("fresh")}, "web-image--snap-2")
+	stale.Created, kept.Created = old, old
+	fake.mu.Unlock()
+	tarball, err := fakeImageTarball("ubuntu", "focal", map[string][]byte{})
+	if err != nil {
+		t.Fatalf("Error Building Test Image: %v", err)
+	}
+	fake.mu.Lock()
+	used := fake.addImage([]string{"{{fingerprint}}.tar.gz"}, [][]byte{tarball}, "in-use")
+	used.Created = old
+	fake.mu.Unlock()
+	if err = fake.Launch(context.Background(), "PruneUser", "", "in-use", map[string]string{}); err != nil {
+		t.Fatalf("Error Launching From The In Use Image: %v", err)
+	}
+	fake.mu.Lock()
+	used.LastUsed = old
+	fake.mu.Unlock()
+	pruned, err := goCluster.PruneImages(24*time.Hour, func(img *GoImage) bool {
+		return img.Name != "golden"
+	})
+	if err != nil {
+		t.Fatalf("Error Pruning Images: %v", err)
+	}
+	if len(pruned) != 1 || pruned[0].Fingerprint != stale.Fingerprint {
+		t.Errorf("Expected Only The Stale Snapshot Image To Be Pruned, Got %v", pruned)
+	}
+	for _, img := range []*FakeImage{kept, fresh, used} {
+		if _, ok := fake.StoredImages[img.Fingerprint]; !ok {
+			t.Errorf("Expected %v To Be Kept", img.Aliases)
+		}
+	}
+	fmt.Println("<-----------testPruneImages COMPLETE")
+}
@@ -0,0 +1,296 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ImageFormat is how the files of a GoImage are laid out
+type ImageFormat string
+
+const (
+	// ImageUnified is a single tarball holding both the metadata and the rootfs
+	ImageUnified ImageFormat = "unified"
+	// ImageSplit is a metadata tarball and a separate squashfs or qcow2 rootfs
+	ImageSplit ImageFormat = "split"
+)
+
+// ImageCompression is the compression of an image tarball, or the file system of a split image's rootfs
+type ImageCompression string
+
+const (
+	CompressionNone     ImageCompression = "none"
+	CompressionGzip     ImageCompression = "gzip"
+	CompressionBzip2    ImageCompression = "bzip2"
+	CompressionXZ       ImageCompression = "xz"
+	CompressionLZMA     ImageCompression = "lzma"
+	CompressionZstd     ImageCompression = "zstd"
+	CompressionSquashFS ImageCompression = "squashfs"
+	CompressionQcow2    ImageCompression = "qcow2"
+)
+
+// GoImage Types as LXD reports them
+const (
+	ImageTypeContainer = "container"
+	ImageTypeVM        = "virtual-machine"
+)
+
+// imageExtensions are the file extensions LXD names image files with
+var imageExtensions = []struct {
+	compression ImageCompression
+	ext         string
+}{
+	{CompressionGzip, ".tar.gz"},
+	{CompressionBzip2, ".tar.bz2"},
+	{CompressionXZ, ".tar.xz"},
+	{CompressionLZMA, ".tar.lzma"},
+	{CompressionZstd, ".tar.zst"},
+	{CompressionNone, ".tar"},
+	{CompressionSquashFS, ".squashfs"},
+	{CompressionQcow2, ".qcow2"},
+}
+
+// imageMagic are the leading bytes of each ImageCompression
+var imageMagic = []struct {
+	compression ImageCompression
+	offset      int
+	magic       []byte
+}{
+	{CompressionGzip, 0, []byte{0x1f, 0x8b}},
+	{CompressionBzip2, 0, []byte("BZh")},
+	{CompressionXZ, 0, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{CompressionLZMA, 0, []byte{0x5d, 0x00, 0x00}},
+	{CompressionZstd, 0, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{CompressionSquashFS, 0, []byte("hsqs")},
+	{CompressionQcow2, 0, []byte{'Q', 'F', 'I', 0xfb}},
+	{CompressionNone, 257, []byte("ustar")},
+}
+
+// imageHeaderSize is how much of an image file detectImageCompression needs
+const imageHeaderSize = 262
+
+// detectImageCompression returns the ImageCompression of an image file from its first bytes, or "" when unknown
+func detectImageCompression(header []byte) ImageCompression {
+	for _, m := range imageMagic {
+		if len(header) >= m.offset+len(m.magic) && bytes.Equal(header[m.offset:m.offset+len(m.magic)], m.magic) {
+			return m.compression
+		}
+	}
+	return ""
+}
+
+// imageCompressionOf returns the ImageCompression of an image file from its name, or "" when unknown
+func imageCompressionOf(fileName string) ImageCompression {
+	for _, e := range imageExtensions {
+		if strings.HasSuffix(fileName, e.ext) {
+			return e.compression
+		}
+	}
+	return ""
+}
+
+// imageFileName names an image file the way LXD exports it, an unknown compression is named as a gzipped tarball
+func imageFileName(fingerprint string, meta bool, compression ImageCompression) string {
+	ext := ".tar.gz"
+	for _, e := range imageExtensions {
+		if e.compression == compression {
+			ext = e.ext
+		}
+	}
+	if meta {
+		return "meta-" + fingerprint + ext
+	}
+	return fingerprint + ext
+}
+
+// trimImageFileName strips the meta- prefix and the extension from an image file name
+func trimImageFileName(fileName string) string {
+	fileName = strings.TrimPrefix(fileName, "meta-")
+	for _, e := range imageExtensions {
+		if strings.HasSuffix(fileName, e.ext) {
+			return strings.TrimSuffix(fileName, e.ext)
+		}
+	}
+	return fileName
+}
+
+// isRootfs reports whether an ImageCompression is the file system of a split image's rootfs
+func isRootfs(compression ImageCompression) bool {
+	return compression == CompressionSquashFS || compression == CompressionQcow2
+}
+
+// setFormat records the ImageFormat, ImageCompression and type of a GoImage from the compression of its
+// metadata or unified tarball and of its split rootfs
+func (im *GoImage) setFormat(format ImageFormat, metadata ImageCompression, rootfs ImageCompression) {
+	im.Format = format
+	im.Compression = metadata
+	im.Rootfs = rootfs
+	if rootfs == CompressionQcow2 {
+		im.Type = ImageTypeVM
+	}
+}
+
+// setFormatOf records the format of a GoImage from the names of its files
+func (im *GoImage) setFormatOf(fileNames []string) {
+	format := ImageUnified
+	var metadata, rootfs ImageCompression
+	for _, fName := range fileNames {
+		if strings.HasPrefix(fName, "meta-") {
+			format = ImageSplit
+			metadata = imageCompressionOf(fName)
+		} else if compression := imageCompressionOf(fName); isRootfs(compression) || len(fileNames) > 1 {
+			format = ImageSplit
+			rootfs = compression
+		} else {
+			metadata = compression
+		}
+	}
+	im.setFormat(format, metadata, rootfs)
+}
+
+// sniffImageCompression returns the ImageCompression of an image file being streamed from r, and a reader
+// that still yields the whole file
+func sniffImageCompression(r io.Reader) (ImageCompression, io.Reader) {
+	br := bufio.NewReaderSize(r, imageHeaderSize)
+	header, _ := br.Peek(imageHeaderSize)
+	return detectImageCompression(header), br
+}
+
+// importParts returns the metadata, or unified tarball, and the split rootfs held in a GoImage's Contents
+func (im *GoImage) importParts() (io.Reader, io.Reader, error) {
+	switch len(im.Contents) {
+	case 1:
+		return bytes.NewReader(im.Contents[0]), nil, nil
+	case 2:
+		meta, rootfs := im.Contents[0], im.Contents[1]
+		if len(im.TarMeta) == 2 && strings.HasPrefix(im.TarMeta[1], "meta-") || isRootfs(detectImageCompression(meta)) {
+			meta, rootfs = rootfs, meta
+		}
+		return bytes.NewReader(meta), bytes.NewReader(rootfs), nil
+	}
+	return nil, nil, fmt.Errorf("cannot import an image from %d files", len(im.Contents))
+}
+
+// lastUsed returns when the GoImage was last used, or created when it was never used, ok is false when neither
+// time can be read
+func (im *GoImage) lastUsed() (time.Time, bool) {
+	if lastUsed, err := time.Parse(time.RFC3339, im.LastUsed); err == nil && lastUsed.Year() > 1 {
+		return lastUsed, true
+	}
+	created, err := time.Parse(time.RFC3339, im.DateTime)
+	return created, err == nil && created.Year() > 1
+}
+
+// IsVM reports whether the GoImage is a virtual machine image
+func (im *GoImage) IsVM() bool {
+	return im.Rootfs == CompressionQcow2 || strings.EqualFold(im.Type, ImageTypeVM)
+}
+
+// isFingerprint reports whether s is a SHA-256 image fingerprint rather than a placeholder such as "unknown"
+func isFingerprint(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// imageCheck hashes and counts image content as it streams into LXD, failing the stream once it cannot match
+// the expected size or fingerprint, an expectSize of 0 or an empty expectFingerprint is not checked
+type imageCheck struct {
+	hash              hash.Hash
+	size              int64
+	expectSize        int64
+	expectFingerprint string
+	err               error
+	mu                sync.Mutex
+}
+
+// newImageCheck creates a pointer to a new imageCheck
+func newImageCheck(expectSize int64, expectFingerprint string) *imageCheck {
+	if !isFingerprint(expectFingerprint) {
+		expectFingerprint = ""
+	}
+	return &imageCheck{
+		hash:              sha256.New(),
+		expectSize:        expectSize,
+		expectFingerprint: strings.ToLower(expectFingerprint),
+	}
+}
+
+// reader wraps one file of an image, the last file's end is where the whole image is verified
+func (ic *imageCheck) reader(r io.Reader, last bool) io.Reader {
+	return &imageCheckReader{ic, r, last}
+}
+
+// failed returns why the image did not match, if it did not
+func (ic *imageCheck) failed() error {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	return ic.err
+}
+
+// fingerprint returns the SHA-256 fingerprint of the content read so far
+func (ic *imageCheck) fingerprint() string {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	return hex.EncodeToString(ic.hash.Sum(nil))
+}
+
+// read records n bytes of p and returns an error once the image cannot match
+func (ic *imageCheck) read(p []byte, n int, eof bool) error {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	if ic.err != nil {
+		return ic.err
+	}
+	ic.hash.Write(p[:n])
+	ic.size += int64(n)
+	if ic.expectSize > 0 && ic.size > ic.expectSize {
+		ic.err = fmt.Errorf("image is larger than its expected %d bytes", ic.expectSize)
+	} else if eof && ic.expectSize > 0 && ic.size != ic.expectSize {
+		ic.err = fmt.Errorf("image is %d bytes, expected %d", ic.size, ic.expectSize)
+	} else if eof && ic.expectFingerprint != "" && hex.EncodeToString(ic.hash.Sum(nil)) != ic.expectFingerprint {
+		ic.err = fmt.Errorf("image fingerprint is %s, expected %s", hex.EncodeToString(ic.hash.Sum(nil)), ic.expectFingerprint)
+	}
+	return ic.err
+}
+
+// imageCheckReader feeds one file of an image through its imageCheck
+type imageCheckReader struct {
+	check *imageCheck
+	r     io.Reader
+	last  bool
+}
+
+// Read from the file, returning the imageCheck's error in place of the file's end when the image does not match
+func (cr *imageCheckReader) Read(p []byte) (int, error) {
+	if err := cr.check.failed(); err != nil {
+		return 0, err
+	}
+	n, err := cr.r.Read(p)
+	if checkErr := cr.check.read(p, n, err == io.EOF && cr.last); checkErr != nil {
+		return n, checkErr
+	}
+	return n, err
+}
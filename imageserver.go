@@ -0,0 +1,414 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultImageRemote is the image remote GoContainers without a Remote are created from, when empty they come
+// from the images remote, or the cloud images of their Type when they have an InitFile
+var DefaultImageRemote = ""
+
+// errServeEncrypted is returned for an image file an ImageServer cannot serve because it is encrypted
+var errServeEncrypted = errors.New("encrypted images cannot be served")
+
+// servedImageFile is the file an ImageServer keeps the description of each of its images in
+const servedImageFile = "image.json"
+
+// ImageProduct describes what a GoImage served by an ImageServer is, and the aliases LXD launches it by
+type ImageProduct struct {
+	OS           string   `json:"os"`
+	Release      string   `json:"release"`
+	Architecture string   `json:"arch"`
+	Variant      string   `json:"variant"`
+	Aliases      []string `json:"aliases"`
+}
+
+// key returns the simplestreams product name of the ImageProduct
+func (ip ImageProduct) key() string {
+	return ip.OS + ":" + ip.Release + ":" + ip.Architecture + ":" + ip.Variant
+}
+
+// servedImage is an image held by an ImageServer, kept in its directory's image.json
+type servedImage struct {
+	Product     ImageProduct `json:"product"`
+	Fingerprint string       `json:"fingerprint"`
+	Created     string       `json:"created"`
+	Files       []servedFile `json:"files"`
+}
+
+// servedFile is one file of a servedImage, its metadata file first
+type servedFile struct {
+	Name        string           `json:"name"`
+	Compression ImageCompression `json:"compression"`
+	Size        int64            `json:"size"`
+	SHA256      string           `json:"sha256"`
+}
+
+// simplestreams documents, as LXD reads them
+type simplestreamsIndex struct {
+	Format string                             `json:"format"`
+	Index  map[string]simplestreamsIndexEntry `json:"index"`
+}
+
+type simplestreamsIndexEntry struct {
+	DataType string   `json:"datatype"`
+	Path     string   `json:"path"`
+	Format   string   `json:"format"`
+	Products []string `json:"products"`
+}
+
+type simplestreamsProducts struct {
+	ContentID string                          `json:"content_id"`
+	DataType  string                          `json:"datatype"`
+	Format    string                          `json:"format"`
+	Products  map[string]simplestreamsProduct `json:"products"`
+}
+
+type simplestreamsProduct struct {
+	Aliases      string                          `json:"aliases"`
+	Arch         string                          `json:"arch"`
+	OS           string                          `json:"os"`
+	Release      string                          `json:"release"`
+	ReleaseTitle string                          `json:"release_title"`
+	Variant      string                          `json:"variant"`
+	Versions     map[string]simplestreamsVersion `json:"versions"`
+}
+
+type simplestreamsVersion struct {
+	Items map[string]simplestreamsItem `json:"items"`
+}
+
+type simplestreamsItem struct {
+	FileType         string `json:"ftype"`
+	Path             string `json:"path"`
+	Size             int64  `json:"size"`
+	SHA256           string `json:"sha256"`
+	CombinedSquashFS string `json:"combined_squashfs_sha256,omitempty"`
+	CombinedDiskKVM  string `json:"combined_disk-kvm-img_sha256,omitempty"`
+}
+
+// ImageServer serves a directory of exported GoImages as a simplestreams image server, so LXD hosts without
+// internet access can launch from it once it is added as a remote with GoCluster.AddImageRemote. LXD only pulls
+// from https remotes, so serve it with http.ListenAndServeTLS or behind a TLS proxy
+type ImageServer struct {
+	Dir string
+}
+
+// NewImageServer creates a pointer to a new ImageServer of the images in dir, creating dir if needed
+func NewImageServer(dir string) (*ImageServer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &ImageServer{dir}, nil
+}
+
+// AddImage stores a GoImage in the ImageServer's directory as product, from its Contents when they are loaded
+// or else by streaming it from LXD. An empty OS or Release of product is read from the GoImage's Properties, the
+// Architecture defaults to amd64, the Variant to default and the Aliases to os/release and os/release/arch, the
+// alias GoContainers are created by. Encrypted images are refused, since LXD could not read them
+func (is *ImageServer) AddImage(image *GoImage, product ImageProduct) error {
+	return is.AddImageContext(context.Background(), image, product)
+}
+
+// AddImageContext is like AddImage but returns ctx.Err() once ctx is done
+func (is *ImageServer) AddImageContext(ctx context.Context, image *GoImage, product ImageProduct) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if product.OS == "" {
+		product.OS = image.Properties["os"]
+	}
+	if product.Release == "" {
+		product.Release = image.Properties["release"]
+	}
+	if product.OS == "" || product.Release == "" {
+		return &OpError{"serve image", image.Name, nil, errors.New("an ImageProduct needs an os and a release")}
+	}
+	if product.Architecture == "" {
+		product.Architecture = "amd64"
+	}
+	if product.Variant == "" {
+		product.Variant = "default"
+	}
+	if len(product.Aliases) == 0 {
+		alias := product.OS + "/" + product.Release
+		product.Aliases = []string{alias, alias + "/" + product.Architecture}
+	}
+	incoming, err := ioutil.TempDir(is.Dir, ".incoming-")
+	if err != nil {
+		return &OpError{"serve image", image.Name, nil, err}
+	}
+	defer os.RemoveAll(incoming)
+	served := &servedImage{Product: product, Created: image.DateTime}
+	combined := sha256.New()
+	if len(image.Contents) > 0 {
+		var metadata, rootfs io.Reader
+		if metadata, rootfs, err = image.importParts(); err == nil {
+			if err = served.writeFile(incoming, metadata, combined, rootfs != nil); err == nil && rootfs != nil {
+				err = served.writeFile(incoming, rootfs, combined, false)
+			}
+		}
+	} else {
+		err = image.ExportPartsContext(ctx, func(fileName string, r io.Reader) error {
+			return served.writeFile(incoming, r, combined, strings.HasPrefix(fileName, "meta-"))
+		})
+	}
+	if errors.Is(err, errServeEncrypted) {
+		return &OpError{"serve image", image.Name, ErrImageEncryption, err}
+	} else if err != nil {
+		return newOpError("serve image", image.Name, err, nil)
+	}
+	served.Fingerprint = hex.EncodeToString(combined.Sum(nil))
+	if image.Fingerprint != "" && !strings.HasPrefix(served.Fingerprint, strings.ToLower(image.Fingerprint)) {
+		return &OpError{"serve image", image.Name, ErrImageMismatch, fmt.Errorf("image fingerprint is %s, expected %s", served.Fingerprint, image.Fingerprint)}
+	}
+	if _, err = time.Parse(time.RFC3339, served.Created); err != nil {
+		served.Created = time.Now().UTC().Format(time.RFC3339)
+	}
+	description, err := json.MarshalIndent(served, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(incoming, servedImageFile), description, 0644)
+	}
+	if err == nil {
+		imageDir := filepath.Join(is.Dir, served.Fingerprint)
+		if err = os.RemoveAll(imageDir); err == nil {
+			err = os.Rename(incoming, imageDir)
+		}
+	}
+	if err == nil {
+		err = os.Chmod(filepath.Join(is.Dir, served.Fingerprint), 0755)
+	}
+	return newOpError("serve image", image.Name, err, nil)
+}
+
+// writeFile copies one file of an image from r into dir, naming it by its role and detected compression
+func (si *servedImage) writeFile(dir string, r io.Reader, combined hash.Hash, meta bool) error {
+	br := bufio.NewReaderSize(r, imageHeaderSize)
+	header, _ := br.Peek(imageHeaderSize)
+	compression := detectImageCompression(header)
+	if isEncrypted(header) {
+		return errServeEncrypted
+	} else if compression == "" {
+		return errors.New("image file is not an image")
+	}
+	name := "lxd_combined"
+	if meta {
+		name = "lxd"
+	} else if len(si.Files) > 0 {
+		name = "root"
+	}
+	name += imageFileName("", false, compression)
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	fileHash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, fileHash, combined), br)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	si.Files = append(si.Files, servedFile{name, compression, size, hex.EncodeToString(fileHash.Sum(nil))})
+	return nil
+}
+
+// RemoveImage stops serving the image fingerprint
+func (is *ImageServer) RemoveImage(fingerprint string) error {
+	if !isFingerprint(fingerprint) {
+		return &OpError{"remove served image", fingerprint, ErrImageNotFound, ErrImageNotFound}
+	}
+	imageDir := filepath.Join(is.Dir, fingerprint)
+	if _, err := os.Stat(imageDir); os.IsNotExist(err) {
+		return &OpError{"remove served image", fingerprint, ErrImageNotFound, err}
+	}
+	return newOpError("remove served image", fingerprint, os.RemoveAll(imageDir), nil)
+}
+
+// images loads every image the ImageServer holds
+func (is *ImageServer) images() ([]*servedImage, error) {
+	entries, err := ioutil.ReadDir(is.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var images []*servedImage
+	for _, entry := range entries {
+		if !entry.IsDir() || !isFingerprint(entry.Name()) {
+			continue
+		}
+		description, err := ioutil.ReadFile(filepath.Join(is.Dir, entry.Name(), servedImageFile))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		var served servedImage
+		if err = json.Unmarshal(description, &served); err != nil {
+			return nil, fmt.Errorf("reading served image %s: %v", entry.Name(), err)
+		}
+		images = append(images, &served)
+	}
+	return images, nil
+}
+
+// products builds the simplestreams products of the ImageServer's images
+func (is *ImageServer) products() (*simplestreamsProducts, error) {
+	images, err := is.images()
+	if err != nil {
+		return nil, err
+	}
+	products := &simplestreamsProducts{
+		ContentID: "images",
+		DataType:  "image-downloads",
+		Format:    "products:1.0",
+		Products:  map[string]simplestreamsProduct{},
+	}
+	for _, img := range images {
+		key := img.Product.key()
+		product, ok := products.Products[key]
+		if !ok {
+			product = simplestreamsProduct{
+				Aliases:      strings.Join(img.Product.Aliases, ","),
+				Arch:         img.Product.Architecture,
+				OS:           img.Product.OS,
+				Release:      img.Product.Release,
+				ReleaseTitle: img.Product.Release,
+				Variant:      img.Product.Variant,
+				Versions:     map[string]simplestreamsVersion{},
+			}
+		}
+		created, _ := time.Parse(time.RFC3339, img.Created)
+		version := created.UTC().Format("20060102_150405")
+		if _, taken := product.Versions[version]; taken {
+			version += "_" + img.Fingerprint[:12]
+		}
+		product.Versions[version] = simplestreamsVersion{img.items()}
+		products.Products[key] = product
+	}
+	return products, nil
+}
+
+// items returns the simplestreams items of a servedImage, a split image's metadata carries its fingerprint
+func (si *servedImage) items() map[string]simplestreamsItem {
+	items := map[string]simplestreamsItem{}
+	for ind, file := range si.Files {
+		item := simplestreamsItem{
+			Path:   path.Join("images", si.Fingerprint, file.Name),
+			Size:   file.Size,
+			SHA256: file.SHA256,
+		}
+		switch {
+		case len(si.Files) == 1:
+			item.FileType = "lxd_combined.tar.gz"
+		case ind == 0:
+			item.FileType = "lxd.tar.xz"
+			if si.Files[1].Compression == CompressionQcow2 {
+				item.CombinedDiskKVM = si.Fingerprint
+			} else {
+				item.CombinedSquashFS = si.Fingerprint
+			}
+		case file.Compression == CompressionQcow2:
+			item.FileType = "disk-kvm.img"
+		default:
+			item.FileType = "squashfs"
+		}
+		items[file.Name] = item
+	}
+	return items
+}
+
+// ServeHTTP serves the simplestreams index, products and image files of the ImageServer
+func (is *ImageServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	urlPath := path.Clean("/" + r.URL.Path)
+	switch {
+	case urlPath == "/streams/v1/index.json":
+		products, err := is.products()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var names []string
+		for name := range products.Products {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		writeJSON(w, simplestreamsIndex{
+			Format: "index:1.0",
+			Index: map[string]simplestreamsIndexEntry{
+				"images": {DataType: "image-downloads", Path: "streams/v1/images.json", Format: "products:1.0", Products: names},
+			},
+		})
+	case urlPath == "/streams/v1/images.json":
+		products, err := is.products()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, products)
+	case strings.HasPrefix(urlPath, "/images/"):
+		is.serveFile(w, r, strings.Split(strings.TrimPrefix(urlPath, "/images/"), "/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveFile serves an image file named by its fingerprint and file name, only files of a served image are served
+func (is *ImageServer) serveFile(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) != 2 || !isFingerprint(parts[0]) || parts[1] == servedImageFile {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(filepath.Join(is.Dir, parts[0], parts[1]))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, parts[1], info.ModTime(), f)
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,360 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestImageServer
+func TestImageServer(t *testing.T) {
+	t.Run("Products", testImageServerProducts)
+	t.Run("Files", testImageServerFiles)
+	t.Run("RemoteCreate", testImageServerRemoteCreate)
+	t.Run("Refused", testImageServerRefused)
+	t.Run("CLIRemote", testImageServerCLIRemote)
+}
+
+// newTestImageServer creates an ImageServer in a temporary directory
+func newTestImageServer(t *testing.T) (*ImageServer, func()) {
+	dir, err := ioutil.TempDir("", "imageserver")
+	if err != nil {
+		t.Fatalf("Error Creating Image Server Directory: %v", err)
+	}
+	server, err := NewImageServer(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Error Creating Image Server: %v", err)
+	}
+	return server, func() { os.RemoveAll(dir) }
+}
+
+// getJSON fetches path from an httptest server into v
+func getJSON(t *testing.T, client *http.Client, url string, v interface{}) {
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("Error Fetching %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %s To Be Served, Got %s", url, resp.Status)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("Error Decoding %s: %v", url, err)
+	}
+}
+
+// testImageServerProducts
+func testImageServerProducts(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testImageServerProducts...")
+	server, cleanup := newTestImageServer(t)
+	defer cleanup()
+	fmt.Println("----------->BEGINNING A: Adding Images...")
+	unified := NewGoImage("unified", "", "", "2021-04-18T10:00:00Z")
+	unified.Contents = [][]byte{append([]byte{0x1f, 0x8b}, "tarball"...)}
+	if err := server.AddImage(unified, ImageProduct{OS: "ubuntu", Release: "focal"}); err != nil {
+		t.Fatalf("Error Adding Unified Image: %v", err)
+	}
+	split := NewGoImage("split", "", "", "2021-04-19T10:00:00Z")
+	split.TarMeta = []string{"rootfs.squashfs", "meta-split.tar.xz"}
+	split.Contents = [][]byte{append([]byte("hsqs"), "rootfs"...), append([]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, "metadata"...)}
+	split.Properties = map[string]string{"os": "debian", "release": "bullseye"}
+	if err := server.AddImage(split, ImageProduct{Variant: "cloud", Aliases: []string{"golden"}}); err != nil {
+		t.Fatalf("Error Adding Split Image: %v", err)
+	}
+	fmt.Println("----------->PASSED A: Adding Images...")
+	fmt.Println("----------->BEGINNING B: Reading The Index...")
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	var index simplestreamsIndex
+	getJSON(t, ts.Client(), ts.URL+"/streams/v1/index.json", &index)
+	entry := index.Index["images"]
+	if index.Format != "index:1.0" || entry.Path != "streams/v1/images.json" || len(entry.Products) != 2 {
+		t.Fatalf("Expected An Index Of Both Products, Got %+v", index)
+	}
+	fmt.Println("----------->PASSED B: Reading The Index...")
+	fmt.Println("----------->BEGINNING C: Reading The Products...")
+	var products simplestreamsProducts
+	getJSON(t, ts.Client(), ts.URL+"/"+entry.Path, &products)
+	product, ok := products.Products["ubuntu:focal:amd64:default"]
+	if !ok || product.Aliases != "ubuntu/focal,ubuntu/focal/amd64" {
+		t.Fatalf("Expected The Unified Image's Default Product, Got %+v", products.Products)
+	}
+	sum := sha256.Sum256(unified.Contents[0])
+	item := product.Versions["20210418_100000"].Items["lxd_combined.tar.gz"]
+	if item.FileType != "lxd_combined.tar.gz" || item.SHA256 != hex.EncodeToString(sum[:]) || item.Size != int64(len(unified.Contents[0])) {
+		t.Errorf("Expected The Unified Image's Combined Item, Got %+v", product.Versions)
+	}
+	if unified.Fingerprint != "" {
+		t.Errorf("Expected AddImage To Leave The GoImage Alone, Got %s", unified.Fingerprint)
+	}
+	product, ok = products.Products["debian:bullseye:amd64:cloud"]
+	if !ok || product.Aliases != "golden" {
+		t.Fatalf("Expected The Split Image's Product, Got %+v", products.Products)
+	}
+	combined := sha256.Sum256(append(append([]byte{}, split.Contents[1]...), split.Contents[0]...))
+	items := product.Versions["20210419_100000"].Items
+	meta, rootfs := items["lxd.tar.xz"], items["root.squashfs"]
+	if meta.FileType != "lxd.tar.xz" || meta.CombinedSquashFS != hex.EncodeToString(combined[:]) || rootfs.FileType != "squashfs" {
+		t.Errorf("Expected The Split Image's Metadata To Carry Its Fingerprint, Got %+v", items)
+	}
+	fmt.Println("----------->PASSED C: Reading The Products...")
+	fmt.Println("<-----------testImageServerProducts COMPLETE")
+}
+
+// testImageServerFiles
+func testImageServerFiles(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testImageServerFiles...")
+	server, cleanup := newTestImageServer(t)
+	defer cleanup()
+	img := NewGoImage("vm", "", "", "")
+	img.Contents = [][]byte{append([]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, "metadata"...), append([]byte{'Q', 'F', 'I', 0xfb}, "disk"...)}
+	if err := server.AddImage(img, ImageProduct{OS: "ubuntu", Release: "jammy"}); err != nil {
+		t.Fatalf("Error Adding VM Image: %v", err)
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	var products simplestreamsProducts
+	getJSON(t, ts.Client(), ts.URL+"/streams/v1/images.json", &products)
+	var items map[string]simplestreamsItem
+	for _, version := range products.Products["ubuntu:jammy:amd64:default"].Versions {
+		items = version.Items
+	}
+	disk, meta := items["root.qcow2"], items["lxd.tar.xz"]
+	if disk.FileType != "disk-kvm.img" || meta.CombinedDiskKVM == "" {
+		t.Fatalf("Expected A VM Image's Disk Item, Got %+v", items)
+	}
+	fmt.Println("----------->BEGINNING A: Downloading An Image File...")
+	resp, err := ts.Client().Get(ts.URL + "/" + disk.Path)
+	if err != nil {
+		t.Fatalf("Error Downloading %s: %v", disk.Path, err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || !bytes.Equal(body, img.Contents[1]) {
+		t.Errorf("Expected To Download The VM's Disk, Got %q %v", body, err)
+	}
+	fmt.Println("----------->PASSED A: Downloading An Image File...")
+	fmt.Println("----------->BEGINNING B: Refusing Other Paths...")
+	fingerprint := meta.CombinedDiskKVM
+	for _, path := range []string{"/images/" + fingerprint + "/image.json", "/images/" + fingerprint + "/missing", "/images/../imageserver", "/other"} {
+		resp, err = ts.Client().Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("Error Fetching %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected %s Not To Be Served, Got %s", path, resp.Status)
+		}
+	}
+	resp, err = ts.Client().Post(ts.URL+"/streams/v1/index.json", "application/json", nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected The Image Server To Be Read Only, Got %v", err)
+	}
+	fmt.Println("----------->PASSED B: Refusing Other Paths...")
+	fmt.Println("----------->BEGINNING C: Removing An Image...")
+	if err = server.RemoveImage(fingerprint); err != nil {
+		t.Fatalf("Error Removing Image: %v", err)
+	}
+	products = simplestreamsProducts{}
+	getJSON(t, ts.Client(), ts.URL+"/streams/v1/images.json", &products)
+	if len(products.Products) != 0 {
+		t.Errorf("Expected No Products Once Removed, Got %+v", products.Products)
+	}
+	if err = server.RemoveImage(fingerprint); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("Expected ErrImageNotFound, Got %v", err)
+	}
+	fmt.Println("----------->PASSED C: Removing An Image...")
+	fmt.Println("<-----------testImageServerFiles COMPLETE")
+}
+
+// testImageServerRemoteCreate
+func testImageServerRemoteCreate(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testImageServerRemoteCreate...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("the remote create test needs the FakeBackend to reach the test image server")
+	}
+	server, cleanup := newTestImageServer(t)
+	defer cleanup()
+	tarball, err := fakeImageTarball("ubuntu", "focal", map[string][]byte{"/etc/golden": []byte("golden\n")})
+	if err != nil {
+		t.Fatalf("Error Building Test Image: %v", err)
+	}
+	fmt.Println("----------->BEGINNING A: Serving An Exported Image...")
+	fake.mu.Lock()
+	golden := fake.addImage([]string{"{{fingerprint}}.tar.gz"}, [][]byte{tarball}, "golden")
+	fake.mu.Unlock()
+	img := NewGoImage("golden", "", golden.Fingerprint, "")
+	img.SetBackend(fake)
+	if err = server.AddImage(img, ImageProduct{OS: "ubuntu", Release: "focal"}); err != nil {
+		t.Fatalf("Error Serving Exported Image: %v", err)
+	}
+	if err = goCluster.DeleteImage(golden.Fingerprint); err != nil {
+		t.Fatalf("Error Deleting Exported Image: %v", err)
+	}
+	fmt.Println("----------->PASSED A: Serving An Exported Image...")
+	fmt.Println("----------->BEGINNING B: Creating From The Image Remote...")
+	ts := httptest.NewTLSServer(server)
+	defer ts.Close()
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err = goCluster.AddImageRemote("airgap", ts.URL, string(certificate)); err != nil {
+		t.Fatalf("Error Adding Image Remote: %v", err)
+	}
+	container := NewGoContainer("RemoteCreate", false, "ubuntu", "focal", []string{}, nil, "default", &Network{}, nil)
+	container.Remote = "airgap"
+	container.SetBackend(fake)
+	if err = container.Create(); err != nil {
+		t.Fatalf("Error Creating From The Image Remote: %v", err)
+	}
+	cached, ok := fake.StoredImages[golden.Fingerprint]
+	if !ok || !cached.Cached {
+		t.Errorf("Expected The Served Image To Be Pulled And Cached")
+	}
+	if fake.Containers["RemoteCreate"].Config["volatile.base_image"] != golden.Fingerprint {
+		t.Errorf("Expected The Container To Be Launched From The Served Image")
+	}
+	fmt.Println("----------->PASSED B: Creating From The Image Remote...")
+	fmt.Println("----------->BEGINNING C: Refusing An Untrusted Image Remote...")
+	other := httptest.NewTLSServer(server)
+	defer other.Close()
+	if err = goCluster.AddImageRemote("untrusted", other.URL, ""); err != nil {
+		t.Fatalf("Error Adding Image Remote: %v", err)
+	}
+	container = NewGoContainer("Untrusted", false, "ubuntu", "focal", []string{}, nil, "default", &Network{}, nil)
+	container.Remote = "untrusted"
+	container.SetBackend(fake)
+	if err = container.CreateContext(context.Background()); err == nil {
+		t.Errorf("Expected An Untrusted Image Remote To Be Refused")
+	}
+	fmt.Println("----------->PASSED C: Refusing An Untrusted Image Remote...")
+	fmt.Println("<-----------testImageServerRemoteCreate COMPLETE")
+}
+
+// testImageServerRefused
+func testImageServerRefused(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testImageServerRefused...")
+	server, cleanup := newTestImageServer(t)
+	defer cleanup()
+	img := NewGoImage("unnamed", "", "", "")
+	img.Contents = [][]byte{append([]byte{0x1f, 0x8b}, "tarball"...)}
+	if err := server.AddImage(img, ImageProduct{}); err == nil {
+		t.Errorf("Expected An Image Without An OS And Release To Be Refused")
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("Error Generating Key: %v", err)
+	}
+	archive, err := encryptArchive(bytes.NewReader(img.Contents[0]), NewStaticKeys("test", key))
+	if err != nil {
+		t.Fatalf("Error Encrypting Image: %v", err)
+	}
+	encrypted, err := ioutil.ReadAll(archive)
+	if err != nil {
+		t.Fatalf("Error Encrypting Image: %v", err)
+	}
+	img.Contents = [][]byte{encrypted}
+	if err = server.AddImage(img, ImageProduct{OS: "ubuntu", Release: "focal"}); !errors.Is(err, ErrImageEncryption) {
+		t.Errorf("Expected ErrImageEncryption, Got %v", err)
+	}
+	img.Contents = [][]byte{append([]byte{0x1f, 0x8b}, "tarball"...)}
+	img.Fingerprint = strings.Repeat("0", 64)
+	if err = server.AddImage(img, ImageProduct{OS: "ubuntu", Release: "focal"}); !errors.Is(err, ErrImageMismatch) {
+		t.Errorf("Expected ErrImageMismatch, Got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = server.AddImageContext(ctx, img, ImageProduct{OS: "ubuntu", Release: "focal"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, Got %v", err)
+	}
+	entries, _ := ioutil.ReadDir(server.Dir)
+	if len(entries) != 0 {
+		t.Errorf("Expected Refused Images To Leave Nothing Behind, Got %d Entries", len(entries))
+	}
+	sum := sha256.Sum256(img.Contents[0])
+	img.Fingerprint = strings.ToUpper(hex.EncodeToString(sum[:])[:12])
+	if err = server.AddImage(img, ImageProduct{OS: "ubuntu", Release: "focal"}); err != nil {
+		t.Errorf("Expected A Fingerprint Prefix In Any Case To Be Accepted, Got %v", err)
+	}
+	fmt.Println("<-----------testImageServerRefused COMPLETE")
+}
+
+// testImageServerCLIRemote
+func testImageServerCLIRemote(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testImageServerCLIRemote...")
+	dir, err := ioutil.TempDir("", "lxc")
+	if err != nil {
+		t.Fatalf("Error Creating Test Directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	// a stub lxc records its arguments and fails to add the remote named broken
+	stub := "#!/bin/sh\necho \"$@\" >> " + filepath.Join(dir, "args") + "\n[ \"$3\" != broken ]\n"
+	if err = ioutil.WriteFile(filepath.Join(dir, "lxc"), []byte(stub), 0755); err != nil {
+		t.Fatalf("Error Writing Stub lxc: %v", err)
+	}
+	for key, val := range map[string]string{"PATH": dir + string(os.PathListSeparator) + os.Getenv("PATH"), "LXD_CONF": filepath.Join(dir, "conf")} {
+		defer os.Setenv(key, os.Getenv(key))
+		os.Setenv(key, val)
+	}
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+	certificate := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}))
+	cb := NewCLIBackend()
+	ctx := context.Background()
+	fmt.Println("----------->BEGINNING A: Pinning The Remote's Certificate...")
+	if err = cb.AddRemote(ctx, "golden", ts.URL, certificate); err != nil {
+		t.Fatalf("Error Adding Remote: %v", err)
+	}
+	pinned, err := ioutil.ReadFile(filepath.Join(dir, "conf", "servercerts", "golden.crt"))
+	if err != nil || string(pinned) != certificate {
+		t.Errorf("Expected The Certificate In The Remote's servercerts File, Got %v", err)
+	}
+	args, _ := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if strings.Contains(string(args), "--accept-certificate") || !strings.Contains(string(args), "remote add golden "+ts.URL) {
+		t.Errorf("Expected The Remote To Be Added Without Blindly Accepting Its Certificate, Got %q", args)
+	}
+	fmt.Println("----------->PASSED A: Pinning The Remote's Certificate...")
+	fmt.Println("----------->BEGINNING B: Refusing Bad Certificates...")
+	if err = cb.AddRemote(ctx, "bad", ts.URL, "not a certificate"); err == nil {
+		t.Errorf("Expected A Certificate That Is Not PEM To Be Refused")
+	}
+	if err = cb.AddRemote(ctx, "../escape", ts.URL, certificate); err == nil {
+		t.Errorf("Expected A Remote Name Leaving servercerts To Be Refused")
+	}
+	if err = cb.AddRemote(ctx, "broken", ts.URL, certificate); err == nil {
+		t.Errorf("Expected The Stub To Fail Adding The Remote")
+	}
+	if _, err = os.Stat(filepath.Join(dir, "conf", "servercerts", "broken.crt")); !os.IsNotExist(err) {
+		t.Errorf("Expected The Certificate Of A Remote That Failed To Be Added To Be Removed")
+	}
+	fmt.Println("----------->PASSED B: Refusing Bad Certificates...")
+	fmt.Println("<-----------testImageServerCLIRemote COMPLETE")
+}
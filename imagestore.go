@@ -0,0 +1,481 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// imageIndexFile is the file an FSImageStore keeps its index in
+const imageIndexFile = "index.json"
+
+// ImageStore keeps exported GoImages by fingerprint with an index of what they are. Set one as a GoCluster's
+// Store to export containers into it and import them back out of it
+type ImageStore interface {
+	// List returns every stored GoImage, without its Contents
+	List(ctx context.Context) ([]*GoImage, error)
+	// Get returns a stored GoImage by name, alias, fingerprint or fingerprint prefix of at least 12 characters
+	Get(ctx context.Context, name string) (*GoImage, error)
+	// Put stores a GoImage by its fingerprint, from its Contents when they are loaded or else streamed from LXD,
+	// an image already stored under its fingerprint is not stored again but indexed under its name too
+	Put(ctx context.Context, image *GoImage) error
+	// Open returns the files of a stored GoImage, its metadata ahead of its rootfs, the caller closes them
+	Open(ctx context.Context, name string) ([]io.ReadCloser, error)
+	// Delete removes a stored GoImage by name, alias or fingerprint
+	Delete(ctx context.Context, name string) error
+	// Prune deletes and returns the stored GoImages created more than maxAge ago, a nil match prunes every
+	// such image
+	Prune(ctx context.Context, maxAge time.Duration, match func(*GoImage) bool) ([]*GoImage, error)
+}
+
+// imageIndexEntry is one GoImage in the index of an FSImageStore
+type imageIndexEntry struct {
+	Fingerprint  string          `json:"fingerprint"`
+	Name         string          `json:"name"`
+	Aliases      []string        `json:"aliases,omitempty"`
+	Type         string          `json:"type,omitempty"`
+	OS           string          `json:"os,omitempty"`
+	Release      string          `json:"release,omitempty"`
+	Architecture string          `json:"architecture,omitempty"`
+	Created      string          `json:"created"`
+	Size         int64           `json:"size"`
+	Files        []string        `json:"files"`
+	Signature    *ImageSignature `json:"signature,omitempty"`
+}
+
+// matches reports whether name is the name, an alias, the fingerprint or a fingerprint prefix of at least 12
+// characters of the entry
+func (ie *imageIndexEntry) matches(name string) bool {
+	if ie.Name == name || ie.Fingerprint == name || len(name) >= 12 && strings.HasPrefix(ie.Fingerprint, name) {
+		return true
+	}
+	for _, alias := range ie.Aliases {
+		if alias == name {
+			return true
+		}
+	}
+	return false
+}
+
+// goImage returns the GoImage an entry indexes, without its Contents
+func (ie *imageIndexEntry) goImage() *GoImage {
+	img := NewGoImage(ie.Name, ie.Type, ie.Fingerprint, ie.Created)
+	img.Size = ie.Size
+	img.Aliases = append([]string{}, ie.Aliases...)
+	img.Signature = ie.Signature
+	img.Properties = map[string]string{}
+	for key, val := range map[string]string{"os": ie.OS, "release": ie.Release, "architecture": ie.Architecture} {
+		if val != "" {
+			img.Properties[key] = val
+		}
+	}
+	var fileNames []string
+	for _, fName := range ie.Files {
+		fileNames = append(fileNames, strings.TrimSuffix(fName, encryptedExt))
+	}
+	img.setFormatOf(fileNames)
+	return img
+}
+
+// FSImageStore is an ImageStore in a directory of the local filesystem, each GoImage's files, encrypted when
+// they were exported encrypted, are kept in a directory named by its fingerprint, next to the index.json
+type FSImageStore struct {
+	Dir string
+	mu  sync.Mutex
+}
+
+// NewFSImageStore creates a pointer to a new FSImageStore in dir, creating dir if needed
+func NewFSImageStore(dir string) (*FSImageStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FSImageStore{Dir: dir}, nil
+}
+
+// readIndex loads the FSImageStore's index, with fs.mu held
+func (fs *FSImageStore) readIndex() ([]*imageIndexEntry, error) {
+	var index struct {
+		Images []*imageIndexEntry `json:"images"`
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(fs.Dir, imageIndexFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(contents, &index); err != nil {
+		return nil, fmt.Errorf("reading image index: %v", err)
+	}
+	return index.Images, nil
+}
+
+// writeIndex replaces the FSImageStore's index, with fs.mu held
+func (fs *FSImageStore) writeIndex(entries []*imageIndexEntry) error {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Fingerprint < entries[j].Fingerprint
+	})
+	contents, err := json.MarshalIndent(map[string]interface{}{"images": entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(fs.Dir, ".index-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(contents)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(fs.Dir, imageIndexFile))
+}
+
+// find returns the index entry of name, with fs.mu held
+func (fs *FSImageStore) find(op string, name string) (*imageIndexEntry, []*imageIndexEntry, error) {
+	entries, err := fs.readIndex()
+	if err != nil {
+		return nil, nil, &OpError{op, name, nil, err}
+	}
+	for _, entry := range entries {
+		if entry.matches(name) {
+			return entry, entries, nil
+		}
+	}
+	return nil, entries, &OpError{op, name, ErrImageNotFound, ErrImageNotFound}
+}
+
+// List returns every GoImage in the FSImageStore
+func (fs *FSImageStore) List(ctx context.Context) ([]*GoImage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	entries, err := fs.readIndex()
+	if err != nil {
+		return nil, &OpError{"list stored images", fs.Dir, nil, err}
+	}
+	var images []*GoImage
+	for _, entry := range entries {
+		images = append(images, entry.goImage())
+	}
+	return images, nil
+}
+
+// Get returns a GoImage in the FSImageStore by name, alias, fingerprint or fingerprint prefix
+func (fs *FSImageStore) Get(ctx context.Context, name string) (*GoImage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	entry, _, err := fs.find("get stored image", name)
+	if err != nil {
+		return nil, err
+	}
+	return entry.goImage(), nil
+}
+
+// Put stores a GoImage in the FSImageStore. Its files are written to a temporary directory that is only moved
+// into place once the image is complete, so an interrupted Put leaves nothing behind
+func (fs *FSImageStore) Put(ctx context.Context, image *GoImage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if isFingerprint(image.Fingerprint) {
+		fs.mu.Lock()
+		indexed, err := fs.index(image)
+		fs.mu.Unlock()
+		if indexed || err != nil {
+			return newOpError("store image", image.Name, err, nil)
+		}
+	}
+	incoming, err := ioutil.TempDir(fs.Dir, ".incoming-")
+	if err != nil {
+		return &OpError{"store image", image.Name, nil, err}
+	}
+	defer os.RemoveAll(incoming)
+	var files []string
+	if len(image.Contents) > 0 {
+		files, err = fs.writeContents(incoming, image)
+	} else {
+		err = image.ExportPartsContext(ctx, func(fileName string, r io.Reader) error {
+			fileName, err := storedFileName(fileName)
+			if err == nil {
+				err = writeStoredFile(filepath.Join(incoming, fileName), r)
+				files = append(files, fileName)
+			}
+			return err
+		})
+	}
+	if err != nil {
+		return newOpError("store image", image.Name, err, nil)
+	}
+	if err = os.Chmod(incoming, 0755); err != nil {
+		return &OpError{"store image", image.Name, nil, err}
+	}
+	sortImageParts(files)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err = os.Rename(incoming, filepath.Join(fs.Dir, image.Fingerprint)); err != nil {
+		// an image stored under the same fingerprint meanwhile is indexed under this name too
+		if _, statErr := os.Stat(filepath.Join(fs.Dir, image.Fingerprint)); statErr != nil {
+			return &OpError{"store image", image.Name, nil, err}
+		}
+	}
+	if _, err = fs.index(image, files...); err != nil {
+		return &OpError{"store image", image.Name, nil, err}
+	}
+	return nil
+}
+
+// index adds a GoImage to the FSImageStore's index and reports whether it was indexed, with fs.mu held. An
+// image already indexed gains the name and aliases of the GoImage, an image not yet indexed is only added
+// when its files are given
+func (fs *FSImageStore) index(image *GoImage, files ...string) (bool, error) {
+	entries, err := fs.readIndex()
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if entry.Fingerprint != image.Fingerprint {
+			continue
+		}
+		for _, name := range append([]string{image.Name}, image.Aliases...) {
+			if name != "" && !entry.matches(name) {
+				entry.Aliases = append(entry.Aliases, name)
+			}
+		}
+		if entry.Signature == nil {
+			entry.Signature = image.Signature
+		}
+		return true, fs.writeIndex(entries)
+	}
+	if len(files) == 0 {
+		return false, nil
+	}
+	created := image.DateTime
+	if _, err = time.Parse(time.RFC3339, created); err != nil {
+		created = time.Now().UTC().Format(time.RFC3339)
+	}
+	name := image.Name
+	if name == "" {
+		name = image.Fingerprint
+	}
+	entries = append(entries, &imageIndexEntry{
+		Fingerprint:  image.Fingerprint,
+		Name:         name,
+		Aliases:      image.Aliases,
+		Type:         image.Type,
+		OS:           image.Properties["os"],
+		Release:      image.Properties["release"],
+		Architecture: image.Properties["architecture"],
+		Created:      created,
+		Size:         image.Size,
+		Files:        files,
+		Signature:    image.Signature,
+	})
+	return true, fs.writeIndex(entries)
+}
+
+// writeContents writes the Contents of a GoImage into dir and returns their file names. The fingerprint and
+// size of plaintext Contents are checked against the GoImage and filled in, encrypted Contents can only be
+// stored with the Fingerprint and TarMeta they were exported with
+func (fs *FSImageStore) writeContents(dir string, image *GoImage) ([]string, error) {
+	encrypted := false
+	for _, contents := range image.Contents {
+		encrypted = encrypted || isEncrypted(contents)
+	}
+	var names []string
+	parts := image.Contents
+	if len(image.TarMeta) == len(parts) {
+		byName := map[string][]byte{}
+		for ind, name := range image.TarMeta {
+			byName[name] = parts[ind]
+		}
+		names = append(names, image.TarMeta...)
+		sortImageParts(names)
+		parts = nil
+		for _, name := range names {
+			parts = append(parts, byName[name])
+		}
+	} else if encrypted && len(parts) > 1 {
+		return nil, errors.New("an encrypted split image needs its TarMeta file names")
+	} else if len(parts) == 2 && isRootfs(detectImageCompression(parts[0])) {
+		parts = [][]byte{parts[1], parts[0]}
+	}
+	if !encrypted {
+		hash := sha256.New()
+		var size int64
+		for _, part := range parts {
+			hash.Write(part)
+			size += int64(len(part))
+		}
+		fingerprint := hex.EncodeToString(hash.Sum(nil))
+		if image.Fingerprint != "" && !strings.HasPrefix(fingerprint, image.Fingerprint) {
+			return nil, &OpError{"store image", image.Name, ErrImageMismatch, fmt.Errorf("image content fingerprint is %s, expected %s", fingerprint, image.Fingerprint)}
+		}
+		image.Fingerprint, image.Size = fingerprint, size
+	} else if !isFingerprint(image.Fingerprint) {
+		return nil, errors.New("an encrypted image can only be stored with its fingerprint")
+	}
+	if names == nil {
+		for ind, part := range parts {
+			name := imageFileName(image.Fingerprint, len(parts) > 1 && ind == 0, detectImageCompression(part))
+			if encrypted {
+				name += encryptedExt
+			}
+			names = append(names, name)
+		}
+	}
+	for ind, name := range names {
+		name, err := storedFileName(name)
+		if err == nil {
+			err = ioutil.WriteFile(filepath.Join(dir, name), parts[ind], 0644)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// storedFileName checks an image file name is a plain file name that can be stored
+func storedFileName(fileName string) (string, error) {
+	if fileName == "" || fileName != filepath.Base(fileName) || strings.HasPrefix(fileName, ".") {
+		return "", fmt.Errorf("invalid image file name: %q", fileName)
+	}
+	return fileName, nil
+}
+
+// writeStoredFile copies an image file from r to fPath
+func writeStoredFile(fPath string, r io.Reader) error {
+	f, err := os.OpenFile(fPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Open returns the files of a GoImage in the FSImageStore, its metadata first
+func (fs *FSImageStore) Open(ctx context.Context, name string) ([]io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	entry, _, err := fs.find("open stored image", name)
+	if err != nil {
+		return nil, err
+	}
+	var files []io.ReadCloser
+	for _, fName := range entry.Files {
+		f, err := os.Open(filepath.Join(fs.Dir, entry.Fingerprint, fName))
+		if err != nil {
+			for _, opened := range files {
+				opened.Close()
+			}
+			return nil, &OpError{"open stored image", name, nil, err}
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// Delete removes a GoImage from the FSImageStore
+func (fs *FSImageStore) Delete(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	entry, entries, err := fs.find("delete stored image", name)
+	if err != nil {
+		return err
+	}
+	return newOpError("delete stored image", name, fs.delete(entry, entries), nil)
+}
+
+// delete removes an entry from the index and its files, with fs.mu held
+func (fs *FSImageStore) delete(entry *imageIndexEntry, entries []*imageIndexEntry) error {
+	var kept []*imageIndexEntry
+	for _, other := range entries {
+		if other != entry {
+			kept = append(kept, other)
+		}
+	}
+	if err := fs.writeIndex(kept); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(fs.Dir, entry.Fingerprint))
+}
+
+// Prune deletes the GoImages in the FSImageStore created more than maxAge ago that match accepts
+func (fs *FSImageStore) Prune(ctx context.Context, maxAge time.Duration, match func(*GoImage) bool) ([]*GoImage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	entries, err := fs.readIndex()
+	if err != nil {
+		return nil, &OpError{"prune stored images", fs.Dir, nil, err}
+	}
+	var pruned []*GoImage
+	var kept []*imageIndexEntry
+	cutoff := time.Now().Add(-maxAge)
+	for _, entry := range entries {
+		created, err := time.Parse(time.RFC3339, entry.Created)
+		img := entry.goImage()
+		if err != nil || !created.Before(cutoff) || match != nil && !match(img) {
+			kept = append(kept, entry)
+			continue
+		}
+		pruned = append(pruned, img)
+	}
+	if len(pruned) == 0 {
+		return pruned, nil
+	}
+	if err = fs.writeIndex(kept); err != nil {
+		return nil, &OpError{"prune stored images", fs.Dir, nil, err}
+	}
+	for _, img := range pruned {
+		if err = os.RemoveAll(filepath.Join(fs.Dir, img.Fingerprint)); err != nil {
+			return pruned, &OpError{"prune stored images", img.Name, nil, err}
+		}
+	}
+	return pruned, nil
+}
@@ -0,0 +1,293 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestImageStore
+func TestImageStore(t *testing.T) {
+	t.Run("PutGet", testImageStorePutGet)
+	t.Run("DeletePrune", testImageStoreDeletePrune)
+	t.Run("ClusterStore", testImageStoreCluster)
+	t.Run("ImportFingerprint", testImageStoreImportFingerprint)
+}
+
+// newTestImageStore creates an FSImageStore in a temporary directory
+func newTestImageStore(t *testing.T) (*FSImageStore, func()) {
+	dir, err := ioutil.TempDir("", "imagestore")
+	if err != nil {
+		t.Fatalf("Error Creating Image Store Directory: %v", err)
+	}
+	store, err := NewFSImageStore(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Error Creating Image Store: %v", err)
+	}
+	return store, func() { os.RemoveAll(dir) }
+}
+
+// testImageStorePutGet
+func testImageStorePutGet(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testImageStorePutGet...")
+	store, cleanup := newTestImageStore(t)
+	defer cleanup()
+	ctx := context.Background()
+	fmt.Println("----------->BEGINNING A: Storing Images...")
+	unified := NewGoImage("golden", "container", "", "2021-04-18T10:00:00Z")
+	unified.Contents = [][]byte{append([]byte{0x1f, 0x8b}, "tarball"...)}
+	unified.Properties = map[string]string{"os": "ubuntu", "release": "focal", "architecture": "x86_64"}
+	if err := store.Put(ctx, unified); err != nil {
+		t.Fatalf("Error Storing Unified Image: %v", err)
+	}
+	split := NewGoImage("split", "virtual-machine", "", "")
+	split.TarMeta = []string{"disk.qcow2", "meta-disk.tar.xz"}
+	split.Contents = [][]byte{append([]byte{'Q', 'F', 'I', 0xfb}, "disk"...), append([]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, "metadata"...)}
+	if err := store.Put(ctx, split); err != nil {
+		t.Fatalf("Error Storing Split Image: %v", err)
+	}
+	if !isFingerprint(unified.Fingerprint) || unified.Size != int64(len(unified.Contents[0])) {
+		t.Errorf("Expected Put To Fill In The Fingerprint And Size, Got %s %d", unified.Fingerprint, unified.Size)
+	}
+	fmt.Println("----------->PASSED A: Storing Images...")
+	fmt.Println("----------->BEGINNING B: Getting Images...")
+	for _, name := range []string{"golden", unified.Fingerprint, unified.Fingerprint[:12]} {
+		img, err := store.Get(ctx, name)
+		if err != nil || img.Fingerprint != unified.Fingerprint {
+			t.Fatalf("Expected To Get The Unified Image By %s, Got %v", name, err)
+		}
+		if img.Properties["os"] != "ubuntu" || img.Properties["release"] != "focal" || img.Properties["architecture"] != "x86_64" || img.DateTime != unified.DateTime {
+			t.Errorf("Expected The Indexed Image Details, Got %+v", img)
+		}
+	}
+	img, err := store.Get(ctx, "split")
+	if err != nil || img.Format != ImageSplit || !img.IsVM() || len(img.Contents) != 0 {
+		t.Fatalf("Expected A Split VM Image Without Contents, Got %+v %v", img, err)
+	}
+	files, err := store.Open(ctx, "split")
+	if err != nil || len(files) != 2 {
+		t.Fatalf("Error Opening Split Image: %v", err)
+	}
+	for ind, expected := range [][]byte{split.Contents[1], split.Contents[0]} {
+		contents, _ := ioutil.ReadAll(files[ind])
+		files[ind].Close()
+		if !bytes.Equal(contents, expected) {
+			t.Errorf("Expected File %d To Be Opened Metadata First, Got %q", ind, contents)
+		}
+	}
+	if _, err = store.Get(ctx, "missing"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("Expected ErrImageNotFound, Got %v", err)
+	}
+	fmt.Println("----------->PASSED B: Getting Images...")
+	fmt.Println("----------->BEGINNING C: Deduplicating Images...")
+	copied := NewGoImage("golden-copy", "container", "", "")
+	copied.Contents = unified.Contents
+	if err = store.Put(ctx, copied); err != nil {
+		t.Fatalf("Error Storing Copied Image: %v", err)
+	}
+	images, err := store.List(ctx)
+	if err != nil || len(images) != 2 {
+		t.Fatalf("Expected Two Stored Images, Got %d %v", len(images), err)
+	}
+	img, err = store.Get(ctx, "golden-copy")
+	if err != nil || img.Name != "golden" || len(img.Aliases) != 1 || img.Aliases[0] != "golden-copy" {
+		t.Errorf("Expected The Copy To Be Indexed As An Alias Of The Stored Image, Got %+v %v", img, err)
+	}
+	mismatch := NewGoImage("mismatch", "", strings.Repeat("0", 12), "")
+	mismatch.Contents = [][]byte{append([]byte{0x1f, 0x8b}, "other"...)}
+	if err = store.Put(ctx, mismatch); !errors.Is(err, ErrImageMismatch) {
+		t.Errorf("Expected ErrImageMismatch, Got %v", err)
+	}
+	entries, _ := ioutil.ReadDir(store.Dir)
+	if len(entries) != 3 {
+		t.Errorf("Expected Two Image Directories And The Index, Got %d Entries", len(entries))
+	}
+	fmt.Println("----------->PASSED C: Deduplicating Images...")
+	fmt.Println("<-----------testImageStorePutGet COMPLETE")
+}
+
+// testImageStoreDeletePrune
+func testImageStoreDeletePrune(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testImageStoreDeletePrune...")
+	store, cleanup := newTestImageStore(t)
+	defer cleanup()
+	ctx := context.Background()
+	old := time.Now().Add(-48 * time.Hour).UTC().Format(time.RFC3339)
+	for _, tt := range []struct {
+		name    string
+		created string
+	}{{"stale", old}, {"golden", old}, {"fresh", ""}} {
+		img := NewGoImage(tt.name, "", "", tt.created)
+		img.Contents = [][]byte{append([]byte{0x1f, 0x8b}, tt.name...)}
+		if err := store.Put(ctx, img); err != nil {
+			t.Fatalf("Error Storing %s: %v", tt.name, err)
+		}
+	}
+	fmt.Println("----------->BEGINNING A: Pruning Images...")
+	pruned, err := store.Prune(ctx, 24*time.Hour, func(img *GoImage) bool {
+		return img.Name != "golden"
+	})
+	if err != nil || len(pruned) != 1 || pruned[0].Name != "stale" {
+		t.Fatalf("Expected Only The Stale Image To Be Pruned, Got %v %v", pruned, err)
+	}
+	if _, err = os.Stat(filepath.Join(store.Dir, pruned[0].Fingerprint)); !os.IsNotExist(err) {
+		t.Errorf("Expected The Pruned Image's Files To Be Removed")
+	}
+	fmt.Println("----------->PASSED A: Pruning Images...")
+	fmt.Println("----------->BEGINNING B: Deleting Images...")
+	if err = store.Delete(ctx, "golden"); err != nil {
+		t.Fatalf("Error Deleting Image: %v", err)
+	}
+	if err = store.Delete(ctx, "golden"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("Expected ErrImageNotFound, Got %v", err)
+	}
+	images, err := store.List(ctx)
+	if err != nil || len(images) != 1 || images[0].Name != "fresh" {
+		t.Errorf("Expected Only The Fresh Image To Be Left, Got %v %v", images, err)
+	}
+	fmt.Println("----------->PASSED B: Deleting Images...")
+	fmt.Println("<-----------testImageStoreDeletePrune COMPLETE")
+}
+
+// testImageStoreCluster
+func testImageStoreCluster(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testImageStoreCluster...")
+	goCluster, fake := newTestCluster("")
+	store, cleanup := newTestImageStore(t)
+	defer cleanup()
+	goCluster.Store = store
+	if err := goCluster.CreateContainer(NewAuth("tester", AuthPassword, "l0lThis1sAWeak1", "", "22"), false, "StoreTest", "ubuntu", "focal", []byte{}); err != nil {
+		t.Fatalf("Error Creating Store Test Container: %v", err)
+	}
+	defer goCluster.DeleteContainer("StoreTest")
+	fmt.Println("----------->BEGINNING A: Exporting Into The Store...")
+	exported, err := goCluster.ExportContainer("StoreTest")
+	if err != nil {
+		t.Fatalf("Error Exporting Into The Store: %v", err)
+	}
+	if len(exported.Contents) != 0 || exported.Verified == "" {
+		t.Errorf("Expected A Verified Export Streamed Into The Store")
+	}
+	stored, err := store.Get(context.Background(), exported.Name)
+	if err != nil || stored.Fingerprint != exported.Fingerprint || stored.Properties["os"] != "ubuntu" {
+		t.Fatalf("Expected The Export To Be Indexed With Its OS, Got %+v %v", stored, err)
+	}
+	fmt.Println("----------->PASSED A: Exporting Into The Store...")
+	fmt.Println("----------->BEGINNING B: Importing From The Store...")
+	imported, err := goCluster.ImportContainer("StoreImport", NewGoImage(stored.Name, "", "", ""))
+	if err != nil {
+		t.Fatalf("Error Importing From The Store: %v", err)
+	}
+	defer goCluster.DeleteContainer("StoreImport")
+	if imported.Name != "StoreImport" {
+		t.Errorf("Expected The Imported Container, Got %s", imported.Name)
+	}
+	fmt.Println("----------->PASSED B: Importing From The Store...")
+	if fake == nil {
+		fmt.Println("<-----------testImageStoreCluster COMPLETE")
+		return
+	}
+	fmt.Println("----------->BEGINNING C: Storing Encrypted Exports...")
+	key := make([]byte, 32)
+	if _, err = rand.Read(key); err != nil {
+		t.Fatalf("Error Generating Key: %v", err)
+	}
+	goCluster.Keys = NewStaticKeys("store", key)
+	if err = goCluster.CreateContainer(NewAuth("tester", AuthPassword, "l0lThis1sAWeak1", "", "22"), false, "StoreSecret", "ubuntu", "focal", []byte{}); err != nil {
+		t.Fatalf("Error Creating Encrypted Store Test Container: %v", err)
+	}
+	defer goCluster.DeleteContainer("StoreSecret")
+	encrypted, err := goCluster.ExportContainer("StoreSecret")
+	if err != nil {
+		t.Fatalf("Error Exporting Encrypted Into The Store: %v", err)
+	}
+	files, err := store.Open(context.Background(), encrypted.Fingerprint)
+	if err != nil {
+		t.Fatalf("Error Opening Encrypted Image: %v", err)
+	}
+	header := make([]byte, len(encryptedMagic))
+	_, err = files[0].Read(header)
+	files[0].Close()
+	if err != nil || !isEncrypted(header) {
+		t.Errorf("Expected The Stored Image To Be Encrypted")
+	}
+	if _, err = goCluster.ImportContainer("StoreEncrypted", encrypted); err != nil {
+		t.Fatalf("Error Importing Encrypted From The Store: %v", err)
+	}
+	defer goCluster.DeleteContainer("StoreEncrypted")
+	fmt.Println("----------->PASSED C: Storing Encrypted Exports...")
+	fmt.Println("<-----------testImageStoreCluster COMPLETE")
+}
+
+// testImageStoreImportFingerprint
+func testImageStoreImportFingerprint(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testImageStoreImportFingerprint...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("The test image has no init system to boot")
+	}
+	store, cleanup := newTestImageStore(t)
+	defer cleanup()
+	goCluster.Store = store
+	ctx := context.Background()
+	tarball, err := fakeImageTarball("ubuntu", "focal", map[string][]byte{"/etc/stored": []byte("yes")})
+	if err != nil {
+		t.Fatalf("Error Building Test Image: %v", err)
+	}
+	img := NewGoImage("signed-golden", "container", "", "2021-04-18T10:00:00Z")
+	img.Contents = [][]byte{tarball}
+	img.Properties = map[string]string{"os": "ubuntu", "release": "focal"}
+	if err = store.Put(ctx, img); err != nil {
+		t.Fatalf("Error Storing Image: %v", err)
+	}
+	fmt.Println("----------->BEGINNING A: Importing By Fingerprint Only...")
+	if _, err = goCluster.ImportContainer("StoreByFingerprint", NewGoImage("", "", img.Fingerprint, "")); err != nil {
+		t.Fatalf("Error Importing By Fingerprint: %v", err)
+	}
+	defer goCluster.DeleteContainer("StoreByFingerprint")
+	if string(fake.Containers["StoreByFingerprint"].Files["/etc/stored"]) != "yes" {
+		t.Errorf("Expected The Container To Be Launched From The Stored Image")
+	}
+	fmt.Println("----------->PASSED A: Importing By Fingerprint Only...")
+	fmt.Println("----------->BEGINNING B: Importing A Signed Image By Fingerprint Only...")
+	pub, priv := newTestSigningKey(t)
+	if err = img.Sign(priv); err != nil {
+		t.Fatalf("Error Signing Image: %v", err)
+	}
+	if err = store.Put(ctx, img); err != nil {
+		t.Fatalf("Error Storing Signature: %v", err)
+	}
+	goCluster.Policy = NewSignaturePolicy(SignatureRequire, pub)
+	if _, err = goCluster.ImportContainer("StoreSigned", NewGoImage("", "", img.Fingerprint[:12], "")); err != nil {
+		t.Fatalf("Error Importing Signed Image By Fingerprint: %v", err)
+	}
+	defer goCluster.DeleteContainer("StoreSigned")
+	other, _ := newTestSigningKey(t)
+	goCluster.Policy = NewSignaturePolicy(SignatureRequire, other)
+	if _, err = goCluster.ImportContainer("StoreUntrusted", NewGoImage("", "", img.Fingerprint, "")); !errors.Is(err, ErrImageSignature) {
+		t.Errorf("Expected ErrImageSignature, Got %v", err)
+	}
+	fmt.Println("----------->PASSED B: Importing A Signed Image By Fingerprint Only...")
+	fmt.Println("<-----------testImageStoreImportFingerprint COMPLETE")
+}
@@ -0,0 +1,174 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// KnownHostsFile is the known_hosts file go-containers keeps its GoContainers' SSH host keys in, by container name
+var KnownHostsFile = defaultKnownHostsFile()
+
+// knownHostsMu guards reads and writes of the KnownHostsFile
+var knownHostsMu sync.Mutex
+
+// hostKeysCMD prints a container's SSH host public keys
+const hostKeysCMD = `cat /etc/ssh/ssh_host_*_key.pub`
+
+// defaultKnownHostsFile returns the known_hosts file under the user's config directory
+func defaultKnownHostsFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "go-containers", "known_hosts")
+}
+
+// readKnownHosts returns the lines of the KnownHostsFile, none if it does not exist yet
+func readKnownHosts() ([]string, error) {
+	contents, err := ioutil.ReadFile(KnownHostsFile)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	} else if err != nil {
+		return []string{}, err
+	}
+	return strings.Split(strings.TrimSpace(string(contents)), "\n"), nil
+}
+
+// writeKnownHosts replaces the KnownHostsFile with lines
+func writeKnownHosts(lines []string) error {
+	if err := os.MkdirAll(filepath.Dir(KnownHostsFile), 0700); err != nil {
+		return err
+	}
+	tmpFile := KnownHostsFile + ".tmp"
+	contents := strings.Join(lines, "\n")
+	if contents != "" {
+		contents = contents + "\n"
+	}
+	if err := ioutil.WriteFile(tmpFile, []byte(contents), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, KnownHostsFile)
+}
+
+// knownHostsName returns the first host pattern of a known_hosts line
+func knownHostsName(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return ""
+	}
+	return strings.Split(fields[0], ",")[0]
+}
+
+// getHostKeys returns the host keys known for the container name
+func getHostKeys(name string) ([]ssh.PublicKey, error) {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+	var keys []ssh.PublicKey
+	lines, err := readKnownHosts()
+	if err != nil {
+		return keys, err
+	}
+	entry := knownhosts.Normalize(name)
+	for _, line := range lines {
+		if knownHostsName(line) != entry {
+			continue
+		}
+		_, _, key, _, _, err := ssh.ParseKnownHosts([]byte(line))
+		if err != nil {
+			return keys, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// setHostKeys replaces the host keys known for the container name, no keys forgets the container
+func setHostKeys(name string, keys []ssh.PublicKey) error {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+	lines, err := readKnownHosts()
+	if err != nil {
+		return err
+	}
+	entry := knownhosts.Normalize(name)
+	var newLines []string
+	for _, line := range lines {
+		if line != "" && knownHostsName(line) != entry {
+			newLines = append(newLines, line)
+		}
+	}
+	for _, key := range keys {
+		newLines = append(newLines, knownhosts.Line([]string{name}, key))
+	}
+	return writeKnownHosts(newLines)
+}
+
+// parseHostKeys reads the public keys out of the contents of ssh_host_*_key.pub files
+func parseHostKeys(out []byte) ([]ssh.PublicKey, error) {
+	var keys []ssh.PublicKey
+	rest := bytes.TrimSpace(out)
+	for len(rest) > 0 {
+		key, _, _, next, err := ssh.ParseAuthorizedKey(rest)
+		if err != nil {
+			return keys, err
+		}
+		keys = append(keys, key)
+		rest = next
+	}
+	if len(keys) == 0 {
+		return keys, fmt.Errorf("no ssh host keys found")
+	}
+	return keys, nil
+}
+
+// captureHostKeys reads a GoContainer's SSH host keys through LXD and stores them in the KnownHostsFile
+func (co *GoContainer) captureHostKeys(ctx context.Context) ([]ssh.PublicKey, error) {
+	out, _, err := co.getBackend().Exec(ctx, co.Name, []string{"sh", "-c", hostKeysCMD})
+	if err != nil {
+		return []ssh.PublicKey{}, err
+	}
+	keys, err := parseHostKeys(out)
+	if err != nil {
+		return keys, err
+	}
+	return keys, setHostKeys(co.Name, keys)
+}
+
+// hostKeyChecker verifies an SSH server's host key against the keys known for a GoContainer
+type hostKeyChecker struct {
+	name string
+	keys []ssh.PublicKey
+	err  error
+}
+
+// check is an ssh.HostKeyCallback that records why it rejected a host key
+func (hc *hostKeyChecker) check(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	for _, known := range hc.keys {
+		if bytes.Equal(known.Marshal(), key.Marshal()) {
+			return nil
+		}
+	}
+	hc.err = fmt.Errorf("%s presented the %s host key %s, which is not a known host key of %s", remote, key.Type(), ssh.FingerprintSHA256(key), hc.name)
+	return hc.err
+}
@@ -0,0 +1,101 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// TestKnownHosts
+func TestKnownHosts(t *testing.T) {
+	t.Run("CaptureAndForget", testKnownHostsCaptureAndForget)
+	t.Run("Mismatch", testKnownHostsMismatch)
+	t.Run("Unknown", testKnownHostsUnknown)
+}
+
+// testKnownHostsCaptureAndForget
+func testKnownHostsCaptureAndForget(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testKnownHostsCaptureAndForget...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("host key checks need the FakeBackend")
+	}
+	if err := goCluster.CreateContainer(&Auth{}, false, "HostKeyTest", "ubuntu", "focal", []byte{}); err != nil {
+		t.Fatalf("Error Creating Host Key Test Container: %v", err)
+	}
+	keys, err := getHostKeys("HostKeyTest")
+	if err != nil {
+		t.Fatalf("Error Reading Known Host Keys: %v", err)
+	}
+	hostKey := fake.Containers["HostKeyTest"].HostKey.PublicKey()
+	if len(keys) != 1 || !bytes.Equal(keys[0].Marshal(), hostKey.Marshal()) {
+		t.Errorf("Expected the container's host key to be known after creating it, got %d keys", len(keys))
+	}
+	if err = goCluster.DeleteContainer("HostKeyTest"); err != nil {
+		t.Fatalf("Error Deleting Host Key Test Container: %v", err)
+	}
+	if keys, _ = getHostKeys("HostKeyTest"); len(keys) != 0 {
+		t.Errorf("Expected the container's host key to be forgotten after deleting it, got %d keys", len(keys))
+	}
+	fmt.Println("<-----------testKnownHostsCaptureAndForget COMPLETE")
+}
+
+// testKnownHostsMismatch
+func testKnownHostsMismatch(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testKnownHostsMismatch...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("host key checks need the FakeBackend")
+	}
+	cAuth := NewAuth("tester", AuthPassword, "l0lThis1sAWeak1", "", "22")
+	if err := goCluster.CreateContainer(cAuth, false, "MismatchTest", "ubuntu", "focal", []byte{}); err != nil {
+		t.Fatalf("Error Creating Mismatch Test Container: %v", err)
+	}
+	// another container answering on the address MismatchTest had, such as after lxdbr0 reuses its IP
+	_, otherKey := newTestKey(t)
+	cAuth.Port = startTestSSHServer(t, otherKey, "tester", "l0lThis1sAWeak1")
+	goCon := &GoContainer{Name: "MismatchTest", Network: &Network{PrivateIP: "127.0.0.1"}, Auth: cAuth}
+	goCon.SetBackend(fake)
+	if err := goCon.OpenSSH(); !errors.Is(err, ErrHostKeyMismatch) {
+		t.Errorf("Expected ErrHostKeyMismatch, got %v", err)
+	}
+	cAuth.Port = startTestSSHServer(t, fake.Containers["MismatchTest"].HostKey, "tester", "l0lThis1sAWeak1")
+	if err := goCon.OpenSSH(); err != nil {
+		t.Fatalf("Error Opening SSHClient with the known host key: %v", err)
+	}
+	_ = goCon.SSHClient.Close()
+	fmt.Println("<-----------testKnownHostsMismatch COMPLETE")
+}
+
+// testKnownHostsUnknown
+func testKnownHostsUnknown(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testKnownHostsUnknown...")
+	_, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("host key checks need the FakeBackend")
+	}
+	fakeCon := fake.AddContainer("UnknownKeyTest", "ubuntu", "focal")
+	_ = setHostKeys("UnknownKeyTest", nil)
+	delete(fakeCon.Files, "/etc/ssh/ssh_host_ed25519_key.pub")
+	cAuth := NewAuth("tester", AuthPassword, "l0lThis1sAWeak1", "", "22")
+	cAuth.Port = startTestSSHServer(t, fakeCon.HostKey, "tester", "l0lThis1sAWeak1")
+	goCon := &GoContainer{Name: "UnknownKeyTest", Network: &Network{PrivateIP: "127.0.0.1"}, Auth: cAuth}
+	goCon.SetBackend(fake)
+	if err := goCon.OpenSSH(); !errors.Is(err, ErrHostKeyUnknown) {
+		t.Errorf("Expected ErrHostKeyUnknown, got %v", err)
+	}
+	fmt.Println("<-----------testKnownHostsUnknown COMPLETE")
+}
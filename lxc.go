@@ -13,72 +13,17 @@ Copyright 2021 John Connor Sanders
 package containers
 
 import (
+	"context"
 	"encoding/json"
-	"log"
-	"strings"
 )
 
-// TODO: Build in system for generating cloud init config with proper ssh keys!
-const SRCYAML = `cat <<EOF 
-#cloud-config
-users:
-  - name: {{Username}}
-    plain_text_passwd: {{Password}}
-    ssh_pwauth: True
-    lock_passwd: False
-    sudo: ['ALL=(ALL) NOPASSWD:ALL']
-    groups: sudo
-    shell: /bin/bash
-write_files:
-  - path: /etc/ssh/sshd_config
-    content: |
-      Port {{Port}}
-      Protocol 2
-      UsePrivilegeSeparation yes
-      KeyRegenerationInterval 3600
-      ServerKeyBits 1024
-      SyslogFacility AUTH
-      LogLevel INFO
-      LoginGraceTime 120
-      PermitRootLogin no
-      StrictModes yes
-      RSAAuthentication yes
-      PubkeyAuthentication yes
-      PasswordAuthentication yes
-      IgnoreRhosts yes
-      RhostsRSAAuthentication no
-      HostbasedAuthentication no
-      PermitEmptyPasswords no
-      ChallengeResponseAuthentication no
-      X11Forwarding yes
-      X11DisplayOffset 10
-      PrintMotd no
-      PrintLastLog yes
-      TCPKeepAlive yes
-      AcceptEnv LANG LC_*
-      Subsystem sftp /usr/lib/openssh/sftp-server
-      UsePAM yes
-      AllowUsers {{Username}}
-runcmd:
-  - systemctl restart sshd
-EOF
-`
-
-// generateCloudInit
-func generateCloudInit(auth *Auth) []byte {
-	newInitFile := SRCYAML
-	newInitFile = strings.Replace(newInitFile, "{{Username}}", auth.User, -1)
-	newInitFile = strings.Replace(newInitFile, "{{Password}}", auth.Credential, -1)
-	newInitFile = strings.Replace(newInitFile, "{{Port}}", auth.Port, -1)
-	return []byte(newInitFile)
-}
-
 // LXCConfig
 type LXCConfig struct {
 	ImageArchitecture string `json:"image.architecture,omitempty"`
 	ImageDescription  string `json:"image.description,omitempty"`
 	ImageOS           string `json:"image.os,omitempty"`
 	ImageRelease      string `json:"image.release,omitempty"`
+	BaseImage         string `json:"volatile.base_image,omitempty"`
 }
 
 // ContainerNetwork
@@ -136,7 +81,6 @@ func LoadListOut(jsonStr string) (*ListOutput, error) {
 	var lOutput ListOutput
 	var output []ContainerOutput
 	if err := json.Unmarshal([]byte(jsonStr), &output); err != nil {
-		log.Fatal(err.Error())
 		return &lOutput, err
 	}
 	lOutput.Outputs = output
@@ -145,11 +89,17 @@ func LoadListOut(jsonStr string) (*ListOutput, error) {
 
 // GetContainers
 func (lo *ListOutput) GetContainers() []*GoContainer {
+	return lo.goContainers(context.Background(), nil)
+}
+
+// goContainers loads a GoContainer using backend b for each ContainerOutput
+func (lo *ListOutput) goContainers(ctx context.Context, b Backend) []*GoContainer {
 	var containers []*GoContainer
 	for _, out := range lo.Outputs {
 		var container GoContainer
+		container.backend = b
 		_ = container.loadListOutput(&out)
-		_ = container.loadNetworkData("lxdbr0")
+		_ = container.loadNetworkData(ctx, "lxdbr0")
 		containers = append(containers, &container)
 	}
 	return containers
@@ -174,7 +124,6 @@ func LoadNetworkOutput(jsonStr string) (*NetworkOutput, error) {
 	var lOutput NetworkOutput
 	var nEntries []NetworkEntry
 	if err := json.Unmarshal([]byte(jsonStr), &nEntries); err != nil {
-		log.Fatal(err.Error())
 		return &lOutput, err
 	}
 	lOutput.NetworkEntries = nEntries
@@ -200,15 +149,57 @@ type ImageProperties struct {
 	OSRelease    string `json:"os_release,omitempty"`
 }
 
+// ImageAlias
+type ImageAlias struct {
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// ImageAliasesEntry points an ImageAlias at an image
+type ImageAliasesEntry struct {
+	ImageAlias
+	Target string `json:"target"`
+}
+
 // ImageOutput
 type ImageOutput struct {
-	Public      bool            `json:"public,omitempty"`
-	Props       ImageProperties `json:"properties,omitempty"`
-	Filename    string          `json:"filename,omitempty"`
-	Fingerprint string          `json:"fingerprint,omitempty"`
-	Size        int             `json:"size,omitempty"`
-	Type        string          `json:"type,omitempty"`
-	Created     string          `json:"created_at,omitempty"`
+	Public      bool              `json:"public,omitempty"`
+	AutoUpdate  bool              `json:"auto_update,omitempty"`
+	Cached      bool              `json:"cached,omitempty"`
+	Aliases     []ImageAlias      `json:"aliases,omitempty"`
+	Props       ImageProperties   `json:"properties,omitempty"`
+	Properties  map[string]string `json:"-"`
+	Filename    string            `json:"filename,omitempty"`
+	Fingerprint string            `json:"fingerprint,omitempty"`
+	Size        int               `json:"size,omitempty"`
+	Type        string            `json:"type,omitempty"`
+	Created     string            `json:"created_at,omitempty"`
+	LastUsed    string            `json:"last_used_at,omitempty"`
+}
+
+// UnmarshalJSON loads an ImageOutput, keeping every image property in Properties
+func (imo *ImageOutput) UnmarshalJSON(data []byte) error {
+	type imageOutputJSON ImageOutput
+	var out imageOutputJSON
+	if err := json.Unmarshal(data, &out); err != nil {
+		return err
+	}
+	var props struct {
+		Properties map[string]string `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &props); err != nil {
+		return err
+	}
+	out.Properties = props.Properties
+	*imo = ImageOutput(out)
+	return nil
+}
+
+// ImageUpdate holds the fields of an image that can be edited
+type ImageUpdate struct {
+	Properties map[string]string `json:"properties"`
+	Public     bool              `json:"public"`
+	AutoUpdate bool              `json:"auto_update"`
 }
 
 // ImagesOutput
@@ -217,21 +208,42 @@ type ImagesOutput struct {
 }
 
 // LoadImagesOutput
-func LoadImagesOutput(jsonStr string) *ImagesOutput {
+func LoadImagesOutput(jsonStr string) (*ImagesOutput, error) {
 	var imagesOutput ImagesOutput
-	if err := json.Unmarshal([]byte(jsonStr), &imagesOutput); err != nil {
-		log.Fatal(err.Error())
-		return &imagesOutput
+	var outputs []ImageOutput
+	if err := json.Unmarshal([]byte(jsonStr), &outputs); err != nil {
+		return &imagesOutput, err
 	}
-	return &imagesOutput
+	imagesOutput.Outputs = outputs
+	return &imagesOutput, nil
 }
 
 // GetImages
 func (imo *ImagesOutput) GetImages() []*GoImage {
+	return imo.goImages(nil)
+}
+
+// goImages loads a GoImage using backend b for each ImageOutput
+func (imo *ImagesOutput) goImages(b Backend) []*GoImage {
 	var reImgs []*GoImage
 	for _, imgOut := range imo.Outputs {
-		name := strings.Replace(imgOut.Filename, ".tar.xz", "", 1)
+		name := imgOut.Fingerprint
+		var aliases []string
+		for _, alias := range imgOut.Aliases {
+			aliases = append(aliases, alias.Name)
+		}
+		if len(aliases) > 0 {
+			name = aliases[0]
+		}
 		newImg := NewGoImage(name, imgOut.Type, imgOut.Fingerprint, imgOut.Created)
+		newImg.Aliases = aliases
+		newImg.Properties = imgOut.Properties
+		newImg.Public = imgOut.Public
+		newImg.AutoUpdate = imgOut.AutoUpdate
+		newImg.Cached = imgOut.Cached
+		newImg.LastUsed = imgOut.LastUsed
+		newImg.Size = int64(imgOut.Size)
+		newImg.backend = b
 		reImgs = append(reImgs, newImg)
 	}
 	return reImgs
@@ -0,0 +1,642 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LXDRemotes maps the lxc CLI's default image remotes to their simplestreams servers
+var LXDRemotes = map[string]string{
+	"images":       "https://images.linuxcontainers.org",
+	"ubuntu":       "https://cloud-images.ubuntu.com/releases",
+	"ubuntu-daily": "https://cloud-images.ubuntu.com/daily",
+}
+
+// lxdRemoteCertificates holds the certificates of the image remotes added with RESTBackend.AddRemote
+var lxdRemoteCertificates = map[string]string{}
+
+// lxdRemotesMu guards LXDRemotes and lxdRemoteCertificates
+var lxdRemotesMu sync.RWMutex
+
+// findLXDSocket returns the path of the local LXD daemon's unix socket
+func findLXDSocket() string {
+	if socket := os.Getenv("LXD_SOCKET"); socket != "" {
+		return socket
+	}
+	if lxdDir := os.Getenv("LXD_DIR"); lxdDir != "" {
+		return filepath.Join(lxdDir, "unix.socket")
+	}
+	sockets := []string{"/var/snap/lxd/common/lxd/unix.socket", "/var/lib/lxd/unix.socket"}
+	for _, socket := range sockets {
+		if _, err := os.Stat(socket); err == nil {
+			return socket
+		}
+	}
+	return sockets[0]
+}
+
+// LXDError is an error returned by the LXD daemon
+type LXDError struct {
+	Code    int
+	Message string
+}
+
+// Error returns the LXDError's message
+func (e *LXDError) Error() string {
+	return fmt.Sprintf("lxd error %d: %s", e.Code, e.Message)
+}
+
+// LXDResponse is the envelope of every LXD REST API response
+type LXDResponse struct {
+	Type       string          `json:"type"`
+	Status     string          `json:"status,omitempty"`
+	StatusCode int             `json:"status_code,omitempty"`
+	Operation  string          `json:"operation,omitempty"`
+	ErrorCode  int             `json:"error_code,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Metadata   json.RawMessage `json:"metadata,omitempty"`
+}
+
+// LXDOperation is a background operation running on the LXD daemon
+type LXDOperation struct {
+	ID          string                 `json:"id"`
+	Class       string                 `json:"class"`
+	Description string                 `json:"description"`
+	Status      string                 `json:"status"`
+	StatusCode  int                    `json:"status_code"`
+	Metadata    map[string]interface{} `json:"metadata"`
+	MayCancel   bool                   `json:"may_cancel"`
+	Err         string                 `json:"err"`
+}
+
+// metadataString returns a string value from an LXDOperation's metadata
+func (op *LXDOperation) metadataString(key string) string {
+	if val, ok := op.Metadata[key].(string); ok {
+		return val
+	}
+	return ""
+}
+
+// LXDClient talks to the LXD daemon's REST API over its unix socket
+type LXDClient struct {
+	SocketPath string
+	HTTPClient *http.Client
+}
+
+// NewLXDClient creates a pointer to a new LXDClient, an empty socketPath uses the local LXD daemon
+func NewLXDClient(socketPath string) *LXDClient {
+	if socketPath == "" {
+		socketPath = findLXDSocket()
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	return &LXDClient{socketPath, &http.Client{Transport: transport}}
+}
+
+// Raw sends a request to the LXD daemon and returns the unparsed http.Response
+func (lc *LXDClient) Raw(ctx context.Context, method string, apiPath string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, "http://lxd"+apiPath, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for key, vals := range header {
+		for _, val := range vals {
+			req.Header.Add(key, val)
+		}
+	}
+	resp, err := lc.HTTPClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return nil, fmt.Errorf("%w: %v", ErrLXDUnavailable, err)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Query sends a JSON request to the LXD daemon and returns its LXDResponse
+func (lc *LXDClient) Query(ctx context.Context, method string, apiPath string, body interface{}) (*LXDResponse, error) {
+	var reqBody io.Reader
+	header := http.Header{}
+	if body != nil {
+		bBytes, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(bBytes)
+		header.Set("Content-Type", "application/json")
+	}
+	resp, err := lc.Raw(ctx, method, apiPath, reqBody, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return parseLXDResponse(resp)
+}
+
+// parseLXDResponse decodes an LXDResponse, returning an LXDError for error responses
+func parseLXDResponse(resp *http.Response) (*LXDResponse, error) {
+	var lxdResp LXDResponse
+	if err := json.NewDecoder(resp.Body).Decode(&lxdResp); err != nil {
+		return nil, fmt.Errorf("failed to decode lxd response for %s: %v", resp.Request.URL.Path, err)
+	}
+	if lxdResp.Type == "error" {
+		return &lxdResp, &LXDError{lxdResp.ErrorCode, lxdResp.Error}
+	}
+	return &lxdResp, nil
+}
+
+// Wait blocks until the LXDOperation of an async LXDResponse has finished, cancelling it once ctx is done
+func (lc *LXDClient) Wait(ctx context.Context, resp *LXDResponse) (*LXDOperation, error) {
+	var op LXDOperation
+	if resp.Type != "async" {
+		return &op, nil
+	}
+	waitResp, err := lc.Query(ctx, "GET", resp.Operation+"/wait", nil)
+	if err != nil {
+		if ctx.Err() != nil {
+			lc.cancel(resp.Operation)
+		}
+		return &op, err
+	}
+	if err = json.Unmarshal(waitResp.Metadata, &op); err != nil {
+		return &op, err
+	}
+	if op.StatusCode != http.StatusOK {
+		return &op, &LXDError{op.StatusCode, op.Err}
+	}
+	return &op, nil
+}
+
+// cancel asks the LXD daemon to cancel an operation, which LXD only honours for cancellable operations
+func (lc *LXDClient) cancel(opPath string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, _ = lc.Query(ctx, "DELETE", opPath, nil)
+}
+
+// Do sends a JSON request to the LXD daemon and waits for any resulting LXDOperation
+func (lc *LXDClient) Do(ctx context.Context, method string, apiPath string, body interface{}) (*LXDOperation, error) {
+	resp, err := lc.Query(ctx, method, apiPath, body)
+	if err != nil {
+		return nil, err
+	}
+	return lc.Wait(ctx, resp)
+}
+
+// Get sends a GET request to the LXD daemon and decodes the response metadata into target
+func (lc *LXDClient) Get(ctx context.Context, apiPath string, target interface{}) error {
+	resp, err := lc.Query(ctx, "GET", apiPath, nil)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(resp.Metadata, target)
+}
+
+// lxdImageSource is the source of a new instance or image
+type lxdImageSource struct {
+	Type        string `json:"type"`
+	Mode        string `json:"mode,omitempty"`
+	Server      string `json:"server,omitempty"`
+	Protocol    string `json:"protocol,omitempty"`
+	Alias       string `json:"alias,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Certificate string `json:"certificate,omitempty"`
+}
+
+// lxdExecOutput is the metadata of a finished exec LXDOperation
+type lxdExecOutput struct {
+	Return int               `json:"return"`
+	Output map[string]string `json:"output"`
+}
+
+// RESTBackend implements Backend with the LXD REST API
+type RESTBackend struct {
+	Client *LXDClient
+}
+
+// NewRESTBackend creates a pointer to a new RESTBackend
+func NewRESTBackend(client *LXDClient) *RESTBackend {
+	return &RESTBackend{client}
+}
+
+// instancePath returns the REST API path of an instance
+func instancePath(name string) string {
+	return "/1.0/instances/" + url.PathEscape(name)
+}
+
+// Launch creates and starts a new instance
+func (rb *RESTBackend) Launch(ctx context.Context, name string, remote string, alias string, config map[string]string) error {
+	source := lxdImageSource{Type: "image", Alias: alias}
+	if remote != "" {
+		lxdRemotesMu.RLock()
+		server, ok := LXDRemotes[remote]
+		source.Certificate = lxdRemoteCertificates[remote]
+		lxdRemotesMu.RUnlock()
+		if !ok {
+			return fmt.Errorf("unknown lxd image remote: %s", remote)
+		}
+		if alias == "" {
+			source.Alias = "default"
+		}
+		source.Mode = "pull"
+		source.Server = server
+		source.Protocol = "simplestreams"
+	}
+	req := map[string]interface{}{
+		"name":   name,
+		"source": source,
+		"config": config,
+	}
+	if _, err := rb.Client.Do(ctx, "POST", "/1.0/instances", req); err != nil {
+		return err
+	}
+	return rb.Start(ctx, name)
+}
+
+// changeState sends a state change action to an instance
+func (rb *RESTBackend) changeState(ctx context.Context, name string, action string) error {
+	req := map[string]interface{}{
+		"action":  action,
+		"timeout": 30,
+	}
+	_, err := rb.Client.Do(ctx, "PUT", instancePath(name)+"/state", req)
+	return err
+}
+
+// Start an instance
+func (rb *RESTBackend) Start(ctx context.Context, name string) error {
+	return rb.changeState(ctx, name, "start")
+}
+
+// Stop an instance
+func (rb *RESTBackend) Stop(ctx context.Context, name string) error {
+	return rb.changeState(ctx, name, "stop")
+}
+
+// Restart an instance
+func (rb *RESTBackend) Restart(ctx context.Context, name string) error {
+	return rb.changeState(ctx, name, "restart")
+}
+
+// Delete an instance
+func (rb *RESTBackend) Delete(ctx context.Context, name string) error {
+	_, err := rb.Client.Do(ctx, "DELETE", instancePath(name), nil)
+	return err
+}
+
+// Exec runs a command inside an instance and returns its stdout and stderr
+func (rb *RESTBackend) Exec(ctx context.Context, name string, argv []string) ([]byte, []byte, error) {
+	req := map[string]interface{}{
+		"command":            argv,
+		"cwd":                "/root",
+		"environment":        map[string]string{"HOME": "/root", "USER": "root", "LANG": "C.UTF-8"},
+		"interactive":        false,
+		"record-output":      true,
+		"wait-for-websocket": false,
+	}
+	op, err := rb.Client.Do(ctx, "POST", instancePath(name)+"/exec", req)
+	if err != nil {
+		return nil, nil, err
+	}
+	var execOut lxdExecOutput
+	mBytes, err := json.Marshal(op.Metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = json.Unmarshal(mBytes, &execOut); err != nil {
+		return nil, nil, err
+	}
+	stdout, err := rb.execLog(ctx, execOut.Output["1"])
+	if err != nil {
+		return nil, nil, err
+	}
+	stderr, err := rb.execLog(ctx, execOut.Output["2"])
+	if err != nil {
+		return stdout, nil, err
+	}
+	if execOut.Return != 0 {
+		return stdout, stderr, &CommandError{argv, execOut.Return, strings.TrimSpace(string(stderr)), fmt.Errorf("exit status %d", execOut.Return)}
+	}
+	return stdout, stderr, nil
+}
+
+// PushFile creates the parent directories of fPath and then writes the file through the instance file API
+func (rb *RESTBackend) PushFile(ctx context.Context, name string, fPath string, r io.Reader, mode os.FileMode) error {
+	if _, _, err := rb.Exec(ctx, name, []string{"mkdir", "-p", path.Dir(fPath)}); err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("X-LXD-type", "file")
+	header.Set("X-LXD-mode", fmt.Sprintf("%04o", mode.Perm()))
+	header.Set("X-LXD-uid", "0")
+	header.Set("X-LXD-gid", "0")
+	resp, err := rb.Client.Raw(ctx, "POST", instancePath(name)+"/files?path="+url.QueryEscape(fPath), r, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = parseLXDResponse(resp)
+	return err
+}
+
+// execLog reads and removes a recorded exec output log
+func (rb *RESTBackend) execLog(ctx context.Context, logPath string) ([]byte, error) {
+	if logPath == "" {
+		return []byte{}, nil
+	}
+	resp, err := rb.Client.Raw(ctx, "GET", logPath, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, err = parseLXDResponse(resp)
+		return nil, err
+	}
+	out, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = rb.Client.Query(ctx, "DELETE", logPath, nil)
+	return out, nil
+}
+
+// List all instances
+func (rb *RESTBackend) List(ctx context.Context) ([]ContainerOutput, error) {
+	var outputs []ContainerOutput
+	err := rb.Client.Get(ctx, "/1.0/instances?recursion=2", &outputs)
+	return outputs, err
+}
+
+// Leases lists the DHCP leases of a network
+func (rb *RESTBackend) Leases(ctx context.Context, network string) ([]NetworkEntry, error) {
+	var entries []NetworkEntry
+	err := rb.Client.Get(ctx, "/1.0/networks/"+url.PathEscape(network)+"/leases", &entries)
+	return entries, err
+}
+
+// Snapshot creates a snapshot of an instance
+func (rb *RESTBackend) Snapshot(ctx context.Context, name string, snapName string) error {
+	req := map[string]interface{}{"name": snapName}
+	_, err := rb.Client.Do(ctx, "POST", instancePath(name)+"/snapshots", req)
+	return err
+}
+
+// Snapshots lists the snapshot names of an instance
+func (rb *RESTBackend) Snapshots(ctx context.Context, name string) ([]string, error) {
+	var snapURLs []string
+	var snapNames []string
+	err := rb.Client.Get(ctx, instancePath(name)+"/snapshots", &snapURLs)
+	if err != nil {
+		return snapNames, err
+	}
+	for _, snapURL := range snapURLs {
+		snapName, err := url.PathUnescape(path.Base(snapURL))
+		if err != nil {
+			return snapNames, err
+		}
+		snapNames = append(snapNames, snapName)
+	}
+	return snapNames, nil
+}
+
+// DeleteSnapshot deletes a snapshot of an instance
+func (rb *RESTBackend) DeleteSnapshot(ctx context.Context, name string, snapName string) error {
+	_, err := rb.Client.Do(ctx, "DELETE", instancePath(name)+"/snapshots/"+url.PathEscape(snapName), nil)
+	return err
+}
+
+// Restore an instance from one of its snapshots
+func (rb *RESTBackend) Restore(ctx context.Context, name string, snapName string) error {
+	req := map[string]interface{}{"restore": snapName}
+	_, err := rb.Client.Do(ctx, "PUT", instancePath(name), req)
+	return err
+}
+
+// Publish an instance or snapshot as an image and return its fingerprint
+func (rb *RESTBackend) Publish(ctx context.Context, name string, snapName string, alias string) (string, error) {
+	source := lxdImageSource{Type: "instance", Name: name}
+	if snapName != "" {
+		source.Type = "snapshot"
+		source.Name = name + "/" + snapName
+	}
+	req := map[string]interface{}{"source": source}
+	op, err := rb.Client.Do(ctx, "POST", "/1.0/images", req)
+	if err != nil {
+		return "", err
+	}
+	fingerprint := op.metadataString("fingerprint")
+	return fingerprint, rb.addAlias(ctx, alias, fingerprint)
+}
+
+// addAlias points an image alias at a fingerprint, an empty alias is skipped
+func (rb *RESTBackend) addAlias(ctx context.Context, alias string, fingerprint string) error {
+	if alias == "" {
+		return nil
+	}
+	return rb.AddImageAlias(ctx, alias, fingerprint, "")
+}
+
+// AddImageAlias points alias at an image
+func (rb *RESTBackend) AddImageAlias(ctx context.Context, alias string, fingerprint string, description string) error {
+	_, err := rb.Client.Query(ctx, "POST", "/1.0/images/aliases", ImageAliasesEntry{ImageAlias{alias, description}, fingerprint})
+	return err
+}
+
+// DeleteImageAlias removes alias
+func (rb *RESTBackend) DeleteImageAlias(ctx context.Context, alias string) error {
+	_, err := rb.Client.Query(ctx, "DELETE", "/1.0/images/aliases/"+url.PathEscape(alias), nil)
+	return err
+}
+
+// UpdateImage replaces the editable fields of an image
+func (rb *RESTBackend) UpdateImage(ctx context.Context, fingerprint string, update ImageUpdate) error {
+	_, err := rb.Client.Query(ctx, "PUT", "/1.0/images/"+url.PathEscape(fingerprint), update)
+	return err
+}
+
+// RefreshImage updates an image cached from a remote
+func (rb *RESTBackend) RefreshImage(ctx context.Context, fingerprint string) (bool, error) {
+	op, err := rb.Client.Do(ctx, "POST", "/1.0/images/"+url.PathEscape(fingerprint)+"/refresh", nil)
+	if err != nil {
+		return false, err
+	}
+	refreshed, _ := op.Metadata["refreshed"].(bool)
+	return refreshed, nil
+}
+
+// AddRemote adds an image remote to LXDRemotes, LXD is given its certificate with every image pulled from it
+func (rb *RESTBackend) AddRemote(ctx context.Context, name string, server string, certificate string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	lxdRemotesMu.Lock()
+	defer lxdRemotesMu.Unlock()
+	if current, ok := LXDRemotes[name]; ok && current != server {
+		return fmt.Errorf("lxd image remote %s already points at %s", name, current)
+	}
+	LXDRemotes[name] = server
+	if certificate != "" {
+		lxdRemoteCertificates[name] = certificate
+	}
+	return nil
+}
+
+// resolveImage returns the fingerprint of an image alias or fingerprint
+func (rb *RESTBackend) resolveImage(ctx context.Context, name string) (string, error) {
+	var alias struct {
+		Target string `json:"target"`
+	}
+	err := rb.Client.Get(ctx, "/1.0/images/aliases/"+url.PathEscape(name), &alias)
+	if err == nil {
+		return alias.Target, nil
+	}
+	if isNotFound(err) {
+		return name, nil
+	}
+	return "", err
+}
+
+// Images lists all images
+func (rb *RESTBackend) Images(ctx context.Context) ([]ImageOutput, error) {
+	var images []ImageOutput
+	err := rb.Client.Get(ctx, "/1.0/images?recursion=1", &images)
+	return images, err
+}
+
+// DeleteImage deletes an image by its fingerprint
+func (rb *RESTBackend) DeleteImage(ctx context.Context, fingerprint string) error {
+	_, err := rb.Client.Do(ctx, "DELETE", "/1.0/images/"+url.PathEscape(fingerprint), nil)
+	return err
+}
+
+// ImportImage imports a unified image tarball, or split metadata and rootfs files
+func (rb *RESTBackend) ImportImage(ctx context.Context, metadata io.Reader, rootfs io.Reader, alias string) (string, error) {
+	body := metadata
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	if rootfs != nil {
+		pr, pw := io.Pipe()
+		defer pr.Close()
+		form := multipart.NewWriter(pw)
+		go func() {
+			pw.CloseWithError(writeImageForm(form, metadata, rootfs))
+		}()
+		body = pr
+		header.Set("Content-Type", form.FormDataContentType())
+	}
+	resp, err := rb.Client.Raw(ctx, "POST", "/1.0/images", body, header)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	lxdResp, err := parseLXDResponse(resp)
+	if err != nil {
+		return "", err
+	}
+	op, err := rb.Client.Wait(ctx, lxdResp)
+	if err != nil {
+		return "", err
+	}
+	fingerprint := op.metadataString("fingerprint")
+	return fingerprint, rb.addAlias(ctx, alias, fingerprint)
+}
+
+// writeImageForm streams a split image's metadata and rootfs as the multipart form LXD imports
+func writeImageForm(form *multipart.Writer, metadata io.Reader, rootfs io.Reader) error {
+	for _, part := range []struct {
+		name string
+		r    io.Reader
+	}{{"metadata", metadata}, {"rootfs", rootfs}} {
+		fw, err := form.CreateFormFile(part.name, part.name)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(fw, part.r); err != nil {
+			return err
+		}
+	}
+	return form.Close()
+}
+
+// ExportImage streams the files of an image to part as LXD sends them
+func (rb *RESTBackend) ExportImage(ctx context.Context, name string, part ImagePartFunc) error {
+	fingerprint, err := rb.resolveImage(ctx, name)
+	if err != nil {
+		return err
+	}
+	resp, err := rb.Client.Raw(ctx, "GET", "/1.0/images/"+url.PathEscape(fingerprint)+"/export", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, err = parseLXDResponse(resp)
+		return err
+	}
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		_, dParams, _ := mime.ParseMediaType(resp.Header.Get("Content-Disposition"))
+		fName := dParams["filename"]
+		if fName == "" {
+			fName = fingerprint + ".tar.gz"
+		}
+		return part(filepath.Base(fName), resp.Body)
+	}
+	form := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		formPart, err := form.NextPart()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		err = part(filepath.Base(formPart.FileName()), formPart)
+		_ = formPart.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,1004 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// OCI media types and annotations go-containers reads and writes
+const (
+	ociManifestMediaType     = "application/vnd.oci.image.manifest.v1+json"
+	ociConfigMediaType       = "application/vnd.oci.image.config.v1+json"
+	ociLayerMediaType        = "application/vnd.oci.image.layer.v1.tar+gzip"
+	ociIndexMediaType        = "application/vnd.oci.image.index.v1+json"
+	dockerManifestListType   = "application/vnd.docker.distribution.manifest.list.v2+json"
+	ociRefNameAnnotation     = "org.opencontainers.image.ref.name"
+	containerdNameAnnotation = "io.containerd.image.name"
+)
+
+// OCIConfig is the runtime configuration of an OCI image
+type OCIConfig struct {
+	User         string              `json:"User,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	Entrypoint   []string            `json:"Entrypoint,omitempty"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+}
+
+// properties returns the image properties an OCIConfig is recorded as on a converted GoImage
+func (oc *OCIConfig) properties() map[string]string {
+	props := map[string]string{}
+	for key, list := range map[string][]string{"oci.entrypoint": oc.Entrypoint, "oci.cmd": oc.Cmd, "oci.env": oc.Env} {
+		if len(list) > 0 {
+			encoded, _ := json.Marshal(list)
+			props[key] = string(encoded)
+		}
+	}
+	if oc.WorkingDir != "" {
+		props["oci.workdir"] = oc.WorkingDir
+	}
+	if oc.User != "" {
+		props["oci.user"] = oc.User
+	}
+	return props
+}
+
+// ociImageConfig is the config blob of an OCI image
+type ociImageConfig struct {
+	Architecture string     `json:"architecture"`
+	OS           string     `json:"os"`
+	Created      string     `json:"created,omitempty"`
+	Config       OCIConfig  `json:"config"`
+	RootFS       *ociRootFS `json:"rootfs,omitempty"`
+}
+
+// ociRootFS lists the uncompressed digests of an OCI image's layers
+type ociRootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+// ociPlatform is the platform of an image in an OCI index
+type ociPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// ociDescriptor points at a blob of an OCI layout
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *ociPlatform      `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ociIndex is an OCI layout's index.json or an image index blob
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+// ociManifest is the manifest of one OCI image
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+// dockerManifest is an image in the manifest.json of a docker save tarball
+type dockerManifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// ociLayer is a layer to flatten, with the digest it must hash to when known
+type ociLayer struct {
+	path   string
+	digest string
+}
+
+// OCIConvertOptions picks the image ConvertOCI converts and names the GoImage it makes
+type OCIConvertOptions struct {
+	Reference    string // the tag or ref name of the image in a source holding several, such as nginx:1.21
+	Name         string // the GoImage's name and the alias it imports as, defaults to the Reference
+	OS           string // the os property, defaults to the os of the OCI config
+	Release      string // the release property, defaults to the tag of the Reference or latest
+	Architecture string // the platform picked from a multi-platform image, amd64 when empty
+}
+
+// lxdArchitectures maps OCI architectures to the names LXD uses
+var lxdArchitectures = map[string]string{
+	"amd64":   "x86_64",
+	"386":     "i686",
+	"arm64":   "aarch64",
+	"arm":     "armv7l",
+	"ppc64le": "ppc64le",
+	"s390x":   "s390x",
+	"riscv64": "riscv64",
+}
+
+// ociDigest matches the digests go-containers opens blobs by
+var ociDigest = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// ociSource is an OCI layout or docker save tarball, as a directory or an uncompressed tar archive
+type ociSource interface {
+	open(name string) (io.ReadCloser, error)
+	exists(name string) bool
+	Close() error
+}
+
+// checkOCIPath refuses the path of a file in an ociSource, which manifests name, when it could leave the source
+func checkOCIPath(name string) error {
+	if name == "" || path.IsAbs(name) || path.Clean(name) != name || strings.Contains(name, "\\") {
+		return fmt.Errorf("invalid path in the source: %q", name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return fmt.Errorf("invalid path in the source: %q", name)
+		}
+	}
+	return nil
+}
+
+// ociDir is an ociSource in a directory
+type ociDir string
+
+func (od ociDir) open(name string) (io.ReadCloser, error) {
+	if err := checkOCIPath(name); err != nil {
+		return nil, err
+	}
+	return os.Open(filepath.Join(string(od), filepath.FromSlash(name)))
+}
+
+func (od ociDir) exists(name string) bool {
+	if checkOCIPath(name) != nil {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(string(od), filepath.FromSlash(name)))
+	return err == nil
+}
+
+func (od ociDir) Close() error {
+	return nil
+}
+
+// ociTar is an ociSource in an uncompressed tar archive, each file is read in place from its offset
+type ociTar struct {
+	f       *os.File
+	entries map[string][2]int64
+}
+
+// openOCITar indexes the regular files of a tar archive by the offset and size of their contents
+func openOCITar(fPath string) (*ociTar, error) {
+	f, err := os.Open(fPath)
+	if err != nil {
+		return nil, err
+	}
+	ot := &ociTar{f, map[string][2]int64{}}
+	header := make([]byte, imageHeaderSize)
+	if n, _ := io.ReadFull(f, header); detectImageCompression(header[:n]) != CompressionNone {
+		f.Close()
+		return nil, errors.New("OCI archives must be uncompressed tar archives")
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return ot, nil
+		} else if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		// tar.Reader reads no further than the header, so the file offset is where the contents start
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		ot.entries[path.Clean(strings.TrimPrefix(hdr.Name, "./"))] = [2]int64{offset, hdr.Size}
+	}
+}
+
+func (ot *ociTar) open(name string) (io.ReadCloser, error) {
+	if err := checkOCIPath(name); err != nil {
+		return nil, err
+	}
+	entry, ok := ot.entries[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return ioutil.NopCloser(io.NewSectionReader(ot.f, entry[0], entry[1])), nil
+}
+
+func (ot *ociTar) exists(name string) bool {
+	_, ok := ot.entries[name]
+	return checkOCIPath(name) == nil && ok
+}
+
+func (ot *ociTar) Close() error {
+	return ot.f.Close()
+}
+
+// openOCISource opens an OCI layout or docker save tarball, src is a directory or an uncompressed tar archive
+func openOCISource(src string) (ociSource, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return ociDir(src), nil
+	}
+	return openOCITar(src)
+}
+
+// readJSON decodes the JSON file name of an ociSource into v
+func readJSON(source ociSource, name string, v interface{}) error {
+	f, err := source.open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = json.NewDecoder(io.LimitReader(f, 16<<20)).Decode(v); err != nil {
+		return fmt.Errorf("reading %s: %v", name, err)
+	}
+	return nil
+}
+
+// blobPath returns the path of a blob in an OCI layout by its digest
+func blobPath(digest string) (string, error) {
+	if !ociDigest.MatchString(digest) {
+		return "", fmt.Errorf("unsupported blob digest: %q", digest)
+	}
+	return "blobs/sha256/" + strings.TrimPrefix(digest, "sha256:"), nil
+}
+
+// matchesReference reports whether the name of an image matches a reference, a reference without a tag
+// matching the latest tag
+func matchesReference(name string, reference string) bool {
+	if name == reference {
+		return true
+	}
+	if !strings.Contains(path.Base(reference), ":") && !strings.Contains(reference, "@") {
+		return name == reference+":latest" || strings.HasSuffix(name, "/"+reference+":latest")
+	}
+	return strings.HasSuffix(name, "/"+reference)
+}
+
+// resolve returns the config and the layers, bottom first, of the image of an ociSource that opts pick, and
+// the reference it was found by
+func (opts *OCIConvertOptions) resolve(source ociSource) (*ociImageConfig, []ociLayer, string, error) {
+	if source.exists("manifest.json") {
+		return opts.resolveDocker(source)
+	}
+	var index ociIndex
+	if err := readJSON(source, "index.json", &index); err != nil {
+		return nil, nil, "", fmt.Errorf("not an OCI layout or docker save tarball: %v", err)
+	}
+	var picked *ociDescriptor
+	reference := opts.Reference
+	for ind, desc := range index.Manifests {
+		name := desc.Annotations[containerdNameAnnotation]
+		if name == "" {
+			name = desc.Annotations[ociRefNameAnnotation]
+		}
+		if opts.Reference == "" && len(index.Manifests) == 1 {
+			picked, reference = &index.Manifests[ind], name
+		} else if opts.Reference != "" && (matchesReference(name, opts.Reference) || desc.Annotations[ociRefNameAnnotation] == opts.Reference) {
+			picked = &index.Manifests[ind]
+			break
+		}
+	}
+	if picked == nil {
+		return nil, nil, "", opts.notFound(len(index.Manifests))
+	}
+	for depth := 0; picked.MediaType == ociIndexMediaType || picked.MediaType == dockerManifestListType; depth++ {
+		blob, err := blobPath(picked.Digest)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		if err = readJSON(source, blob, &index); err != nil || depth > 4 {
+			return nil, nil, "", fmt.Errorf("reading image index %s: %v", picked.Digest, err)
+		}
+		if picked = opts.platform(index.Manifests); picked == nil {
+			return nil, nil, "", fmt.Errorf("no linux/%s image in %s", opts.architecture(), reference)
+		}
+	}
+	blob, err := blobPath(picked.Digest)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	var manifest ociManifest
+	if err = readJSON(source, blob, &manifest); err != nil {
+		return nil, nil, "", err
+	}
+	if blob, err = blobPath(manifest.Config.Digest); err != nil {
+		return nil, nil, "", err
+	}
+	var config ociImageConfig
+	if err = readJSON(source, blob, &config); err != nil {
+		return nil, nil, "", err
+	}
+	var layers []ociLayer
+	for _, desc := range manifest.Layers {
+		if strings.Contains(desc.MediaType, "zstd") {
+			return nil, nil, "", fmt.Errorf("unsupported layer media type: %s", desc.MediaType)
+		}
+		if blob, err = blobPath(desc.Digest); err != nil {
+			return nil, nil, "", err
+		}
+		layers = append(layers, ociLayer{blob, desc.Digest})
+	}
+	return &config, layers, reference, nil
+}
+
+// resolveDocker returns the config and the layers of the image of a docker save tarball that opts pick
+func (opts *OCIConvertOptions) resolveDocker(source ociSource) (*ociImageConfig, []ociLayer, string, error) {
+	var manifests []dockerManifest
+	if err := readJSON(source, "manifest.json", &manifests); err != nil {
+		return nil, nil, "", err
+	}
+	var picked *dockerManifest
+	reference := opts.Reference
+	for ind, manifest := range manifests {
+		if opts.Reference == "" && len(manifests) == 1 {
+			picked = &manifests[ind]
+			if len(manifest.RepoTags) > 0 {
+				reference = manifest.RepoTags[0]
+			}
+		}
+		for _, tag := range manifest.RepoTags {
+			if opts.Reference != "" && matchesReference(tag, opts.Reference) {
+				picked = &manifests[ind]
+			}
+		}
+	}
+	if picked == nil {
+		return nil, nil, "", opts.notFound(len(manifests))
+	}
+	var config ociImageConfig
+	if err := readJSON(source, picked.Config, &config); err != nil {
+		return nil, nil, "", err
+	}
+	var layers []ociLayer
+	for _, layer := range picked.Layers {
+		digest := ""
+		if strings.HasPrefix(layer, "blobs/sha256/") {
+			digest = "sha256:" + strings.TrimPrefix(layer, "blobs/sha256/")
+		}
+		layers = append(layers, ociLayer{layer, digest})
+	}
+	return &config, layers, reference, nil
+}
+
+// notFound returns the error for a Reference missing from a source holding count images
+func (opts *OCIConvertOptions) notFound(count int) error {
+	if opts.Reference == "" {
+		return fmt.Errorf("the source holds %d images, pick one with a Reference", count)
+	}
+	return fmt.Errorf("%w: no image %s in the source", ErrImageNotFound, opts.Reference)
+}
+
+// architecture returns the OCI architecture opts pick from a multi-platform image
+func (opts *OCIConvertOptions) architecture() string {
+	if opts.Architecture != "" {
+		return opts.Architecture
+	}
+	return "amd64"
+}
+
+// platform returns the linux image of the architecture opts pick from the manifests of an image index
+func (opts *OCIConvertOptions) platform(manifests []ociDescriptor) *ociDescriptor {
+	for ind, desc := range manifests {
+		if desc.Platform != nil && desc.Platform.OS == "linux" && desc.Platform.Architecture == opts.architecture() {
+			return &manifests[ind]
+		}
+	}
+	return nil
+}
+
+// layerFlattener writes the merged file system of an image's layers under rootfs/ of an LXD image tarball. It
+// walks the layers top down, so the first entry found for a path wins and the whiteouts of a layer hide what
+// the layers below it hold
+type layerFlattener struct {
+	tw        *tar.Writer
+	seen      map[string]bool // the paths written, true for directories
+	whiteouts map[string]bool // the paths removed by an upper layer
+	opaque    map[string]bool // the directories whose lower contents an upper layer hides
+	links     []*tar.Header   // hard links, written last so their targets exist
+}
+
+// hidden reports whether an upper layer removed or replaced p, or one of its parents
+func (lf *layerFlattener) hidden(p string) bool {
+	if lf.whiteouts[p] {
+		return true
+	}
+	for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+		if isDir, ok := lf.seen[dir]; lf.whiteouts[dir] || lf.opaque[dir] || ok && !isDir {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanLayerPath returns the path of a layer entry relative to the root of the file system, "" for the root
+func cleanLayerPath(name string) string {
+	name = path.Clean("/" + name)
+	return strings.TrimPrefix(name, "/")
+}
+
+// flatten adds the entries of one layer, read from r, that no upper layer already wrote or hid
+func (lf *layerFlattener) flatten(ctx context.Context, r io.Reader) error {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(4); bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}) {
+		return errors.New("zstd compressed layers are not supported")
+	} else if len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	} else {
+		r = br
+	}
+	whiteouts, opaque := map[string]bool{}, map[string]bool{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		name := cleanLayerPath(hdr.Name)
+		base := path.Base(name)
+		if name == "" {
+			continue
+		} else if base == ".wh..wh..opq" {
+			opaque[path.Dir(name)] = true
+			continue
+		} else if strings.HasPrefix(base, ".wh.") {
+			whiteouts[path.Join(path.Dir(name), strings.TrimPrefix(base, ".wh."))] = true
+			continue
+		}
+		if _, ok := lf.seen[name]; ok || lf.hidden(name) {
+			continue
+		}
+		lf.seen[name] = hdr.Typeflag == tar.TypeDir
+		hdr.Name = "rootfs/" + name
+		if hdr.Typeflag == tar.TypeDir {
+			hdr.Name += "/"
+		}
+		if hdr.Typeflag == tar.TypeLink {
+			hdr.Linkname = "rootfs/" + cleanLayerPath(hdr.Linkname)
+			lf.links = append(lf.links, hdr)
+			continue
+		}
+		if err = lf.tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err = io.Copy(lf.tw, tr); err != nil {
+			return err
+		}
+	}
+	for p := range whiteouts {
+		lf.whiteouts[p] = true
+	}
+	for p := range opaque {
+		lf.opaque[p] = true
+	}
+	return nil
+}
+
+// ConvertOCI converts the image of an OCI layout or docker save tarball into a unified LXD image whose Contents
+// GoContainer.Import and GoCluster.ImportContainer launch. src is a directory or an uncompressed tar archive, and
+// a nil opts converts the only image it holds. The layers are flattened into the rootfs honouring whiteouts,
+// and the entrypoint, cmd, env, working directory and user of the OCI config are recorded as the oci.entrypoint,
+// oci.cmd, oci.env, oci.workdir and oci.user image properties, the lists as JSON arrays. LXD boots the image's
+// /sbin/init, so images without an init system need one installed to run as system containers
+func ConvertOCI(src string, opts *OCIConvertOptions) (*GoImage, error) {
+	return ConvertOCIContext(context.Background(), src, opts)
+}
+
+// ConvertOCIContext is like ConvertOCI but returns ctx.Err() once ctx is done
+func ConvertOCIContext(ctx context.Context, src string, opts *OCIConvertOptions) (*GoImage, error) {
+	var buf bytes.Buffer
+	img, err := ConvertOCIToContext(ctx, src, opts, &buf)
+	if err != nil {
+		return nil, err
+	}
+	img.TarMeta = []string{img.Fingerprint + ".tar.gz"}
+	img.Contents = [][]byte{buf.Bytes()}
+	return img, nil
+}
+
+// ConvertOCITo is like ConvertOCI but streams the LXD image tarball to w instead of loading the GoImage's Contents
+func ConvertOCITo(src string, opts *OCIConvertOptions, w io.Writer) (*GoImage, error) {
+	return ConvertOCIToContext(context.Background(), src, opts, w)
+}
+
+// ConvertOCIToContext is like ConvertOCITo but returns ctx.Err() once ctx is done
+func ConvertOCIToContext(ctx context.Context, src string, opts *OCIConvertOptions, w io.Writer) (*GoImage, error) {
+	if opts == nil {
+		opts = &OCIConvertOptions{}
+	}
+	source, err := openOCISource(src)
+	if err != nil {
+		return nil, &OpError{"convert oci image", src, nil, err}
+	}
+	defer source.Close()
+	config, layers, reference, err := opts.resolve(source)
+	if err != nil {
+		kind := error(nil)
+		if errors.Is(err, ErrImageNotFound) {
+			kind = ErrImageNotFound
+		}
+		return nil, &OpError{"convert oci image", src, kind, err}
+	}
+	img := opts.goImage(config, reference)
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(w, hash)}
+	gw := gzip.NewWriter(counter)
+	tw := tar.NewWriter(gw)
+	err = writeLXDMetadata(tw, config, img)
+	if err == nil {
+		err = tw.WriteHeader(&tar.Header{Name: "rootfs/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: time.Now()})
+	}
+	flattener := &layerFlattener{tw, map[string]bool{}, map[string]bool{}, map[string]bool{}, nil}
+	for ind := len(layers) - 1; ind >= 0 && err == nil; ind-- {
+		err = flattenLayer(ctx, source, layers[ind], flattener)
+	}
+	for _, link := range flattener.links {
+		if err != nil {
+			break
+		}
+		err = tw.WriteHeader(link)
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gw.Close()
+	}
+	if err != nil {
+		return nil, newOpError("convert oci image", src, err, nil)
+	}
+	img.Fingerprint = hex.EncodeToString(hash.Sum(nil))
+	img.Size = counter.n
+	img.setFormat(ImageUnified, CompressionGzip, "")
+	return img, nil
+}
+
+// flattenLayer adds one layer to a layerFlattener, checking the layer against its digest when it has one
+func flattenLayer(ctx context.Context, source ociSource, layer ociLayer, flattener *layerFlattener) error {
+	f, err := source.open(layer.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	var digest hash.Hash
+	if layer.digest != "" {
+		digest = sha256.New()
+		r = io.TeeReader(f, digest)
+	}
+	if err = flattener.flatten(ctx, r); err != nil {
+		return fmt.Errorf("layer %s: %v", layer.path, err)
+	}
+	if digest == nil {
+		return nil
+	}
+	if _, err = io.Copy(digest, f); err != nil {
+		return err
+	}
+	if sum := "sha256:" + hex.EncodeToString(digest.Sum(nil)); sum != layer.digest {
+		return &OpError{"convert oci image", layer.path, ErrImageMismatch, fmt.Errorf("layer digest is %s, expected %s", sum, layer.digest)}
+	}
+	return nil
+}
+
+// goImage returns the GoImage an OCI image converts to, without its content
+func (opts *OCIConvertOptions) goImage(config *ociImageConfig, reference string) *GoImage {
+	tag := "latest"
+	if at := strings.LastIndex(reference, ":"); at > strings.LastIndex(reference, "/") {
+		tag = reference[at+1:]
+	}
+	name := opts.Name
+	if name == "" {
+		name = strings.NewReplacer(":", "-", "@", "-", "/", "-").Replace(reference)
+	}
+	created := time.Now().UTC()
+	if parsed, err := time.Parse(time.RFC3339Nano, config.Created); err == nil {
+		created = parsed.UTC()
+	}
+	img := NewGoImage(name, ImageTypeContainer, "", created.Format(time.RFC3339))
+	img.Properties = config.Config.properties()
+	img.Properties["os"] = firstNonEmpty(opts.OS, config.OS, "linux")
+	img.Properties["release"] = firstNonEmpty(opts.Release, tag)
+	img.Properties["architecture"] = firstNonEmpty(lxdArchitectures[config.Architecture], config.Architecture, "x86_64")
+	img.Properties["description"] = firstNonEmpty(reference, name) + " converted from OCI"
+	return img
+}
+
+// firstNonEmpty returns the first of vals that is not empty
+func firstNonEmpty(vals ...string) string {
+	for _, val := range vals {
+		if val != "" {
+			return val
+		}
+	}
+	return ""
+}
+
+// lxdMetadata is the metadata.yaml of an LXD image
+type lxdMetadata struct {
+	Architecture string            `yaml:"architecture"`
+	CreationDate int64             `yaml:"creation_date"`
+	Properties   map[string]string `yaml:"properties"`
+}
+
+// writeLXDMetadata writes the metadata.yaml of a converted GoImage
+func writeLXDMetadata(tw *tar.Writer, config *ociImageConfig, img *GoImage) error {
+	created, _ := time.Parse(time.RFC3339, img.DateTime)
+	metadata, err := yaml.Marshal(lxdMetadata{img.Properties["architecture"], created.Unix(), img.Properties})
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: "metadata.yaml", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(metadata)), ModTime: created}
+	if err = tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = tw.Write(metadata)
+	return err
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// OCIExportOptions picks what GoContainer.ExportOCI exports and how the OCI image runs
+type OCIExportOptions struct {
+	Snapshot  string    // the snapshot to export, empty snapshots the GoContainer first
+	Reference string    // the org.opencontainers.image.ref.name of the image, defaults to latest
+	Config    OCIConfig // the env, working directory, entrypoint and cmd of the image
+}
+
+// ociPutFunc writes one file of an OCI layout, name is relative to the layout's root
+type ociPutFunc func(name string, r io.Reader, size int64) error
+
+// ExportOCI writes a GoContainer, or one of its snapshots, as a single layer OCI image layout into dir, which
+// docker, podman and skopeo read. An existing layout in dir keeps its other images, one with the same Reference
+// is replaced. It returns the digest of the image's manifest
+func (co *GoContainer) ExportOCI(dir string, opts *OCIExportOptions) (string, error) {
+	return co.ExportOCIContext(context.Background(), dir, opts)
+}
+
+// ExportOCIContext is like ExportOCI but returns ctx.Err() once ctx is done
+func (co *GoContainer) ExportOCIContext(ctx context.Context, dir string, opts *OCIExportOptions) (string, error) {
+	var index ociIndex
+	if f, err := os.Open(filepath.Join(dir, "index.json")); err == nil {
+		err = json.NewDecoder(f).Decode(&index)
+		f.Close()
+		if err != nil {
+			return "", &OpError{"export oci image", co.Name, nil, fmt.Errorf("reading %s: %v", filepath.Join(dir, "index.json"), err)}
+		}
+	}
+	return co.exportOCI(ctx, opts, index.Manifests, func(name string, r io.Reader, size int64) error {
+		fPath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fPath), 0755); err != nil {
+			return err
+		}
+		f, err := ioutil.TempFile(filepath.Dir(fPath), ".incoming-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		_, err = io.Copy(f, r)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Chmod(f.Name(), 0644)
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), fPath)
+		}
+		return err
+	})
+}
+
+// ExportOCITo is like ExportOCI but streams the OCI image layout to w as a tar archive, which docker load and
+// podman load read
+func (co *GoContainer) ExportOCITo(w io.Writer, opts *OCIExportOptions) (string, error) {
+	return co.ExportOCIToContext(context.Background(), w, opts)
+}
+
+// ExportOCIToContext is like ExportOCITo but returns ctx.Err() once ctx is done
+func (co *GoContainer) ExportOCIToContext(ctx context.Context, w io.Writer, opts *OCIExportOptions) (string, error) {
+	tw := tar.NewWriter(w)
+	dirs := map[string]bool{}
+	digest, err := co.exportOCI(ctx, opts, nil, func(name string, r io.Reader, size int64) error {
+		now := time.Now()
+		for dir := path.Dir(name); dir != "." && !dirs[dir]; dir = path.Dir(dir) {
+			dirs[dir] = true
+			if err := tw.WriteHeader(&tar.Header{Name: dir + "/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: now}); err != nil {
+				return err
+			}
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: size, ModTime: now}); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, r)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if err = tw.Close(); err != nil {
+		return "", newOpError("export oci image", co.Name, err, nil)
+	}
+	return digest, nil
+}
+
+// exportOCI publishes a GoContainer or one of its snapshots, converts it into an OCI image and writes the image's
+// blobs, oci-layout and index.json, in that order, with put. The index holds the manifests of an existing layout
+// along with the new image
+func (co *GoContainer) exportOCI(ctx context.Context, opts *OCIExportOptions, manifests []ociDescriptor, put ociPutFunc) (string, error) {
+	if opts == nil {
+		opts = &OCIExportOptions{}
+	}
+	reference := firstNonEmpty(opts.Reference, "latest")
+	snapshot := opts.Snapshot
+	if snapshot == "" {
+		var err error
+		if snapshot, err = co.CreateSnapshotContext(ctx); err != nil {
+			return "", err
+		}
+		defer co.getBackend().DeleteSnapshot(context.Background(), co.Name, snapshot)
+	}
+	exImage, err := co.ImageContext(ctx, snapshot)
+	if err != nil {
+		return "", err
+	}
+	defer exImage.getBackend().DeleteImage(context.Background(), exImage.Fingerprint)
+	// the layer is streamed from LXD twice, once to find its digest and size and once to write it, rather than
+	// staging the rootfs on disk where an image exported with Keys would be left unencrypted
+	config, layerDesc, err := exImage.ociLayer(ctx, ioutil.Discard)
+	if err != nil {
+		return "", newOpError("export oci image", co.Name, err, nil)
+	}
+	config.Config = opts.Config
+	layerCtx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, written, err := exImage.ociLayer(layerCtx, pw)
+		if err == nil && written.Digest != layerDesc.Digest {
+			err = &OpError{"export oci image", co.Name, ErrImageMismatch, fmt.Errorf("layer digest changed from %s to %s between reads", layerDesc.Digest, written.Digest)}
+		}
+		pw.CloseWithError(err)
+	}()
+	err = put(mustBlobPath(layerDesc.Digest), pr, layerDesc.Size)
+	// stop the second read before the deferred cleanup deletes the image it streams
+	pr.CloseWithError(errors.New("the layer was not read to the end"))
+	cancel()
+	<-done
+	if err != nil {
+		return "", newOpError("export oci image", co.Name, err, nil)
+	}
+	configDesc, err := putOCIBlob(put, ociConfigMediaType, config)
+	if err != nil {
+		return "", newOpError("export oci image", co.Name, err, nil)
+	}
+	manifestDesc, err := putOCIBlob(put, ociManifestMediaType, ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		Config:        configDesc,
+		Layers:        []ociDescriptor{layerDesc},
+	})
+	if err != nil {
+		return "", newOpError("export oci image", co.Name, err, nil)
+	}
+	manifestDesc.Platform = &ociPlatform{Architecture: config.Architecture, OS: config.OS}
+	manifestDesc.Annotations = map[string]string{ociRefNameAnnotation: reference}
+	index := ociIndex{SchemaVersion: 2, MediaType: ociIndexMediaType}
+	for _, desc := range manifests {
+		if desc.Annotations[ociRefNameAnnotation] != reference {
+			index.Manifests = append(index.Manifests, desc)
+		}
+	}
+	index.Manifests = append(index.Manifests, manifestDesc)
+	layout := []byte(`{"imageLayoutVersion":"1.0.0"}`)
+	if err = put("oci-layout", bytes.NewReader(layout), int64(len(layout))); err != nil {
+		return "", newOpError("export oci image", co.Name, err, nil)
+	}
+	indexJSON, err := json.MarshalIndent(index, "", "  ")
+	if err == nil {
+		err = put("index.json", bytes.NewReader(indexJSON), int64(len(indexJSON)))
+	}
+	if err != nil {
+		return "", newOpError("export oci image", co.Name, err, nil)
+	}
+	return manifestDesc.Digest, nil
+}
+
+// mustBlobPath returns the path of a blob whose digest go-containers computed
+func mustBlobPath(digest string) string {
+	return "blobs/sha256/" + strings.TrimPrefix(digest, "sha256:")
+}
+
+// putOCIBlob writes v as a JSON blob of an OCI layout with put and returns its descriptor
+func putOCIBlob(put ociPutFunc, mediaType string, v interface{}) (ociDescriptor, error) {
+	blob, err := json.Marshal(v)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	sum := sha256.Sum256(blob)
+	desc := ociDescriptor{MediaType: mediaType, Digest: "sha256:" + hex.EncodeToString(sum[:]), Size: int64(len(blob))}
+	return desc, put(mustBlobPath(desc.Digest), bytes.NewReader(blob), desc.Size)
+}
+
+// ociLayer streams a unified GoImage from LXD and writes its rootfs to w as a gzipped OCI layer. It returns the
+// config of the OCI image, with the architecture of the image's metadata.yaml, and the layer's descriptor
+func (im *GoImage) ociLayer(ctx context.Context, w io.Writer) (*ociImageConfig, ociDescriptor, error) {
+	config := &ociImageConfig{
+		Architecture: "amd64",
+		OS:           "linux",
+		Created:      time.Now().UTC().Format(time.RFC3339),
+		RootFS:       &ociRootFS{Type: "layers"},
+	}
+	digest, diffID := sha256.New(), sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(w, digest)}
+	gw := gzip.NewWriter(counter)
+	tw := tar.NewWriter(io.MultiWriter(gw, diffID))
+	err := im.exportParts(ctx, func(fileName string, r io.Reader) error {
+		if strings.HasPrefix(fileName, "meta-") {
+			return ErrSplitImage
+		}
+		r, _, err := im.decryptPart(r, nil)
+		if err != nil {
+			return err
+		}
+		return writeOCILayer(ctx, r, tw, config)
+	})
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gw.Close()
+	}
+	if err != nil {
+		return nil, ociDescriptor{}, err
+	}
+	config.RootFS.DiffIDs = []string{"sha256:" + hex.EncodeToString(diffID.Sum(nil))}
+	desc := ociDescriptor{MediaType: ociLayerMediaType, Digest: "sha256:" + hex.EncodeToString(digest.Sum(nil)), Size: counter.n}
+	return config, desc, nil
+}
+
+// writeOCILayer copies the rootfs/ entries of an LXD image tarball, read from r, to the root of an OCI layer and
+// sets the architecture of config from the tarball's metadata.yaml
+func writeOCILayer(ctx context.Context, r io.Reader, tw *tar.Writer, config *ociImageConfig) error {
+	br := bufio.NewReaderSize(r, imageHeaderSize)
+	header, _ := br.Peek(imageHeaderSize)
+	switch compression := detectImageCompression(header); compression {
+	case CompressionGzip:
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	case CompressionNone:
+		r = br
+	default:
+		return fmt.Errorf("%s compressed images cannot be converted, publish them with gzip", compression)
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		name := strings.TrimPrefix(hdr.Name, "./")
+		if name == "metadata.yaml" {
+			var metadata lxdMetadata
+			contents, err := ioutil.ReadAll(io.LimitReader(tr, 1<<20))
+			if err == nil && yaml.Unmarshal(contents, &metadata) == nil {
+				config.Architecture = ociArchitecture(metadata.Architecture)
+			}
+			continue
+		}
+		if name != "rootfs" && !strings.HasPrefix(name, "rootfs/") {
+			continue
+		}
+		if hdr.Name = cleanLayerPath(strings.TrimPrefix(name, "rootfs")); hdr.Name == "" {
+			continue
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			hdr.Name += "/"
+		}
+		if hdr.Typeflag == tar.TypeLink {
+			hdr.Linkname = cleanLayerPath(strings.TrimPrefix(strings.TrimPrefix(hdr.Linkname, "./"), "rootfs"))
+		}
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err = io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// ociArchitecture returns the OCI name of an LXD architecture
+func ociArchitecture(arch string) string {
+	for oci, lxd := range lxdArchitectures {
+		if lxd == arch {
+			return oci
+		}
+	}
+	if arch == "" {
+		return "amd64"
+	}
+	return arch
+}
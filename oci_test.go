@@ -0,0 +1,508 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestOCI
+func TestOCI(t *testing.T) {
+	t.Run("ConvertDocker", testOCIConvertDocker)
+	t.Run("ConvertLayout", testOCIConvertLayout)
+	t.Run("ConvertImport", testOCIConvertImport)
+	t.Run("Export", testOCIExport)
+}
+
+// testLayerEntry is an entry of a test layer, a directory when its name ends in /
+type testLayerEntry struct {
+	name     string
+	contents string
+}
+
+// testLayer builds a gzipped layer tarball
+func testLayer(t *testing.T, entries ...testLayerEntry) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, entry := range entries {
+		hdr := &tar.Header{Name: entry.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(entry.contents))}
+		if strings.HasSuffix(entry.name, "/") {
+			hdr.Mode, hdr.Typeflag, hdr.Size = 0755, tar.TypeDir, 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("Error Writing Test Layer: %v", err)
+		}
+		tw.Write([]byte(entry.contents))
+	}
+	tw.Close()
+	gw.Close()
+	return buf.Bytes()
+}
+
+// testLayers returns the layers of the test image, bottom first, whose upper layer removes /etc/motd and
+// replaces the contents of /opt/app
+func testLayers(t *testing.T) [][]byte {
+	return [][]byte{
+		testLayer(t,
+			testLayerEntry{"etc/", ""},
+			testLayerEntry{"etc/hostname", "base"},
+			testLayerEntry{"etc/motd", "welcome"},
+			testLayerEntry{"opt/app/", ""},
+			testLayerEntry{"opt/app/old.conf", "old"},
+		),
+		testLayer(t,
+			testLayerEntry{"etc/hostname", "app"},
+			testLayerEntry{"etc/.wh.motd", ""},
+			testLayerEntry{"opt/app/", ""},
+			testLayerEntry{"opt/app/.wh..wh..opq", ""},
+			testLayerEntry{"opt/app/new.conf", "new"},
+		),
+	}
+}
+
+// testOCIConfig is the config blob of the test image
+func testOCIConfig() []byte {
+	config, _ := json.Marshal(ociImageConfig{
+		Architecture: "arm64",
+		OS:           "linux",
+		Created:      "2021-04-18T10:00:00Z",
+		Config: OCIConfig{
+			Env:        []string{"PATH=/usr/bin", "APP_ENV=production"},
+			Entrypoint: []string{"/usr/bin/app"},
+			Cmd:        []string{"--serve"},
+			WorkingDir: "/opt/app",
+		},
+	})
+	return config
+}
+
+// testDigest returns the sha256 digest of a blob
+func testDigest(blob []byte) string {
+	sum := sha256.Sum256(blob)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// writeTestFiles writes files into dir, creating their parent directories
+func writeTestFiles(t *testing.T, dir string, files map[string][]byte) {
+	for name, contents := range files {
+		fPath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fPath), 0755); err != nil {
+			t.Fatalf("Error Creating Test Directory: %v", err)
+		}
+		if err := ioutil.WriteFile(fPath, contents, 0644); err != nil {
+			t.Fatalf("Error Writing Test File: %v", err)
+		}
+	}
+}
+
+// writeTestTar writes files into an uncompressed tar archive at fPath
+func writeTestTar(t *testing.T, fPath string, files map[string][]byte) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, contents := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(contents))})
+		tw.Write(contents)
+	}
+	tw.Close()
+	if err := ioutil.WriteFile(fPath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Error Writing Test Archive: %v", err)
+	}
+}
+
+// convertedFiles returns the rootfs files of a converted image and its metadata.yaml
+func convertedFiles(img *GoImage) (map[string]string, string) {
+	files, metadata := map[string]string{}, ""
+	readTarball(img.Contents[0], func(name string, contents []byte) {
+		if name == "metadata.yaml" {
+			metadata = string(contents)
+		} else {
+			files[name] = string(contents)
+		}
+	})
+	return files, metadata
+}
+
+// checkConvertedImage checks the flattened rootfs and the properties of the converted test image
+func checkConvertedImage(t *testing.T, img *GoImage) {
+	files, metadata := convertedFiles(img)
+	expected := map[string]string{"rootfs/etc/hostname": "app", "rootfs/opt/app/new.conf": "new"}
+	if len(files) != len(expected) {
+		t.Errorf("Expected The Rootfs To Hold %v, Got %v", expected, files)
+	}
+	for name, contents := range expected {
+		if files[name] != contents {
+			t.Errorf("Expected %s To Hold %q, Got %q", name, contents, files[name])
+		}
+	}
+	if !strings.Contains(metadata, "architecture: aarch64") || !strings.Contains(metadata, "creation_date: 1618740000") {
+		t.Errorf("Expected The Metadata To Hold The Architecture And Creation Date, Got %s", metadata)
+	}
+	sum := sha256.Sum256(img.Contents[0])
+	if img.Fingerprint != hex.EncodeToString(sum[:]) || img.Size != int64(len(img.Contents[0])) || img.Format != ImageUnified {
+		t.Errorf("Expected The Fingerprint And Size Of A Unified Image, Got %+v", img)
+	}
+	for key, val := range map[string]string{
+		"architecture":   "aarch64",
+		"oci.entrypoint": `["/usr/bin/app"]`,
+		"oci.cmd":        `["--serve"]`,
+		"oci.env":        `["PATH=/usr/bin","APP_ENV=production"]`,
+		"oci.workdir":    "/opt/app",
+	} {
+		if img.Properties[key] != val {
+			t.Errorf("Expected Property %s To Be %q, Got %q", key, val, img.Properties[key])
+		}
+	}
+}
+
+// testDockerSave builds the files of a docker save tarball of the test image tagged app:1.0
+func testDockerSave(t *testing.T) map[string][]byte {
+	layers := testLayers(t)
+	manifest, _ := json.Marshal([]dockerManifest{{
+		Config:   "config.json",
+		RepoTags: []string{"app:1.0"},
+		Layers:   []string{"base/layer.tar", "top/layer.tar"},
+	}})
+	return map[string][]byte{
+		"manifest.json":  manifest,
+		"config.json":    testOCIConfig(),
+		"base/layer.tar": layers[0],
+		"top/layer.tar":  layers[1],
+	}
+}
+
+// testOCIConvertDocker
+func testOCIConvertDocker(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testOCIConvertDocker...")
+	dir, err := ioutil.TempDir("", "oci")
+	if err != nil {
+		t.Fatalf("Error Creating Test Directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	fmt.Println("----------->BEGINNING A: Converting A Docker Save Tarball...")
+	archive := filepath.Join(dir, "app.tar")
+	writeTestTar(t, archive, testDockerSave(t))
+	img, err := ConvertOCI(archive, nil)
+	if err != nil {
+		t.Fatalf("Error Converting Docker Save Tarball: %v", err)
+	}
+	checkConvertedImage(t, img)
+	if img.Name != "app-1.0" || img.Properties["os"] != "linux" || img.Properties["release"] != "1.0" || img.DateTime != "2021-04-18T10:00:00Z" {
+		t.Errorf("Expected The Image To Be Named And Released By Its Tag, Got %+v", img)
+	}
+	fmt.Println("----------->PASSED A: Converting A Docker Save Tarball...")
+	fmt.Println("----------->BEGINNING B: Converting An Extracted Tarball...")
+	extracted := filepath.Join(dir, "extracted")
+	writeTestFiles(t, extracted, testDockerSave(t))
+	img, err = ConvertOCI(extracted, &OCIConvertOptions{Reference: "app:1.0", Name: "app", OS: "alpine", Release: "3.13"})
+	if err != nil {
+		t.Fatalf("Error Converting Extracted Tarball: %v", err)
+	}
+	checkConvertedImage(t, img)
+	if img.Name != "app" || img.Properties["release"] != "3.13" || img.Properties["description"] != "app:1.0 converted from OCI" {
+		t.Errorf("Expected The Options To Name The Image, Got %+v", img)
+	}
+	if _, err = ConvertOCI(extracted, &OCIConvertOptions{Reference: "missing:1.0"}); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("Expected ErrImageNotFound, Got %v", err)
+	}
+	fmt.Println("----------->PASSED B: Converting An Extracted Tarball...")
+	fmt.Println("----------->BEGINNING C: Refusing Paths Outside The Source...")
+	secret := testOCIConfig()
+	writeTestFiles(t, dir, map[string][]byte{"secret.json": secret, "secret/layer.tar": testLayers(t)[0]})
+	for _, manifest := range []dockerManifest{
+		{Config: "../secret.json", Layers: []string{"base/layer.tar"}},
+		{Config: "config.json", Layers: []string{"../secret/layer.tar"}},
+		{Config: "config.json", Layers: []string{filepath.ToSlash(filepath.Join(dir, "secret/layer.tar"))}},
+		{Config: "config.json", Layers: []string{"base/../../secret/layer.tar"}},
+	} {
+		files := testDockerSave(t)
+		files["manifest.json"], _ = json.Marshal([]dockerManifest{manifest})
+		malicious := filepath.Join(dir, "malicious")
+		os.RemoveAll(malicious)
+		writeTestFiles(t, malicious, files)
+		if _, err = ConvertOCI(malicious, nil); err == nil || !strings.Contains(err.Error(), "invalid path") {
+			t.Errorf("Expected %+v To Be Refused, Got %v", manifest, err)
+		}
+		writeTestTar(t, malicious+".tar", files)
+		if _, err = ConvertOCI(malicious+".tar", nil); err == nil || !strings.Contains(err.Error(), "invalid path") {
+			t.Errorf("Expected %+v To Be Refused From An Archive, Got %v", manifest, err)
+		}
+	}
+	fmt.Println("----------->PASSED C: Refusing Paths Outside The Source...")
+	fmt.Println("<-----------testOCIConvertDocker COMPLETE")
+}
+
+// testOCILayout builds the files of an OCI layout holding a multi-platform index of the test image named app:1.0
+func testOCILayout(t *testing.T) map[string][]byte {
+	layers := testLayers(t)
+	config := testOCIConfig()
+	files := map[string][]byte{"oci-layout": []byte(`{"imageLayoutVersion":"1.0.0"}`)}
+	addBlob := func(blob []byte, mediaType string) ociDescriptor {
+		digest := testDigest(blob)
+		files["blobs/sha256/"+strings.TrimPrefix(digest, "sha256:")] = blob
+		return ociDescriptor{MediaType: mediaType, Digest: digest, Size: int64(len(blob))}
+	}
+	manifest, _ := json.Marshal(ociManifest{
+		SchemaVersion: 2,
+		Config:        addBlob(config, "application/vnd.oci.image.config.v1+json"),
+		Layers: []ociDescriptor{
+			addBlob(layers[0], "application/vnd.oci.image.layer.v1.tar+gzip"),
+			addBlob(layers[1], "application/vnd.oci.image.layer.v1.tar+gzip"),
+		},
+	})
+	arm := addBlob(manifest, "application/vnd.oci.image.manifest.v1+json")
+	arm.Platform = &ociPlatform{Architecture: "arm64", OS: "linux"}
+	amd := addBlob([]byte(`{"schemaVersion":2,"layers":[]}`), "application/vnd.oci.image.manifest.v1+json")
+	amd.Platform = &ociPlatform{Architecture: "amd64", OS: "linux"}
+	nested, _ := json.Marshal(ociIndex{SchemaVersion: 2, MediaType: ociIndexMediaType, Manifests: []ociDescriptor{amd, arm}})
+	top := addBlob(nested, ociIndexMediaType)
+	top.Annotations = map[string]string{ociRefNameAnnotation: "1.0", containerdNameAnnotation: "docker.io/library/app:1.0"}
+	files["index.json"], _ = json.Marshal(ociIndex{SchemaVersion: 2, Manifests: []ociDescriptor{top}})
+	return files
+}
+
+// testOCIConvertLayout
+func testOCIConvertLayout(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testOCIConvertLayout...")
+	dir, err := ioutil.TempDir("", "oci")
+	if err != nil {
+		t.Fatalf("Error Creating Test Directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := testOCILayout(t)
+	fmt.Println("----------->BEGINNING A: Converting An OCI Layout...")
+	writeTestFiles(t, filepath.Join(dir, "layout"), files)
+	img, err := ConvertOCI(filepath.Join(dir, "layout"), &OCIConvertOptions{Reference: "app:1.0", Architecture: "arm64"})
+	if err != nil {
+		t.Fatalf("Error Converting OCI Layout: %v", err)
+	}
+	checkConvertedImage(t, img)
+	if img.Name != "app-1.0" {
+		t.Errorf("Expected The Image To Be Named By Its Reference, Got %s", img.Name)
+	}
+	fmt.Println("----------->PASSED A: Converting An OCI Layout...")
+	fmt.Println("----------->BEGINNING B: Streaming An OCI Archive...")
+	writeTestTar(t, filepath.Join(dir, "layout.tar"), files)
+	var buf bytes.Buffer
+	streamed, err := ConvertOCITo(filepath.Join(dir, "layout.tar"), &OCIConvertOptions{Architecture: "arm64"}, &buf)
+	if err != nil {
+		t.Fatalf("Error Streaming OCI Archive: %v", err)
+	}
+	streamed.Contents = [][]byte{buf.Bytes()}
+	checkConvertedImage(t, streamed)
+	fmt.Println("----------->PASSED B: Streaming An OCI Archive...")
+	fmt.Println("----------->BEGINNING C: Refusing Tampered Layers...")
+	for name, contents := range files {
+		if bytes.HasPrefix(contents, []byte{0x1f, 0x8b}) {
+			files[name] = testLayer(t, testLayerEntry{"etc/shadow", "tampered"})
+			break
+		}
+	}
+	writeTestFiles(t, filepath.Join(dir, "tampered"), files)
+	if _, err = ConvertOCI(filepath.Join(dir, "tampered"), &OCIConvertOptions{Architecture: "arm64"}); !errors.Is(err, ErrImageMismatch) {
+		t.Errorf("Expected ErrImageMismatch, Got %v", err)
+	}
+	if _, err = ConvertOCI(filepath.Join(dir, "layout"), &OCIConvertOptions{Architecture: "s390x"}); err == nil {
+		t.Errorf("Expected An Error For A Missing Platform")
+	}
+	fmt.Println("----------->PASSED C: Refusing Tampered Layers...")
+	fmt.Println("<-----------testOCIConvertLayout COMPLETE")
+}
+
+// testOCIConvertImport
+func testOCIConvertImport(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testOCIConvertImport...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("The converted test image has no init system to boot")
+	}
+	dir, err := ioutil.TempDir("", "oci")
+	if err != nil {
+		t.Fatalf("Error Creating Test Directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	writeTestFiles(t, dir, testDockerSave(t))
+	fmt.Println("----------->BEGINNING A: Launching A Converted Image...")
+	img, err := ConvertOCI(dir, &OCIConvertOptions{OS: "alpine"})
+	if err != nil {
+		t.Fatalf("Error Converting Docker Save Tarball: %v", err)
+	}
+	goCon, err := goCluster.ImportContainer("OCITest", img)
+	if err != nil {
+		t.Fatalf("Error Importing Converted Image: %v", err)
+	}
+	defer goCluster.DeleteContainer("OCITest")
+	con := fake.Containers[goCon.Name]
+	if string(con.Files["/etc/hostname"]) != "app" || con.Files["/etc/motd"] != nil || con.Config["volatile.base_image"] != img.Fingerprint {
+		t.Errorf("Expected The Container To Launch From The Flattened Rootfs, Got %v", con.Files)
+	}
+	if con.OS != "alpine" || con.Release != "1.0" {
+		t.Errorf("Expected The Imported Image's Metadata To Hold Its Properties, Got %s %s", con.OS, con.Release)
+	}
+	fmt.Println("----------->PASSED A: Launching A Converted Image...")
+	fmt.Println("<-----------testOCIConvertImport COMPLETE")
+}
+
+// writerFunc is an io.Writer calling a function
+type writerFunc func(p []byte) (int, error)
+
+func (wf writerFunc) Write(p []byte) (int, error) {
+	return wf(p)
+}
+
+// testOCIExport
+func testOCIExport(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testOCIExport...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("Checking the exported rootfs needs the fake's files")
+	}
+	if err := goCluster.CreateContainer(NewAuth("tester", AuthPassword, "l0lThis1sAWeak1", "", "22"), false, "OCIExport", "ubuntu", "focal", []byte{}); err != nil {
+		t.Fatalf("Error Creating OCI Export Container: %v", err)
+	}
+	defer goCluster.DeleteContainer("OCIExport")
+	goCon, err := goCluster.GetContainer("OCIExport")
+	if err != nil {
+		t.Fatalf("Error Getting OCI Export Container: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "oci")
+	if err != nil {
+		t.Fatalf("Error Creating Test Directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	con := fake.Containers["OCIExport"]
+	con.Files["/opt/app/app.conf"] = []byte("v1")
+	fmt.Println("----------->BEGINNING A: Exporting An OCI Layout...")
+	config := OCIConfig{Env: []string{"APP_ENV=ci"}, Cmd: []string{"/opt/app/run"}, WorkingDir: "/opt/app"}
+	digest, err := goCon.ExportOCI(filepath.Join(dir, "layout"), &OCIExportOptions{Reference: "v1", Config: config})
+	if err != nil {
+		t.Fatalf("Error Exporting OCI Layout: %v", err)
+	}
+	if !ociDigest.MatchString(digest) {
+		t.Errorf("Expected The Manifest Digest, Got %s", digest)
+	}
+	if len(fake.StoredImages) != 0 || len(con.Snapshots) != 0 {
+		t.Errorf("Expected The Published Image And Snapshot To Be Cleaned Up, Got %d %v", len(fake.StoredImages), con.Snapshots)
+	}
+	img, err := ConvertOCI(filepath.Join(dir, "layout"), &OCIConvertOptions{Reference: "v1"})
+	if err != nil {
+		t.Fatalf("Error Converting Exported OCI Layout: %v", err)
+	}
+	files, _ := convertedFiles(img)
+	if files["rootfs/opt/app/app.conf"] != "v1" || files["rootfs/etc/hostname"] != string(con.Files["/etc/hostname"]) {
+		t.Errorf("Expected The Layer To Hold The Container's Rootfs, Got %v", files)
+	}
+	if img.Properties["oci.cmd"] != `["/opt/app/run"]` || img.Properties["oci.env"] != `["APP_ENV=ci"]` || img.Properties["oci.workdir"] != "/opt/app" {
+		t.Errorf("Expected The Config To Hold The Caller's Runtime Configuration, Got %v", img.Properties)
+	}
+	if img.Properties["architecture"] != "x86_64" {
+		t.Errorf("Expected The Container's Architecture, Got %s", img.Properties["architecture"])
+	}
+	fmt.Println("----------->PASSED A: Exporting An OCI Layout...")
+	fmt.Println("----------->BEGINNING B: Streaming An OCI Archive...")
+	archive, err := os.Create(filepath.Join(dir, "export.tar"))
+	if err != nil {
+		t.Fatalf("Error Creating Test Archive: %v", err)
+	}
+	defer archive.Close()
+	// an encrypting container's rootfs must not be staged on disk, where it would be left unencrypted
+	tmpDir := filepath.Join(dir, "tmp")
+	if err = os.Mkdir(tmpDir, 0755); err != nil {
+		t.Fatalf("Error Creating Temporary Directory: %v", err)
+	}
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	os.Setenv("TMPDIR", tmpDir)
+	goCon.Keys = NewStaticKeys("test", bytes.Repeat([]byte{7}, 32))
+	staged := 0
+	watched := writerFunc(func(p []byte) (int, error) {
+		entries, _ := ioutil.ReadDir(tmpDir)
+		staged += len(entries)
+		return archive.Write(p)
+	})
+	if _, err = goCon.ExportOCITo(watched, nil); err != nil {
+		t.Fatalf("Error Streaming OCI Archive: %v", err)
+	}
+	goCon.Keys = nil
+	if staged != 0 {
+		t.Errorf("Expected Nothing To Be Staged On Disk While Streaming")
+	}
+	img, err = ConvertOCI(archive.Name(), nil)
+	if err != nil {
+		t.Fatalf("Error Converting Streamed OCI Archive: %v", err)
+	}
+	if files, _ = convertedFiles(img); files["rootfs/opt/app/app.conf"] != "v1" || img.Name != "latest" {
+		t.Errorf("Expected The Container's Current Rootfs Tagged Latest, Got %v %s", files, img.Name)
+	}
+	notDir := filepath.Join(dir, "file")
+	if err = ioutil.WriteFile(notDir, nil, 0644); err != nil {
+		t.Fatalf("Error Writing Test File: %v", err)
+	}
+	fake.mu.Lock()
+	fake.Calls = nil
+	fake.mu.Unlock()
+	if _, err = goCon.ExportOCI(notDir, nil); err == nil {
+		t.Fatalf("Expected Exporting Into A File To Fail")
+	}
+	lastExport, deleted := -1, -1
+	for ind, call := range fake.Calls {
+		if strings.HasPrefix(call, "ExportImage ") {
+			lastExport = ind
+		} else if strings.HasPrefix(call, "DeleteImage ") {
+			deleted = ind
+		}
+	}
+	if lastExport < 0 || deleted < lastExport {
+		t.Errorf("Expected The Published Image To Be Deleted After The Layer Was Read, Got %v", fake.Calls)
+	}
+	fmt.Println("----------->PASSED B: Streaming An OCI Archive...")
+	fmt.Println("----------->BEGINNING C: Exporting A Snapshot Into The Layout...")
+	snapName, err := goCon.CreateSnapshot()
+	if err != nil {
+		t.Fatalf("Error Creating Snapshot: %v", err)
+	}
+	con.Files["/opt/app/app.conf"] = []byte("v2")
+	if _, err = goCon.ExportOCI(filepath.Join(dir, "layout"), &OCIExportOptions{Snapshot: snapName, Reference: "snap"}); err != nil {
+		t.Fatalf("Error Exporting Snapshot: %v", err)
+	}
+	if len(con.Snapshots) != 1 {
+		t.Errorf("Expected The Exported Snapshot To Be Kept, Got %v", con.Snapshots)
+	}
+	var index ociIndex
+	if err = readJSON(ociDir(filepath.Join(dir, "layout")), "index.json", &index); err != nil || len(index.Manifests) != 2 {
+		t.Fatalf("Expected The Layout To Hold Both Images, Got %+v %v", index, err)
+	}
+	img, err = ConvertOCI(filepath.Join(dir, "layout"), &OCIConvertOptions{Reference: "snap"})
+	if err != nil {
+		t.Fatalf("Error Converting Exported Snapshot: %v", err)
+	}
+	if files, _ = convertedFiles(img); files["rootfs/opt/app/app.conf"] != "v1" {
+		t.Errorf("Expected The Snapshot's Rootfs, Got %q", files["rootfs/opt/app/app.conf"])
+	}
+	if _, err = goCon.ExportOCI(filepath.Join(dir, "layout"), &OCIExportOptions{Snapshot: "missing"}); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("Expected ErrSnapshotNotFound, Got %v", err)
+	}
+	fmt.Println("----------->PASSED C: Exporting A Snapshot Into The Layout...")
+	fmt.Println("<-----------testOCIExport COMPLETE")
+}
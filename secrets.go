@@ -0,0 +1,199 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// redacted replaces secrets whenever an Auth or GoContainer is printed or serialized
+const redacted = "[REDACTED]"
+
+// cryptAlphabet is the base 64 alphabet of crypt(3) hashes and salts
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// sha512CryptRounds is the default number of SHA-512 crypt rounds, which is left out of the hash
+const sha512CryptRounds = 5000
+
+// sha512CryptOrder is the order in which SHA-512 crypt encodes the bytes of its final digest, in groups of three
+var sha512CryptOrder = [][3]int{
+	{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4}, {47, 5, 26}, {6, 27, 48},
+	{28, 49, 7}, {50, 8, 29}, {9, 30, 51}, {31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13},
+	{56, 14, 35}, {15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19}, {62, 20, 41},
+}
+
+// HashPassword returns a SHA-512 crypt ("$6$") hash of password with a random salt, as cloud-init's passwd takes
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	for i, b := range salt {
+		salt[i] = cryptAlphabet[int(b)%len(cryptAlphabet)]
+	}
+	return sha512Crypt(password, string(salt), sha512CryptRounds), nil
+}
+
+// sha512Crypt hashes password with salt and rounds the way glibc's crypt(3) does for "$6$" hashes
+func sha512Crypt(password string, salt string, rounds int) string {
+	pw := []byte(password)
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+	s := []byte(salt)
+	alt := sha512.New()
+	alt.Write(pw)
+	alt.Write(s)
+	alt.Write(pw)
+	altSum := alt.Sum(nil)
+	a := sha512.New()
+	a.Write(pw)
+	a.Write(s)
+	cnt := len(pw)
+	for ; cnt > 64; cnt -= 64 {
+		a.Write(altSum)
+	}
+	a.Write(altSum[:cnt])
+	for cnt = len(pw); cnt > 0; cnt >>= 1 {
+		if cnt&1 != 0 {
+			a.Write(altSum)
+		} else {
+			a.Write(pw)
+		}
+	}
+	sum := a.Sum(nil)
+	dp := sha512.New()
+	for i := 0; i < len(pw); i++ {
+		dp.Write(pw)
+	}
+	p := repeatDigest(dp.Sum(nil), len(pw))
+	ds := sha512.New()
+	for i := 0; i < 16+int(sum[0]); i++ {
+		ds.Write(s)
+	}
+	sp := repeatDigest(ds.Sum(nil), len(s))
+	for i := 0; i < rounds; i++ {
+		c := sha512.New()
+		if i&1 != 0 {
+			c.Write(p)
+		} else {
+			c.Write(sum)
+		}
+		if i%3 != 0 {
+			c.Write(sp)
+		}
+		if i%7 != 0 {
+			c.Write(p)
+		}
+		if i&1 != 0 {
+			c.Write(sum)
+		} else {
+			c.Write(p)
+		}
+		sum = c.Sum(nil)
+	}
+	hash := "$6$"
+	if rounds != sha512CryptRounds {
+		hash = hash + "rounds=" + strconv.Itoa(rounds) + "$"
+	}
+	hash = hash + salt + "$"
+	for _, order := range sha512CryptOrder {
+		hash = hash + cryptEncode(uint(sum[order[0]])<<16|uint(sum[order[1]])<<8|uint(sum[order[2]]), 4)
+	}
+	return hash + cryptEncode(uint(sum[63]), 2)
+}
+
+// repeatDigest repeats digest until it is size bytes long
+func repeatDigest(digest []byte, size int) []byte {
+	out := make([]byte, 0, size)
+	for len(out) < size {
+		n := size - len(out)
+		if n > len(digest) {
+			n = len(digest)
+		}
+		out = append(out, digest[:n]...)
+	}
+	return out
+}
+
+// cryptEncode writes the low 6*n bits of w as n crypt base 64 characters, least significant first
+func cryptEncode(w uint, n int) string {
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = cryptAlphabet[w&0x3f]
+		w >>= 6
+	}
+	return string(out)
+}
+
+// redactSecret hides a secret, leaving an empty one empty
+func redactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
+
+// initFilePasswords matches the password options of cloud-config users
+var initFilePasswords = regexp.MustCompile(`(?m)^(\s*-?\s*(?:plain_text_passwd|hashed_passwd|passwd)\s*:).*$`)
+
+// redactInitFile hides the passwords, and password hashes, of an init file
+func redactInitFile(initFile []byte) string {
+	return initFilePasswords.ReplaceAllString(string(initFile), "$1 "+redacted)
+}
+
+// String prints an Auth without its Credential or SecurityString
+func (a Auth) String() string {
+	return fmt.Sprintf("Auth{User: %s, Type: %s, Credential: %s, SecurityString: %s, Port: %s}",
+		a.User, a.Type, redactSecret(a.Credential), redactSecret(a.SecurityString), a.Port)
+}
+
+// GoString prints an Auth for %#v without its Credential or SecurityString
+func (a Auth) GoString() string {
+	return a.String()
+}
+
+// MarshalJSON serializes an Auth without its Credential or SecurityString
+func (a Auth) MarshalJSON() ([]byte, error) {
+	type authJSON Auth
+	out := authJSON(a)
+	out.Credential = redactSecret(out.Credential)
+	out.SecurityString = redactSecret(out.SecurityString)
+	return json.Marshal(out)
+}
+
+// String prints a GoContainer without its Auth's secrets or the passwords of its InitFile
+func (co GoContainer) String() string {
+	return fmt.Sprintf("GoContainer{Name: %s, Type: %s, Release: %s, Status: %s, Auth: %v, InitFile: %q}",
+		co.Name, co.Type, co.Release, co.Status, co.Auth, redactInitFile(co.InitFile))
+}
+
+// GoString prints a GoContainer for %#v without its Auth's secrets or the passwords of its InitFile
+func (co GoContainer) GoString() string {
+	return co.String()
+}
+
+// MarshalJSON serializes a GoContainer without its Auth's secrets or the passwords of its InitFile,
+// its SSHClient is a live connection and is left out
+func (co GoContainer) MarshalJSON() ([]byte, error) {
+	type goContainerJSON GoContainer
+	out := goContainerJSON(co)
+	out.SSHClient = nil
+	out.InitFile = []byte(redactInitFile(co.InitFile))
+	return json.Marshal(out)
+}
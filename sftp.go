@@ -0,0 +1,209 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"context"
+	"errors"
+	"github.com/pkg/sftp"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// TransferProgress is called as a file is copied with the bytes copied so far and the file's size
+type TransferProgress func(filePath string, copied int64, size int64)
+
+// SFTP returns the SSHClient's sftp.Client, starting the sftp subsystem on its first call
+func (sc *SSHClient) SFTP() (*sftp.Client, error) {
+	sc.sftpMu.Lock()
+	defer sc.sftpMu.Unlock()
+	if sc.SSHConn == nil {
+		return nil, errors.New("the SSHClient is not connected")
+	}
+	if sc.sftpClient == nil {
+		client, err := sftp.NewClient(sc.SSHConn)
+		if err != nil {
+			return nil, err
+		}
+		sc.sftpClient = client
+	}
+	return sc.sftpClient, nil
+}
+
+// ReadDir lists a remote directory
+func (sc *SSHClient) ReadDir(remotePath string) ([]os.FileInfo, error) {
+	client, err := sc.SFTP()
+	if err != nil {
+		return []os.FileInfo{}, err
+	}
+	return client.ReadDir(remotePath)
+}
+
+// Mkdir creates a remote directory, along with any missing parents, with the permissions perm
+func (sc *SSHClient) Mkdir(remotePath string, perm os.FileMode) error {
+	client, err := sc.SFTP()
+	if err != nil {
+		return err
+	}
+	if err = client.MkdirAll(remotePath); err != nil {
+		return err
+	}
+	return client.Chmod(remotePath, perm)
+}
+
+// Chmod changes the mode of a remote file or directory
+func (sc *SSHClient) Chmod(remotePath string, mode os.FileMode) error {
+	client, err := sc.SFTP()
+	if err != nil {
+		return err
+	}
+	return client.Chmod(remotePath, mode)
+}
+
+// Upload copies a local file, or a directory and everything in it, to remotePath
+func (sc *SSHClient) Upload(localPath string, remotePath string, progress TransferProgress) error {
+	return sc.UploadContext(context.Background(), localPath, remotePath, progress)
+}
+
+// UploadContext is like Upload but returns ctx.Err() once ctx is done
+func (sc *SSHClient) UploadContext(ctx context.Context, localPath string, remotePath string, progress TransferProgress) error {
+	client, err := sc.SFTP()
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(localPath, func(fPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localPath, fPath)
+		if err != nil {
+			return err
+		}
+		rPath := path.Join(remotePath, filepath.ToSlash(rel))
+		if info.IsDir() {
+			if err = client.MkdirAll(rPath); err != nil {
+				return err
+			}
+			return client.Chmod(rPath, info.Mode().Perm())
+		} else if !info.Mode().IsRegular() {
+			return nil
+		}
+		return uploadFile(ctx, client, fPath, rPath, info, progress)
+	})
+}
+
+// uploadFile copies the local file fPath to rPath with the same permissions
+func uploadFile(ctx context.Context, client *sftp.Client, fPath string, rPath string, info os.FileInfo, progress TransferProgress) error {
+	src, err := os.Open(fPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := client.Create(rPath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	if _, err = io.Copy(dst, newTransferReader(ctx, src, rPath, info.Size(), progress)); err != nil {
+		return err
+	}
+	return dst.Chmod(info.Mode().Perm())
+}
+
+// Download copies a remote file, or a directory and everything in it, to localPath
+func (sc *SSHClient) Download(remotePath string, localPath string, progress TransferProgress) error {
+	return sc.DownloadContext(context.Background(), remotePath, localPath, progress)
+}
+
+// DownloadContext is like Download but returns ctx.Err() once ctx is done
+func (sc *SSHClient) DownloadContext(ctx context.Context, remotePath string, localPath string, progress TransferProgress) error {
+	client, err := sc.SFTP()
+	if err != nil {
+		return err
+	}
+	walker := client.Walk(remotePath)
+	for walker.Step() {
+		if err = walker.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(filepath.FromSlash(remotePath), filepath.FromSlash(walker.Path()))
+		if err != nil {
+			return err
+		}
+		fPath := filepath.Join(localPath, rel)
+		info := walker.Stat()
+		if info.IsDir() {
+			if err = os.MkdirAll(fPath, 0700); err != nil {
+				return err
+			}
+			if err = os.Chmod(fPath, info.Mode().Perm()); err != nil {
+				return err
+			}
+			continue
+		} else if !info.Mode().IsRegular() {
+			continue
+		}
+		if err = downloadFile(ctx, client, walker.Path(), fPath, info, progress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downloadFile copies the remote file rPath to fPath with the same permissions
+func downloadFile(ctx context.Context, client *sftp.Client, rPath string, fPath string, info os.FileInfo, progress TransferProgress) error {
+	src, err := client.Open(rPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(fPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	if _, err = io.Copy(dst, newTransferReader(ctx, src, rPath, info.Size(), progress)); err != nil {
+		return err
+	}
+	return dst.Chmod(info.Mode().Perm())
+}
+
+// transferReader reports the progress of a file copy and stops it once ctx is done
+type transferReader struct {
+	ctx      context.Context
+	src      io.Reader
+	filePath string
+	copied   int64
+	size     int64
+	progress TransferProgress
+}
+
+// newTransferReader creates a pointer to a new transferReader
+func newTransferReader(ctx context.Context, src io.Reader, filePath string, size int64, progress TransferProgress) *transferReader {
+	return &transferReader{ctx, src, filePath, 0, size, progress}
+}
+
+// Read from the transferReader's source, reporting progress after each read
+func (tr *transferReader) Read(p []byte) (int, error) {
+	if err := tr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := tr.src.Read(p)
+	tr.copied += int64(n)
+	if tr.progress != nil && (n > 0 || err == io.EOF) {
+		tr.progress(tr.filePath, tr.copied, tr.size)
+	}
+	return n, err
+}
@@ -0,0 +1,163 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// TestSFTP
+func TestSFTP(t *testing.T) {
+	if testLXD() {
+		t.Skip("the test SSH server serves files from the test host")
+	}
+	if _, err := exec.LookPath(ShellToUse); err != nil {
+		t.Skip("the test SSH server needs " + ShellToUse)
+	}
+	t.Run("UploadDownload", testSFTPUploadDownload)
+	t.Run("DirOps", testSFTPDirOps)
+	t.Run("Cancel", testSFTPCancel)
+}
+
+// writeTestTree creates a small directory tree of files under dir
+func writeTestTree(t *testing.T, dir string) map[string][]byte {
+	files := map[string][]byte{
+		"a.txt":          []byte("alpha\n"),
+		"sub/b.txt":      bytes.Repeat([]byte("beta"), 20000),
+		"sub/deep/c.bin": {0, 1, 2, 3},
+	}
+	for name, data := range files {
+		fPath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fPath, data, 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(dir, "a.txt"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// tempTestDir creates a temporary directory that is removed when the test ends
+func tempTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "go-containers-sftp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+// testSFTPUploadDownload
+func testSFTPUploadDownload(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testSFTPUploadDownload...")
+	sshClient := startTestSSHClient(t)
+	local, remote, back := tempTestDir(t), tempTestDir(t), tempTestDir(t)
+	files := writeTestTree(t, local)
+	uploaded := map[string]int64{}
+	err := sshClient.Upload(local, filepath.Join(remote, "tree"), func(filePath string, copied int64, size int64) {
+		if copied > size {
+			t.Errorf("Progress Past File Size: %s %d/%d", filePath, copied, size)
+		}
+		uploaded[filePath] = copied
+	})
+	if err != nil {
+		t.Fatalf("Error Uploading Directory: %v", err)
+	}
+	if len(uploaded) != len(files) {
+		t.Errorf("Expected Progress For %d Files, Got %v", len(files), uploaded)
+	}
+	err = sshClient.Download(filepath.Join(remote, "tree"), back, nil)
+	if err != nil {
+		t.Fatalf("Error Downloading Directory: %v", err)
+	}
+	for name, data := range files {
+		for _, dir := range []string{filepath.Join(remote, "tree"), back} {
+			fPath := filepath.Join(dir, filepath.FromSlash(name))
+			got, err := ioutil.ReadFile(fPath)
+			if err != nil || !bytes.Equal(got, data) {
+				t.Errorf("File %s Not Copied: %v", fPath, err)
+			}
+		}
+		if uploaded[filepath.Join(remote, "tree", filepath.FromSlash(name))] != int64(len(data)) {
+			t.Errorf("Progress For %s Did Not Reach %d: %v", name, len(data), uploaded)
+		}
+	}
+	info, err := os.Stat(filepath.Join(back, "a.txt"))
+	if err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("File Mode Not Preserved: %v %v", info, err)
+	}
+	fmt.Println("<-----------testSFTPUploadDownload COMPLETE")
+}
+
+// testSFTPDirOps
+func testSFTPDirOps(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testSFTPDirOps...")
+	sshClient := startTestSSHClient(t)
+	remote := tempTestDir(t)
+	dir := filepath.Join(remote, "x", "y")
+	if err := sshClient.Mkdir(dir, 0750); err != nil {
+		t.Fatalf("Error Making Remote Directory: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "f"), []byte("f"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := sshClient.Chmod(filepath.Join(dir, "f"), 0600); err != nil {
+		t.Fatalf("Error Changing Remote Mode: %v", err)
+	}
+	infos, err := sshClient.ReadDir(filepath.Join(remote, "x"))
+	if err != nil || len(infos) != 1 || infos[0].Name() != "y" || !infos[0].IsDir() || infos[0].Mode().Perm() != 0750 {
+		t.Fatalf("Unexpected Remote Directory Listing: %v %v", infos, err)
+	}
+	infos, err = sshClient.ReadDir(dir)
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	if err != nil || len(names) != 1 || names[0] != "f" || infos[0].Mode().Perm() != 0600 {
+		t.Errorf("Unexpected Remote Directory Listing: %v %v", names, err)
+	}
+	if _, err = sshClient.ReadDir(filepath.Join(remote, "missing")); !os.IsNotExist(err) {
+		t.Errorf("Expected A Not Exist Error, Got %v", err)
+	}
+	fmt.Println("<-----------testSFTPDirOps COMPLETE")
+}
+
+// testSFTPCancel
+func testSFTPCancel(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testSFTPCancel...")
+	sshClient := startTestSSHClient(t)
+	local, remote := tempTestDir(t), tempTestDir(t)
+	writeTestTree(t, local)
+	ctx, cancel := context.WithCancel(context.Background())
+	err := sshClient.UploadContext(ctx, local, remote, func(filePath string, copied int64, size int64) {
+		cancel()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, Got %v", err)
+	}
+	fmt.Println("<-----------testSFTPCancel COMPLETE")
+}
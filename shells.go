@@ -14,9 +14,9 @@ package containers
 
 import (
 	"bytes"
-	"fmt"
+	"context"
+	"errors"
 	"io/ioutil"
-	"log"
 	"os/exec"
 	"regexp"
 	"strings"
@@ -24,6 +24,42 @@ import (
 
 const ShellToUse = "bash"
 
+// CommandError is returned when a command fails, along with its exit status and stderr
+type CommandError struct {
+	Args     []string
+	ExitCode int
+	Stderr   string
+	Err      error
+}
+
+// newCommandError creates a pointer to a new CommandError
+func newCommandError(args []string, stderr []byte, err error) *CommandError {
+	exitCode := -1
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	}
+	return &CommandError{args, exitCode, strings.TrimSpace(string(stderr)), err}
+}
+
+// Error returns the command, its failure and its stderr, leaving out any arguments past the third
+func (e *CommandError) Error() string {
+	args := e.Args
+	if len(args) > 3 {
+		args = args[:3]
+	}
+	msg := strings.Join(args, " ") + ": " + e.Err.Error()
+	if e.Stderr != "" {
+		msg = msg + ": " + e.Stderr
+	}
+	return msg
+}
+
+// Unwrap returns the CommandError's underlying error
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
 // CMD defines a async os command
 type CMD struct {
 	Type        string
@@ -42,7 +78,6 @@ func newCMD(raw string) (*CMD, error) {
 	cmd.Raw = raw
 	err := cmd.loadArgs()
 	if err != nil {
-		log.Fatal(err.Error())
 		return &cmd, err
 	}
 	if strings.Contains(raw, "#cloud-config") {
@@ -53,7 +88,6 @@ func newCMD(raw string) (*CMD, error) {
 		err = cmd.buildCmd()
 	}
 	if err != nil {
-		log.Fatal(err.Error())
 		return &cmd, err
 	}
 	cmd.Status = 1
@@ -75,14 +109,9 @@ func (cm *CMD) buildInitCmd() error {
 	fName, err := createBashFile("INIT", contentStr)
 	cm.ScriptName = fName
 	if err != nil {
-		log.Fatal(err.Error())
 		return err
 	}
 	cm.Cmd = buildBashCommand(fName)
-	if err != nil {
-		log.Fatal(err.Error())
-		return err
-	}
 	return nil
 }
 
@@ -95,7 +124,6 @@ func (cm *CMD) loadArgs() error {
 	for _, dq := range doubleQuotes {
 		key, err := generateUuid()
 		if err != nil {
-			log.Fatal(err.Error())
 			return err
 		}
 		subEnt := key + "|||" + string(dq)
@@ -125,39 +153,61 @@ func (cm *CMD) buildCmd() error {
 	return nil
 }
 
-// cleanScript
+// cleanScript scrubs a CMD's init script, which may hold secrets, from the disk
 func (cm *CMD) cleanScript() error {
-	return deleteFile(cm.ScriptName)
+	return scrubFile(cm.ScriptName)
 }
 
 // Execute a CMD
 func (cm *CMD) Execute() error {
+	return cm.ExecuteContext(context.Background())
+}
+
+// ExecuteContext executes a CMD, killing its process group and returning ctx.Err() once ctx is done,
+// a script CMD's script is scrubbed whether or not it succeeds
+func (cm *CMD) ExecuteContext(ctx context.Context) error {
+	err := cm.execute(ctx)
+	if cm.Type == "script" {
+		if cleanErr := cm.cleanScript(); err == nil {
+			err = cleanErr
+		}
+	}
+	return err
+}
+
+// execute runs a CMD and stores its output
+func (cm *CMD) execute(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cm.Cmd.Stderr = &stderr
 	stdout, err := cm.Cmd.StdoutPipe()
 	if err != nil {
-		log.Fatal(err.Error())
+		return err
 	}
-	err = cm.Cmd.Start()
+	setProcessGroup(cm.Cmd)
+	if err = cm.Cmd.Start(); err != nil {
+		return newCommandError(cm.Cmd.Args, stderr.Bytes(), err)
+	}
+	stop := watchCommand(ctx, cm.Cmd)
 	dat, err := ioutil.ReadAll(stdout)
-	if err != nil {
-		log.Fatal(err.Error())
+	if err == nil {
+		err = cm.Cmd.Wait()
+	} else {
+		_ = cm.Cmd.Wait()
 	}
-	err = cm.Cmd.Wait()
-	if err != nil {
-		log.Fatal(err.Error())
-		return err
+	stop()
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	} else if err != nil {
+		return newCommandError(cm.Cmd.Args, stderr.Bytes(), err)
 	}
 	chkRes := string(dat)
 	chkRes = strings.Replace(chkRes, " ", "", -1)
 	chkRes = strings.Replace(chkRes, "\n", "", -1)
 	chkRes = strings.Replace(chkRes, "\t", "", -1)
-	if cm.Type == "script" {
-		//time.Sleep(30 * time.Second)
-		err = cm.cleanScript()
-		if err != nil {
-			log.Fatal(err.Error())
-			return err
-		}
-	} else if chkRes == "[]" {
+	if cm.Type != "script" && chkRes == "[]" {
 		dat = []byte("[RETRY]")
 		cm.OutputBytes = dat
 		return nil
@@ -181,7 +231,6 @@ func NewShell(name string, sType string, commands []string) (*Shell, error) {
 	for _, command := range commands {
 		sCMD, err := newCMD(command)
 		if err != nil {
-			log.Fatal(err.Error())
 			return &Shell{Status: 0}, err
 		}
 		sCMDs = append(sCMDs, sCMD)
@@ -191,12 +240,16 @@ func NewShell(name string, sType string, commands []string) (*Shell, error) {
 
 // Execute a Shell
 func (sh *Shell) Execute() error {
+	return sh.ExecuteContext(context.Background())
+}
+
+// ExecuteContext executes a Shell, stopping at the first CMD interrupted by ctx
+func (sh *Shell) ExecuteContext(ctx context.Context) error {
 	var err error
 	for ind, cMD := range sh.Commands {
-		err = cMD.Execute()
+		err = cMD.ExecuteContext(ctx)
 		if err != nil {
 			sh.Status = 0
-			log.Fatal(err.Error())
 			return err
 		}
 		sh.Commands[ind] = cMD
@@ -216,8 +269,12 @@ func (sh *Shell) OutputBytes() [][]byte {
 
 // Run a Shell
 func (sh *Shell) Run() error {
-	if err := sh.Execute(); err != nil {
-		log.Fatal(err.Error())
+	return sh.RunContext(context.Background())
+}
+
+// RunContext runs a Shell until it finishes or ctx is done
+func (sh *Shell) RunContext(ctx context.Context) error {
+	if err := sh.ExecuteContext(ctx); err != nil {
 		return err
 	}
 	return nil
@@ -225,17 +282,18 @@ func (sh *Shell) Run() error {
 
 // SHELL executes a unix shell Cmd
 func SHELL(name string, sType string, cmdStr string) ([][]byte, error) {
+	return SHELLContext(context.Background(), name, sType, cmdStr)
+}
+
+// SHELLContext executes a unix shell Cmd until it finishes or ctx is done
+func SHELLContext(ctx context.Context, name string, sType string, cmdStr string) ([][]byte, error) {
 	var outBytes [][]byte
 	commands := []string{cmdStr}
 	newShell, err := NewShell(name, sType, commands)
 	if err != nil {
-		fmt.Println("ERROR: shells.go, line 230: ", err.Error())
-		log.Fatal(err.Error())
 		return outBytes, err
 	}
-	if err = newShell.Run(); err != nil {
-		fmt.Println("ERROR: shells.go, line 236: ", err.Error())
-		log.Fatal(err.Error())
+	if err = newShell.RunContext(ctx); err != nil {
 		return outBytes, err
 	}
 	return newShell.OutputBytes(), nil
@@ -243,11 +301,57 @@ func SHELL(name string, sType string, cmdStr string) ([][]byte, error) {
 
 // BASH
 func BASH(command string) ([]byte, []byte, error) {
+	return BASHContext(context.Background(), command)
+}
+
+// BASHContext runs command with bash until it finishes or ctx is done
+func BASHContext(ctx context.Context, command string) ([]byte, []byte, error) {
+	return runCommand(ctx, exec.Command(ShellToUse, "-c", command))
+}
+
+// LXC executes an lxc client command without a shell
+func LXC(args ...string) ([]byte, []byte, error) {
+	return LXCContext(context.Background(), args...)
+}
+
+// LXCContext executes an lxc client command without a shell until it finishes or ctx is done
+func LXCContext(ctx context.Context, args ...string) ([]byte, []byte, error) {
+	return runCommand(ctx, exec.Command("lxc", args...))
+}
+
+// runCommand runs cmd and returns its stdout and stderr, killing its process group and returning ctx.Err() once ctx is done
+func runCommand(ctx context.Context, cmd *exec.Cmd) ([]byte, []byte, error) {
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
-	cmd := exec.Command(ShellToUse, "-c", command)
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
-	err := cmd.Run()
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+	stop := watchCommand(ctx, cmd)
+	err := cmd.Wait()
+	stop()
+	if err != nil && ctx.Err() != nil {
+		return stdout.Bytes(), stderr.Bytes(), ctx.Err()
+	}
 	return stdout.Bytes(), stderr.Bytes(), err
 }
+
+// watchCommand kills the process group of a started cmd if ctx is done before the returned stop is called
+func watchCommand(ctx context.Context, cmd *exec.Cmd) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = killProcessGroup(cmd)
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
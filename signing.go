@@ -0,0 +1,164 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SignatureMode is how a SignaturePolicy treats the signatures of GoImages being imported
+type SignatureMode string
+
+const (
+	SignatureIgnore  SignatureMode = "ignore"  // import every GoImage without checking its signature
+	SignatureVerify  SignatureMode = "verify"  // refuse GoImages with a bad signature, but import unsigned ones
+	SignatureRequire SignatureMode = "require" // refuse GoImages without a good signature from a trusted key
+)
+
+// DefaultSignaturePolicy is the SignaturePolicy of every GoImage and GoCluster that does not set its own
+var DefaultSignaturePolicy = NewSignaturePolicy(SignatureIgnore)
+
+// manifestContext is prepended to every signed ImageManifest so its signatures cannot be reused for other data
+const manifestContext = "go-containers image manifest v1\n"
+
+// ImageManifest is what an ImageSignature vouches for
+type ImageManifest struct {
+	Fingerprint string `json:"fingerprint"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Created     string `json:"created"`
+}
+
+// Marshal returns the bytes of the ImageManifest that are signed
+func (m ImageManifest) Marshal() ([]byte, error) {
+	manifest, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(manifestContext), manifest...), nil
+}
+
+// ImageSignature is a detached ed25519 signature over a GoImage's ImageManifest
+type ImageSignature struct {
+	Manifest  ImageManifest `json:"manifest"`
+	KeyID     string        `json:"key_id"`
+	Signature []byte        `json:"signature"`
+}
+
+// LoadImageSignature loads an ImageSignature from its JSON
+func LoadImageSignature(data []byte) (*ImageSignature, error) {
+	var sig ImageSignature
+	if err := json.Unmarshal(data, &sig); err != nil {
+		return nil, err
+	}
+	return &sig, nil
+}
+
+// SigningKeyID identifies an ed25519 public key by the start of its SHA-256 hash
+func SigningKeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// SignaturePolicy decides which GoImages may be imported by the keys that signed them
+type SignaturePolicy struct {
+	Mode        SignatureMode
+	TrustedKeys []ed25519.PublicKey
+}
+
+// NewSignaturePolicy creates a pointer to a new SignaturePolicy trusting keys
+func NewSignaturePolicy(mode SignatureMode, keys ...ed25519.PublicKey) *SignaturePolicy {
+	return &SignaturePolicy{mode, keys}
+}
+
+// Verify returns why the SignaturePolicy refuses to import a GoImage, if it does
+func (sp *SignaturePolicy) Verify(im *GoImage) error {
+	switch sp.Mode {
+	case SignatureIgnore:
+		return nil
+	case SignatureVerify, SignatureRequire:
+	default:
+		return fmt.Errorf("unsupported SignatureMode %q", sp.Mode)
+	}
+	sig := im.Signature
+	if sig == nil {
+		if sp.Mode == SignatureRequire {
+			return errors.New("image is not signed")
+		}
+		return nil
+	}
+	if manifest := im.Manifest(); sig.Manifest != manifest {
+		return fmt.Errorf("signed manifest %+v does not describe the image %+v", sig.Manifest, manifest)
+	}
+	if !isFingerprint(sig.Manifest.Fingerprint) {
+		return fmt.Errorf("signed manifest has no image fingerprint")
+	}
+	message, err := sig.Manifest.Marshal()
+	if err != nil {
+		return err
+	}
+	for _, key := range sp.TrustedKeys {
+		if len(key) == ed25519.PublicKeySize && ed25519.Verify(key, message, sig.Signature) {
+			return nil
+		}
+	}
+	return fmt.Errorf("image is not signed by a trusted key, it was signed by %q", sig.KeyID)
+}
+
+// Manifest returns the ImageManifest describing the GoImage
+func (im *GoImage) Manifest() ImageManifest {
+	return ImageManifest{
+		Fingerprint: im.Fingerprint,
+		Name:        im.Name,
+		Type:        im.Type,
+		Created:     im.DateTime,
+	}
+}
+
+// Sign the GoImage's ImageManifest with key, a GoImage without a DateTime is stamped with the current time
+func (im *GoImage) Sign(key ed25519.PrivateKey) error {
+	if len(key) != ed25519.PrivateKeySize {
+		return &OpError{"sign image", im.Name, nil, errors.New("invalid ed25519 private key")}
+	}
+	if !isFingerprint(im.Fingerprint) {
+		return &OpError{"sign image", im.Name, nil, fmt.Errorf("cannot sign an image without its full fingerprint, got %q", im.Fingerprint)}
+	}
+	if im.DateTime == "" {
+		im.DateTime = time.Now().UTC().Format(time.RFC3339)
+	}
+	manifest := im.Manifest()
+	message, err := manifest.Marshal()
+	if err != nil {
+		return &OpError{"sign image", im.Name, nil, err}
+	}
+	im.Signature = &ImageSignature{
+		Manifest:  manifest,
+		KeyID:     SigningKeyID(key.Public().(ed25519.PublicKey)),
+		Signature: ed25519.Sign(key, message),
+	}
+	return nil
+}
+
+// policy returns the GoImage's SignaturePolicy, defaulting to the DefaultSignaturePolicy
+func (im *GoImage) policy() *SignaturePolicy {
+	if im.Policy != nil {
+		return im.Policy
+	}
+	return DefaultSignaturePolicy
+}
@@ -0,0 +1,144 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// TestSigning
+func TestSigning(t *testing.T) {
+	t.Run("SignAndVerify", testSignAndVerify)
+	t.Run("ImportContainerPolicy", testImportContainerPolicy)
+}
+
+// newTestSigningKey generates an ed25519 signing key
+func newTestSigningKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error Generating Test Signing Key: %v", err)
+	}
+	return pub, priv
+}
+
+// testSignAndVerify
+func testSignAndVerify(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testSignAndVerify...")
+	pub, priv := newTestSigningKey(t)
+	otherPub, _ := newTestSigningKey(t)
+	img := NewGoImage("signed", "Container", "", "")
+	if err := img.Sign(priv); err == nil {
+		t.Errorf("Expected Sign To Need The Image Fingerprint")
+	}
+	img.Fingerprint = "6f1b0a4a3c2d7e9f8b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a"
+	if err := img.Sign(priv); err != nil || img.Signature == nil || img.DateTime == "" {
+		t.Fatalf("Error Signing Image: %v", err)
+	}
+	if img.Signature.KeyID != SigningKeyID(pub) {
+		t.Errorf("Expected The Signature To Name Its Key %s, Got %s", SigningKeyID(pub), img.Signature.KeyID)
+	}
+	sigJSON, err := json.Marshal(img.Signature)
+	if err != nil {
+		t.Fatalf("Error Marshaling Signature: %v", err)
+	}
+	moved := NewGoImage(img.Name, img.Type, img.Fingerprint, img.DateTime)
+	if moved.Signature, err = LoadImageSignature(sigJSON); err != nil {
+		t.Fatalf("Error Loading Signature: %v", err)
+	}
+	tests := []struct {
+		name   string
+		policy *SignaturePolicy
+		image  func() *GoImage
+		ok     bool
+	}{
+		{"Trusted", NewSignaturePolicy(SignatureRequire, otherPub, pub), func() *GoImage { return moved }, true},
+		{"Untrusted", NewSignaturePolicy(SignatureVerify, otherPub), func() *GoImage { return moved }, false},
+		{"Unsigned", NewSignaturePolicy(SignatureRequire, pub), func() *GoImage { return NewGoImage("unsigned", "Container", img.Fingerprint, "") }, false},
+		{"UnsignedAllowed", NewSignaturePolicy(SignatureVerify, pub), func() *GoImage { return NewGoImage("unsigned", "Container", img.Fingerprint, "") }, true},
+		{"Ignored", NewSignaturePolicy(SignatureIgnore), func() *GoImage { return NewGoImage("unsigned", "Container", img.Fingerprint, "") }, true},
+		{"Renamed", NewSignaturePolicy(SignatureRequire, pub), func() *GoImage {
+			renamed := *moved
+			renamed.Name = "renamed"
+			return &renamed
+		}, false},
+		{"OtherFingerprint", NewSignaturePolicy(SignatureRequire, pub), func() *GoImage {
+			other := *moved
+			other.Fingerprint = "0000000000000000000000000000000000000000000000000000000000000000"
+			return &other
+		}, false},
+		{"ForgedManifest", NewSignaturePolicy(SignatureRequire, pub), func() *GoImage {
+			forged := *moved
+			sig := *moved.Signature
+			sig.Manifest.Type = ImageTypeVM
+			forged.Signature, forged.Type = &sig, ImageTypeVM
+			return &forged
+		}, false},
+	}
+	for _, tt := range tests {
+		if err = tt.policy.Verify(tt.image()); (err == nil) != tt.ok {
+			t.Errorf("%s: Expected Verified %v, Got %v", tt.name, tt.ok, err)
+		}
+	}
+	fmt.Println("<-----------testSignAndVerify COMPLETE")
+}
+
+// testImportContainerPolicy
+func testImportContainerPolicy(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testImportContainerPolicy...")
+	goCluster, fake := newTestCluster("")
+	if fake == nil {
+		t.Skip("the signed import test needs the FakeBackend")
+	}
+	pub, priv := newTestSigningKey(t)
+	if err := goCluster.CreateContainer(NewAuth("tester", AuthPassword, "l0lThis1sAWeak1", "", "22"), false, "SignTest", "ubuntu", "focal", []byte{}); err != nil {
+		t.Fatalf("Error Creating Sign Test Container: %v", err)
+	}
+	img, err := goCluster.ExportContainer("SignTest")
+	if err != nil {
+		t.Fatalf("Error Exporting Sign Test Container: %v", err)
+	}
+	goCluster.Policy = NewSignaturePolicy(SignatureRequire, pub)
+	fmt.Println("----------->BEGINNING A: Refuse an unsigned image...")
+	if _, err = goCluster.ImportContainer("UnsignedImport", img); !errors.Is(err, ErrImageSignature) {
+		t.Errorf("Expected ErrImageSignature For An Unsigned Image, Got %v", err)
+	}
+	if _, ok := fake.Containers["UnsignedImport"]; ok || len(fake.StoredImages) != 0 {
+		t.Errorf("Expected Nothing To Be Imported From An Unsigned Image")
+	}
+	fmt.Println("----------->PASSED A: Refuse an unsigned image...")
+	fmt.Println("----------->BEGINNING B: Import a signed image...")
+	if err = img.Sign(priv); err != nil {
+		t.Fatalf("Error Signing Image: %v", err)
+	}
+	if _, err = goCluster.ImportContainer("SignedImport", img); err != nil {
+		t.Fatalf("Error Importing Signed Image: %v", err)
+	}
+	if _, ok := fake.Containers["SignedImport"]; !ok {
+		t.Errorf("Expected The Signed Image To Be Imported")
+	}
+	fmt.Println("----------->PASSED B: Import a signed image...")
+	fmt.Println("----------->BEGINNING C: Refuse content swapped under a signature...")
+	img.Policy = nil
+	img.Contents[0] = append([]byte{}, img.Contents[0]...)
+	img.Contents[0][len(img.Contents[0])-1] ^= 0xff
+	if _, err = goCluster.ImportContainer("SwappedImport", img); !errors.Is(err, ErrImageMismatch) {
+		t.Errorf("Expected ErrImageMismatch For Swapped Content, Got %v", err)
+	}
+	fmt.Println("----------->PASSED C: Refuse content swapped under a signature...")
+	fmt.Println("<-----------testImportContainerPolicy COMPLETE")
+}
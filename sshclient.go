@@ -0,0 +1,220 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SSHPTY is the pseudo terminal requested for an SSHCommand
+type SSHPTY struct {
+	Term   string
+	Width  int
+	Height int
+	Modes  ssh.TerminalModes
+}
+
+// NewSSHPTY creates a pointer to a new SSHPTY with echo turned off
+func NewSSHPTY(term string, width int, height int) *SSHPTY {
+	return &SSHPTY{term, width, height, ssh.TerminalModes{ssh.ECHO: 0}}
+}
+
+// SSHCommand is a command to run over an SSHClient, a nil Stdin is empty and a nil Stdout or Stderr is discarded
+type SSHCommand struct {
+	Cmd    string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	Env    map[string]string
+	PTY    *SSHPTY
+}
+
+// NewSSHCommand creates a pointer to a new SSHCommand
+func NewSSHCommand(cmd string) *SSHCommand {
+	return &SSHCommand{cmd, nil, nil, nil, map[string]string{}, nil}
+}
+
+// SSHSession is an SSHCommand running on a session of its own, many can run at once on one SSHClient
+type SSHSession struct {
+	Session *ssh.Session
+	cmd     string
+	stderr  *bytes.Buffer
+	done    chan struct{}
+	code    int
+	err     error
+}
+
+// Start an SSHCommand on a new session of the SSHClient
+func (sc *SSHClient) Start(cmd *SSHCommand) (*SSHSession, error) {
+	return sc.StartContext(context.Background(), cmd)
+}
+
+// StartContext starts an SSHCommand on a new session of the SSHClient, killing it once ctx is done
+func (sc *SSHClient) StartContext(ctx context.Context, cmd *SSHCommand) (*SSHSession, error) {
+	if sc.SSHConn == nil {
+		return nil, errors.New("the SSHClient is not connected")
+	} else if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	session, err := sc.SSHConn.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	command, err := setSessionEnv(session, cmd)
+	if err != nil {
+		_ = session.Close()
+		return nil, err
+	}
+	if cmd.PTY != nil {
+		err = session.RequestPty(cmd.PTY.Term, cmd.PTY.Height, cmd.PTY.Width, cmd.PTY.Modes)
+		if err != nil {
+			_ = session.Close()
+			return nil, err
+		}
+	}
+	ss := &SSHSession{session, cmd.Cmd, nil, make(chan struct{}), 0, nil}
+	session.Stdin = cmd.Stdin
+	session.Stdout = cmd.Stdout
+	session.Stderr = cmd.Stderr
+	if cmd.Stderr == nil {
+		ss.stderr = &bytes.Buffer{}
+		session.Stderr = ss.stderr
+	}
+	if err = session.Start(command); err != nil {
+		_ = session.Close()
+		return nil, err
+	}
+	go ss.wait(ctx)
+	return ss, nil
+}
+
+// envName matches the environment variable names an SSHCommand may set
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// setSessionEnv sets an SSHCommand's Env on session, exporting the variables the server refuses in the returned command instead
+func setSessionEnv(session *ssh.Session, cmd *SSHCommand) (string, error) {
+	var keys []string
+	for key := range cmd.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var exports []string
+	for _, key := range keys {
+		if !envName.MatchString(key) {
+			return cmd.Cmd, fmt.Errorf("invalid environment variable name %q", key)
+		}
+		if err := session.Setenv(key, cmd.Env[key]); err != nil {
+			exports = append(exports, "export "+key+"="+shellQuote(cmd.Env[key])+";")
+		}
+	}
+	if len(exports) == 0 {
+		return cmd.Cmd, nil
+	}
+	return strings.Join(exports, " ") + " " + cmd.Cmd, nil
+}
+
+// shellQuote single quotes val for a POSIX shell
+func shellQuote(val string) string {
+	return "'" + strings.Replace(val, "'", `'\''`, -1) + "'"
+}
+
+// wait records how an SSHSession's command exited, or kills it once ctx is done
+func (ss *SSHSession) wait(ctx context.Context) {
+	defer close(ss.done)
+	waitErr := make(chan error, 1)
+	go func() {
+		waitErr <- ss.Session.Wait()
+	}()
+	select {
+	case err := <-waitErr:
+		ss.code, ss.err = ss.exitStatus(err)
+		_ = ss.Session.Close()
+	case <-ctx.Done():
+		_ = ss.Session.Signal(ssh.SIGKILL)
+		_ = ss.Session.Close()
+		ss.code, ss.err = -1, ctx.Err()
+	}
+}
+
+// exitStatus returns the exit status of an SSHSession's command from its Wait error, a non-zero one as a CommandError
+func (ss *SSHSession) exitStatus(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		stderr := ""
+		if ss.stderr != nil {
+			stderr = strings.TrimSpace(ss.stderr.String())
+		}
+		return exitErr.ExitStatus(), &CommandError{[]string{ss.cmd}, exitErr.ExitStatus(), stderr, err}
+	}
+	return -1, err
+}
+
+// Wait until an SSHSession's command exits and return its exit status
+func (ss *SSHSession) Wait() (int, error) {
+	<-ss.done
+	return ss.code, ss.err
+}
+
+// Signal sends sig to an SSHSession's command
+func (ss *SSHSession) Signal(sig ssh.Signal) error {
+	return ss.Session.Signal(sig)
+}
+
+// Close an SSHSession
+func (ss *SSHSession) Close() error {
+	return ss.Session.Close()
+}
+
+// Run an SSHCommand and return its exit status, a non-zero one along with a CommandError
+func (sc *SSHClient) Run(cmd *SSHCommand) (int, error) {
+	return sc.RunContext(context.Background(), cmd)
+}
+
+// RunContext is like Run but returns ctx.Err() once ctx is done
+func (sc *SSHClient) RunContext(ctx context.Context, cmd *SSHCommand) (int, error) {
+	ss, err := sc.StartContext(ctx, cmd)
+	if err != nil {
+		return -1, err
+	}
+	return ss.Wait()
+}
+
+// Output runs cmd over the SSHClient and returns its stdout and stderr
+func (sc *SSHClient) Output(cmd string) ([]byte, []byte, error) {
+	return sc.OutputContext(context.Background(), cmd)
+}
+
+// OutputContext is like Output but returns ctx.Err() once ctx is done
+func (sc *SSHClient) OutputContext(ctx context.Context, cmd string) ([]byte, []byte, error) {
+	var stdout, stderr bytes.Buffer
+	sshCmd := NewSSHCommand(cmd)
+	sshCmd.Stdout = &stdout
+	sshCmd.Stderr = &stderr
+	_, err := sc.RunContext(ctx, sshCmd)
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		cmdErr.Stderr = strings.TrimSpace(stderr.String())
+	}
+	return stdout.Bytes(), stderr.Bytes(), err
+}
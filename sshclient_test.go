@@ -0,0 +1,252 @@
+/*
+Author: John Connor Sanders
+License: Apache Version 2.0
+Version: 0.0.3
+Released: 04/18/2021
+Copyright 2021 John Connor Sanders
+
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+------------GO-CONTAINERS----------------
+-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-*-
+*/
+
+package containers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// serveTestSession runs exec requests of a session channel with bash on the test host and serves the sftp
+// subsystem from the test host's filesystem, accepting only LANG and LC_* env requests like a default sshd
+func serveTestSession(newChan ssh.NewChannel) {
+	channel, reqs, err := newChan.Accept()
+	if err != nil {
+		return
+	}
+	var env []string
+	var mu sync.Mutex
+	var cmd *exec.Cmd
+	for req := range reqs {
+		switch req.Type {
+		case "env":
+			var kv struct{ Name, Value string }
+			_ = ssh.Unmarshal(req.Payload, &kv)
+			accept := kv.Name == "LANG" || strings.HasPrefix(kv.Name, "LC_")
+			if accept {
+				env = append(env, kv.Name+"="+kv.Value)
+			}
+			_ = req.Reply(accept, nil)
+		case "pty-req":
+			var pty struct {
+				Term                    string
+				Columns, Rows, Wpx, Hpx uint32
+				Modes                   string
+			}
+			_ = ssh.Unmarshal(req.Payload, &pty)
+			env = append(env, "TERM="+pty.Term, fmt.Sprintf("COLUMNS=%d", pty.Columns), fmt.Sprintf("LINES=%d", pty.Rows))
+			_ = req.Reply(true, nil)
+		case "exec":
+			var ex struct{ Command string }
+			_ = ssh.Unmarshal(req.Payload, &ex)
+			_ = req.Reply(true, nil)
+			mu.Lock()
+			cmd = exec.Command(ShellToUse, "-c", ex.Command)
+			cmd.Env = append(os.Environ(), env...)
+			cmd.Stdin = channel
+			cmd.Stdout = channel
+			cmd.Stderr = channel.Stderr()
+			setProcessGroup(cmd)
+			err = cmd.Start()
+			mu.Unlock()
+			go func() {
+				status := uint32(127)
+				if err == nil {
+					status = 0
+					var exitErr *exec.ExitError
+					if waitErr := cmd.Wait(); errors.As(waitErr, &exitErr) {
+						status = uint32(exitErr.ExitCode())
+					}
+				}
+				_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+				_ = channel.Close()
+			}()
+		case "subsystem":
+			var sub struct{ Name string }
+			_ = ssh.Unmarshal(req.Payload, &sub)
+			_ = req.Reply(sub.Name == "sftp", nil)
+			if sub.Name == "sftp" {
+				go func() {
+					if server, err := sftp.NewServer(channel); err == nil {
+						_ = server.Serve()
+					}
+					_ = channel.Close()
+				}()
+			}
+		case "signal":
+			mu.Lock()
+			if cmd != nil {
+				_ = killProcessGroup(cmd)
+			}
+			mu.Unlock()
+		default:
+			_ = req.Reply(false, nil)
+		}
+	}
+}
+
+// startTestSSHClient opens an SSHClient on a test SSH server
+func startTestSSHClient(t *testing.T) *SSHClient {
+	_, fake := newTestCluster("")
+	fakeCon := fake.AddContainer("SSHClientTest", "ubuntu", "focal")
+	_ = setHostKeys("SSHClientTest", nil) // forget the host key of the previous test's container
+	cAuth := NewAuth("tester", AuthPassword, "l0lThis1sAWeak1", "", "")
+	cAuth.Port = startTestSSHServer(t, fakeCon.HostKey, "tester", "l0lThis1sAWeak1")
+	goCon := &GoContainer{Name: "SSHClientTest", Network: &Network{PrivateIP: "127.0.0.1"}, Auth: cAuth}
+	goCon.SetBackend(fake)
+	if err := goCon.OpenSSH(); err != nil {
+		t.Fatalf("Error Opening Test SSHClient: %v", err)
+	}
+	t.Cleanup(func() { _ = goCon.SSHClient.Close() })
+	return goCon.SSHClient
+}
+
+// TestSSHClient
+func TestSSHClient(t *testing.T) {
+	if testLXD() {
+		t.Skip("the test SSH server runs commands on the test host")
+	}
+	if _, err := exec.LookPath(ShellToUse); err != nil {
+		t.Skip("the test SSH server needs " + ShellToUse)
+	}
+	t.Run("Run", testSSHClientRun)
+	t.Run("ExitStatus", testSSHClientExitStatus)
+	t.Run("EnvAndPTY", testSSHClientEnvAndPTY)
+	t.Run("Concurrent", testSSHClientConcurrent)
+	t.Run("Cancel", testSSHClientCancel)
+}
+
+// testSSHClientRun
+func testSSHClientRun(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testSSHClientRun...")
+	sshClient := startTestSSHClient(t)
+	var stdout, stderr bytes.Buffer
+	cmd := NewSSHCommand("tr a-z A-Z && echo oops >&2")
+	cmd.Stdin = strings.NewReader("hello container\n")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	code, err := sshClient.Run(cmd)
+	if err != nil || code != 0 {
+		t.Fatalf("Error Running SSH Command: %d %v", code, err)
+	}
+	if stdout.String() != "HELLO CONTAINER\n" {
+		t.Errorf("Expected the upper cased stdin on stdout, got %q", stdout.String())
+	}
+	if stderr.String() != "oops\n" {
+		t.Errorf("Expected stderr to be kept apart, got %q", stderr.String())
+	}
+	fmt.Println("<-----------testSSHClientRun COMPLETE")
+}
+
+// testSSHClientExitStatus
+func testSSHClientExitStatus(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testSSHClientExitStatus...")
+	sshClient := startTestSSHClient(t)
+	_, _, err := sshClient.Output("echo failing >&2; exit 3")
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		t.Fatalf("Expected a CommandError, got %v", err)
+	}
+	if cmdErr.ExitCode != 3 || cmdErr.Stderr != "failing" {
+		t.Errorf("Expected exit status 3 with its stderr, got %d %q", cmdErr.ExitCode, cmdErr.Stderr)
+	}
+	code, err := sshClient.Run(NewSSHCommand("exit 4"))
+	if code != 4 || !errors.As(err, &cmdErr) {
+		t.Errorf("Expected exit status 4 from Run, got %d %v", code, err)
+	}
+	fmt.Println("<-----------testSSHClientExitStatus COMPLETE")
+}
+
+// testSSHClientEnvAndPTY
+func testSSHClientEnvAndPTY(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testSSHClientEnvAndPTY...")
+	sshClient := startTestSSHClient(t)
+	var stdout bytes.Buffer
+	cmd := NewSSHCommand(`echo "$LANG|$DEPLOY_ENV|$TERM|$COLUMNS"`)
+	cmd.Env["LANG"] = "C.UTF-8"
+	cmd.Env["DEPLOY_ENV"] = "it's staging"
+	cmd.PTY = NewSSHPTY("xterm-256color", 120, 40)
+	cmd.Stdout = &stdout
+	if _, err := sshClient.Run(cmd); err != nil {
+		t.Fatalf("Error Running SSH Command: %v", err)
+	}
+	if out := strings.TrimSpace(stdout.String()); out != "C.UTF-8|it's staging|xterm-256color|120" {
+		t.Errorf("Expected the env and pty to reach the command, got %q", out)
+	}
+	for _, key := range []string{"A&echo pwned&B", "A|echo", "A(B)", "A>B", "A<B", "1A", ""} {
+		stdout.Reset()
+		hostile := NewSSHCommand("true")
+		hostile.Env[key] = "x"
+		hostile.Stdout = &stdout
+		if _, err := sshClient.Run(hostile); err == nil || stdout.Len() != 0 {
+			t.Errorf("Expected the env key %q to be refused, got %v %q", key, err, stdout.String())
+		}
+	}
+	fmt.Println("<-----------testSSHClientEnvAndPTY COMPLETE")
+}
+
+// testSSHClientConcurrent
+func testSSHClientConcurrent(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testSSHClientConcurrent...")
+	sshClient := startTestSSHClient(t)
+	var sessions []*SSHSession
+	var outs []*bytes.Buffer
+	for i := 0; i < 5; i++ {
+		out := &bytes.Buffer{}
+		cmd := NewSSHCommand(fmt.Sprintf("sleep 0.2; echo %d", i))
+		cmd.Stdout = out
+		ss, err := sshClient.Start(cmd)
+		if err != nil {
+			t.Fatalf("Error Starting SSH Session %d: %v", i, err)
+		}
+		sessions = append(sessions, ss)
+		outs = append(outs, out)
+	}
+	for i, ss := range sessions {
+		if _, err := ss.Wait(); err != nil {
+			t.Errorf("Error Waiting on SSH Session %d: %v", i, err)
+		}
+		if outs[i].String() != fmt.Sprintf("%d\n", i) {
+			t.Errorf("Expected session %d to print %d, got %q", i, i, outs[i].String())
+		}
+	}
+	fmt.Println("<-----------testSSHClientConcurrent COMPLETE")
+}
+
+// testSSHClientCancel
+func testSSHClientCancel(t *testing.T) {
+	fmt.Println("\n<-----------BEGINNING: testSSHClientCancel...")
+	sshClient := startTestSSHClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	code, err := sshClient.RunContext(ctx, NewSSHCommand("sleep 5"))
+	if err != context.DeadlineExceeded || code != -1 {
+		t.Errorf("Expected context.DeadlineExceeded, got %d %v", code, err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the session to be killed at the deadline, took %v", elapsed)
+	}
+	fmt.Println("<-----------testSSHClientCancel COMPLETE")
+}
@@ -13,13 +13,10 @@ Copyright 2021 John Connor Sanders
 package containers
 
 import (
-	"fmt"
+	"context"
 	"github.com/gofrs/uuid"
-	"io/ioutil"
-	"log"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
 	"time"
 )
@@ -37,11 +34,22 @@ func getTimeStamp() string {
 	return t
 }
 
+// sleepContext pauses for d, returning ctx.Err() early if ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 // generateUuid
 func generateUuid() (string, error) {
 	uuId, err := uuid.NewV4()
 	if err != nil {
-		log.Fatal(err.Error())
 		return "", err
 	}
 	return uuId.String(), nil
@@ -53,31 +61,28 @@ func createDir(dirName string) error {
 	if os.IsNotExist(err) {
 		errDir := os.MkdirAll(dirName, 0755)
 		if errDir != nil {
-			fmt.Println("Error in utils.go on line 53: Creating the directory for ", dirName, " ", errDir.Error())
-			log.Fatal(errDir.Error())
 			return errDir
 		}
 	}
 	return nil
 }
 
-// createYMLDirs
+// createYMLDirs creates the inits directory, readable only by its owner as init scripts can hold secrets
 func createYMLDirs() error {
-	return createDir("inits")
+	if err := createDir("inits"); err != nil {
+		return err
+	}
+	return os.Chmod("inits", 0700)
 }
 
 // createJobDirectory
 func createJobDirectory(jType string) (string, error) {
 	jobId, err := generateUuid()
 	if err != nil {
-		fmt.Println("Error in utils.go on line 68: create the Job Uuid for ", jType, " ", err.Error())
-		log.Fatal(err.Error())
 		return jobId, err
 	}
 	err = createDir(jType)
 	if err != nil {
-		fmt.Println("Error in utils.go on line 76: create the directory for ", jType, ":", jobId, " ", err.Error())
-		log.Fatal(err.Error())
 		return jobId, err
 	}
 	jobDir := jType + "/" + jobId
@@ -90,75 +95,15 @@ func deleteJobDirectory(jType string, jobId string) error {
 	return os.RemoveAll(jobDir)
 }
 
-// scanFile
-func scanFile(fileName string) ([]byte, string, error) {
-	var contents []byte
-	var fName string
-	sFName := strings.Split(fileName, "/")
-	fName = sFName[len(sFName)-1]
-	file, err := os.Open(fileName)
-	if err != nil {
-		fmt.Println("Error in utils.go on line 96: Opening the tar.gz file, ", fileName, " ", err.Error())
-		log.Fatal(err.Error())
-		return contents, fName, err
-	}
-	defer file.Close()
-	contents, err = ioutil.ReadAll(file)
-	if err != nil {
-		fmt.Println("Error in utils.go on line 103: Reading the tar.gz file, ", fileName, " ", err.Error())
-		log.Fatal(err.Error())
-		return contents, fName, err
-	}
-	return contents, fName, nil
-}
-
-// scanJobDirectory
-func scanJobDirectory(jType string, jobId string) ([][]byte, []string, error) {
-	var dirContents [][]byte
-	var dirNames []string
-	var files []string
-	root := jType + "/" + jobId
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if info.IsDir() {
-			return nil
-		}
-		if filepath.Ext(path) != ".gz" {
-			return nil
-		}
-		files = append(files, path)
-		return nil
-	})
-	if err != nil {
-		fmt.Println("Error in utils.go on line 118: Scan the Job Directory, ", jType, " ", jobId, " ", err.Error())
-		log.Fatal(err.Error())
-		return dirContents, dirNames, err
-	}
-	for _, file := range files {
-		fContents, fName, fErr := scanFile(file)
-		if fErr != nil {
-			fmt.Println("Error in utils.go on line 135: Scanning the tar.gz file,  ", fName, " ", fErr.Error())
-			log.Fatal(fErr.Error())
-			return dirContents, dirNames, fErr
-		}
-		dirContents = append(dirContents, fContents)
-		dirNames = append(dirNames, fName)
-	}
-	return dirContents, dirNames, nil
-}
-
 // createFile
 func createFile(fName string, fContent []byte) error {
 	f, err := os.Create(fName)
 	if err != nil {
-		fmt.Println("Error in utils.go on line 149: Creating the new tar.gz file,  ", fName, " ", err.Error())
-		log.Fatal(err.Error())
 		return err
 	}
 	defer f.Close()
 	_, err = f.Write(fContent)
 	if err != nil {
-		fmt.Println("Error in utils.go on line 135: Writing the new tar.gz file,  ", fName, " ", err.Error())
-		log.Fatal(err.Error())
 		return err
 	}
 	return nil
@@ -168,7 +113,6 @@ func createFile(fName string, fContent []byte) error {
 func deleteFile(fName string) error {
 	err := os.Remove(fName)
 	if err != nil {
-		log.Fatal(err.Error())
 		return err
 	}
 	return nil
@@ -178,31 +122,49 @@ func deleteFile(fName string) error {
 func createBashFile(fType string, contents string) (string, error) {
 	err := createYMLDirs()
 	if err != nil {
-		log.Fatal(err.Error())
 		return "", err
 	}
 	fName, err := generateUuid()
 	if err != nil {
-		log.Fatal(err.Error())
 		return fName, err
 	}
 	if fType == "INIT" {
 		fName = "inits/" + fName + ".sh"
 	}
-	f, err := os.Create(fName)
+	f, err := os.OpenFile(fName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
 	if err != nil {
-		log.Fatal(err.Error())
-		return fName, nil
+		return fName, err
 	}
 	defer f.Close()
 	_, err = f.WriteString(contents)
 	if err != nil {
-		log.Fatal(err.Error())
-		return fName, nil
+		return fName, err
 	}
 	return fName, nil
 }
 
+// scrubFile overwrites a file with zeros and syncs it to disk before deleting it
+func scrubFile(fName string) error {
+	f, err := os.OpenFile(fName, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err == nil {
+		_, err = f.Write(make([]byte, info.Size()))
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if rmErr := os.Remove(fName); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
 // buildBashCommand
 func buildBashCommand(fName string) *exec.Cmd {
 	return exec.Command("/bin/sh", fName)